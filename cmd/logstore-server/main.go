@@ -0,0 +1,94 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+// Command logstore-server exposes a log directory over HTTP. See package httpapi for the list of endpoints.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/elgopher/logstore/httpapi"
+	"github.com/elgopher/logstore/log"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	dir := flag.String("dir", "", "log directory (required)")
+	addr := flag.String("addr", "localhost:8080", "address to listen on")
+	readOnly := flag.Bool("read-only", false, "do not open the log writer, appending entries is disabled")
+	flag.Parse()
+
+	if *dir == "" {
+		flag.Usage()
+
+		return errors.New("missing -dir flag")
+	}
+
+	l := log.New(*dir)
+
+	var writer *log.Writer
+
+	if !*readOnly {
+		var err error
+
+		writer, err = l.OpenWriter()
+		if err != nil {
+			return fmt.Errorf("opening log writer failed: %w", err)
+		}
+
+		defer writer.Close() //nolint:errcheck
+	}
+
+	handler, err := httpapi.NewHandler(l, writer)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownFinished := make(chan struct{})
+
+	go func() {
+		defer close(shutdownFinished)
+
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("serving log", "dir", *dir, "addr", *addr, "readOnly", *readOnly)
+
+	if err = server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	// wait for active requests, so they can still use the writer
+	<-shutdownFinished
+
+	return nil
+}
@@ -0,0 +1,214 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/elgopher/logstore/log"
+)
+
+func cat(_ context.Context, args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("cat", stderr)
+	from := fs.String("from", "", "print entries written at or after given time (RFC 3339)")
+	to := fs.String("to", "", "print entries written before given time (RFC 3339)")
+	format := fs.String("format", "raw", "entry data format: raw, hex, json or base64")
+
+	dir, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	fromTime, err := parseTime(*from)
+	if err != nil {
+		return err
+	}
+
+	toTime, err := parseTime(*to)
+	if err != nil {
+		return err
+	}
+
+	printer, err := newEntryPrinter(stdout, *format)
+	if err != nil {
+		return err
+	}
+
+	reader, err := log.New(dir).OpenReader(log.StartingFrom(fromTime))
+	if err != nil {
+		return err
+	}
+	defer reader.Close() //nolint:errcheck
+
+	return forEachEntry(reader, stderr, func(t time.Time, data []byte) (bool, error) {
+		if !toTime.IsZero() && !t.Before(toTime) {
+			return false, nil
+		}
+
+		return true, printer.print(t, data)
+	})
+}
+
+func tail(ctx context.Context, args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("tail", stderr)
+	n := fs.Int("n", 10, "number of last entries to print")
+	follow := fs.Bool("f", false, "wait for new entries and print them")
+	format := fs.String("format", "raw", "entry data format: raw, hex, json or base64")
+	pollInterval := fs.Duration("poll-interval", 100*time.Millisecond, "how often new entries are checked with -f")
+
+	dir, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if *n < 0 {
+		return errors.New("-n must not be negative")
+	}
+
+	printer, err := newEntryPrinter(stdout, *format)
+	if err != nil {
+		return err
+	}
+
+	l := log.New(dir)
+
+	lastEntries, err := readLastEntries(l, *n, stderr)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range lastEntries {
+		if err = printer.print(e.time, e.data); err != nil {
+			return err
+		}
+	}
+
+	if !*follow {
+		return nil
+	}
+
+	// follow entries written after the last printed one, so no entry is lost in between
+	lastTime, err := lastPrintedTime(l, lastEntries)
+	if err != nil {
+		return err
+	}
+
+	options := []log.OpenReaderOption{log.PollInterval(*pollInterval)}
+	if !lastTime.IsZero() {
+		options = append(options, log.StartingFrom(lastTime.Add(time.Nanosecond)))
+	}
+
+	reader, err := l.OpenTailReader(ctx, options...)
+	if err != nil {
+		return err
+	}
+	defer reader.Close() //nolint:errcheck
+
+	err = forEachEntry(reader, stderr, func(t time.Time, data []byte) (bool, error) {
+		return true, printer.print(t, data)
+	})
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return err
+}
+
+func lastPrintedTime(l *log.Log, lastEntries []entry) (time.Time, error) {
+	if len(lastEntries) > 0 {
+		return lastEntries[len(lastEntries)-1].time, nil
+	}
+
+	// nothing was printed because of -n 0, or log is empty
+	lastTime, _, err := l.LastEntry()
+	if errors.Is(err, log.ErrEOL) {
+		return time.Time{}, nil
+	}
+
+	return lastTime, err
+}
+
+type entry struct {
+	time time.Time
+	data []byte
+}
+
+// readLastEntries reads the whole log, because entries can only be read from the oldest to the newest.
+func readLastEntries(l *log.Log, n int, stderr io.Writer) ([]entry, error) {
+	if n == 0 {
+		return nil, nil
+	}
+
+	reader, err := l.OpenReader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close() //nolint:errcheck
+
+	var entries []entry
+
+	err = forEachEntry(reader, stderr, func(t time.Time, data []byte) (bool, error) {
+		if len(entries) == n {
+			entries = entries[1:]
+		}
+
+		entries = append(entries, entry{time: t, data: data})
+
+		return true, nil
+	})
+
+	return entries, err
+}
+
+func last(_ context.Context, args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("last", stderr)
+	format := fs.String("format", "raw", "entry data format: raw, hex, json or base64")
+
+	dir, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	printer, err := newEntryPrinter(stdout, *format)
+	if err != nil {
+		return err
+	}
+
+	t, data, err := log.New(dir).LastEntry()
+	if err != nil {
+		return err
+	}
+
+	return printer.print(t, data)
+}
+
+// forEachEntry reads entries until ErrEOL or f returns false. Entries from segments removed while reading
+// are skipped.
+func forEachEntry(reader log.Reader, stderr io.Writer, f func(t time.Time, data []byte) (bool, error)) error {
+	for {
+		t, data, err := reader.Read()
+		if errors.Is(err, log.ErrEOL) {
+			return nil
+		}
+
+		if errors.Is(err, log.ErrSegmentCompacted) {
+			_, _ = fmt.Fprintln(stderr, "warning:", err)
+
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		more, err := f(t, data)
+		if err != nil || !more {
+			return err
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elgopher/logstore/compacter"
+	"github.com/elgopher/logstore/log"
+)
+
+func compact(_ context.Context, args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("compact", stderr)
+	retention := fs.String("retention", "7d", "remove segments older than given duration, for example 7d or 12h")
+	maxSize := fs.String("max-size", "", "remove the oldest segments until the log is not bigger than given size, for example 50G")
+	maxSegments := fs.Int("max-segments", 0, "remove the oldest segments until there are no more than given number of segments")
+	dryRun := fs.Bool("dry-run", false, "print what would be removed, without removing anything")
+
+	dir, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	retentionDuration, err := parseRetention(*retention)
+	if err != nil {
+		return err
+	}
+
+	var policies []compacter.Policy
+
+	if *maxSize != "" {
+		bytes, err := parseSize(*maxSize)
+		if err != nil {
+			return err
+		}
+
+		maxTotalSize, err := compacter.MaxTotalSize(bytes)
+		if err != nil {
+			return err
+		}
+
+		policies = append(policies, maxTotalSize)
+	}
+
+	if *maxSegments < 0 {
+		return errors.New("-max-segments must not be negative")
+	}
+
+	if *maxSegments > 0 {
+		maxSegmentsPolicy, err := compacter.MaxSegments(*maxSegments)
+		if err != nil {
+			return err
+		}
+
+		policies = append(policies, maxSegmentsPolicy)
+	}
+
+	l := log.New(dir)
+
+	if *dryRun {
+		plan, err := compacter.Plan(l, compacter.Retention(retentionDuration), compacter.Policies(policies...))
+		if err != nil {
+			return err
+		}
+
+		for _, action := range plan.Actions {
+			_, _ = fmt.Fprintf(stdout, "would %s segment %s (%s): %s\n", action.Action,
+				action.Segment.StartingAt.Format(timeFormat), formatBytes(action.Segment.SizeBytes), action.Reason)
+		}
+
+		_, _ = fmt.Fprintf(stdout, "would free %s\n", formatBytes(plan.BytesReclaimed))
+
+		return nil
+	}
+
+	policies = append([]compacter.Policy{compacter.MaxAge(retentionDuration)}, policies...)
+
+	results, err := compacter.RemoveSegments(l, time.Now(), policies...)
+	for _, segment := range results.SegmentsRemoved {
+		_, _ = fmt.Fprintf(stdout, "removed segment %s (%s)\n",
+			segment.StartingAt.Format(timeFormat), formatBytes(segment.SizeBytes))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(stdout, "freed %s\n", formatBytes(results.BytesFreed))
+
+	return nil
+}
+
+// parseRetention parses duration using time.ParseDuration, additionally accepting days, for example "7d".
+func parseRetention(s string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(s, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid retention %q", s)
+		}
+
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid retention %q", s)
+	}
+
+	return d, nil
+}
+
+// parseSize parses size in bytes with optional K, M, G or T suffix (powers of 1024).
+func parseSize(s string) (int64, error) {
+	multipliers := map[string]int64{
+		"K": 1 << 10,
+		"M": 1 << 20,
+		"G": 1 << 30,
+		"T": 1 << 40,
+	}
+
+	number := strings.TrimSuffix(strings.ToUpper(s), "B")
+	multiplier := int64(1)
+
+	if len(number) > 0 {
+		if m, ok := multipliers[number[len(number)-1:]]; ok {
+			multiplier = m
+			number = number[:len(number)-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	return n * multiplier, nil
+}
+
+func verify(_ context.Context, args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("verify", stderr)
+
+	dir, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	report, err := log.New(dir).Verify()
+	if err != nil {
+		return err
+	}
+
+	for _, problem := range report.Problems {
+		_, _ = fmt.Fprintln(stdout, problem)
+	}
+
+	_, _ = fmt.Fprintf(stdout, "checked %d segments and %d entries, found %d problems\n",
+		report.SegmentsChecked, report.EntriesChecked, len(report.Problems))
+
+	if !report.OK() {
+		return errors.New("log is not valid")
+	}
+
+	return nil
+}
+
+func repair(_ context.Context, args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("repair", stderr)
+
+	dir, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	report, err := log.New(dir).Repair()
+
+	for _, segment := range report.TruncatedSegments {
+		_, _ = fmt.Fprintf(stdout, "truncated torn tail of segment %s\n", segment.StartingAt.Format(timeFormat))
+	}
+
+	for _, segment := range report.QuarantinedSegments {
+		_, _ = fmt.Fprintf(stdout, "moved corrupt segment %s to %s directory\n",
+			segment.StartingAt.Format(timeFormat), log.QuarantineDir)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	repaired := len(report.TruncatedSegments) + len(report.QuarantinedSegments)
+	if remaining := len(report.Verify.Problems) - repaired; remaining > 0 {
+		_, _ = fmt.Fprintf(stdout, "%d problems cannot be repaired, run verify for details\n", remaining)
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/elgopher/logstore/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompact(t *testing.T) {
+	t.Run("should only print plan in dry run mode", func(t *testing.T) {
+		dir := writeEntries(t, "a", "b", "c")
+		// when
+		code, stdout, stderr := runCommand(t, "compact", "--max-segments", "1", "--dry-run", dir)
+		// then
+		require.Equal(t, 0, code, stderr)
+		assert.Contains(t, stdout, "would remove segment 2005-02-04T20:01:37.000000000Z")
+		assert.Len(t, segmentsOf(t, dir), 3)
+	})
+
+	t.Run("should remove segments", func(t *testing.T) {
+		dir := writeEntries(t, "a", "b", "c")
+		// when
+		code, stdout, stderr := runCommand(t, "compact", "--max-segments", "1", dir)
+		// then
+		require.Equal(t, 0, code, stderr)
+		assert.Contains(t, stdout, "removed segment 2005-02-04T20:01:37.000000000Z")
+		assert.Len(t, segmentsOf(t, dir), 1)
+	})
+
+	t.Run("should remove segments older than retention", func(t *testing.T) {
+		dir := writeEntries(t, "a", "b", "c")
+		// when
+		code, _, stderr := runCommand(t, "compact", "--retention", "7d", dir)
+		// then
+		require.Equal(t, 0, code, stderr)
+		assert.Len(t, segmentsOf(t, dir), 1)
+	})
+
+	t.Run("should return error for invalid flags", func(t *testing.T) {
+		dir := writeEntries(t, "a")
+		for _, flags := range [][]string{{"--retention", "x"}, {"--max-size", "10X"}, {"--max-segments", "-1"}} {
+			code, _, _ := runCommand(t, append(append([]string{"compact"}, flags...), dir)...)
+			assert.Equal(t, 1, code, flags)
+		}
+	})
+}
+
+func TestParseRetention(t *testing.T) {
+	tests := map[string]time.Duration{
+		"7d":  7 * 24 * time.Hour,
+		"12h": 12 * time.Hour,
+		"0d":  0,
+	}
+
+	for s, expected := range tests {
+		t.Run(s, func(t *testing.T) {
+			actual, err := parseRetention(s)
+			require.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"100":  100,
+		"50G":  50 << 30,
+		"10MB": 10 << 20,
+		"1k":   1 << 10,
+		"2T":   2 << 40,
+	}
+
+	for s, expected := range tests {
+		t.Run(s, func(t *testing.T) {
+			actual, err := parseSize(s)
+			require.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	t.Run("should succeed for valid log", func(t *testing.T) {
+		dir := writeEntries(t, "a", "b")
+		code, stdout, _ := runCommand(t, "verify", dir)
+		assert.Equal(t, 0, code)
+		assert.Contains(t, stdout, "found 0 problems")
+	})
+
+	t.Run("should fail for log with torn tail", func(t *testing.T) {
+		dir := writeEntries(t, "a", "b")
+		appendToLastSegment(t, dir, []byte{1, 2})
+		code, stdout, _ := runCommand(t, "verify", dir)
+		assert.Equal(t, 1, code)
+		assert.Contains(t, stdout, string(log.ProblemTornTail))
+	})
+}
+
+func TestRepair(t *testing.T) {
+	t.Run("should truncate torn tail", func(t *testing.T) {
+		dir := writeEntries(t, "a", "b")
+		appendToLastSegment(t, dir, []byte{1, 2})
+		// when
+		code, stdout, stderr := runCommand(t, "repair", dir)
+		// then
+		require.Equal(t, 0, code, stderr)
+		assert.Contains(t, stdout, "truncated torn tail")
+		code, _, _ = runCommand(t, "verify", dir)
+		assert.Equal(t, 0, code)
+	})
+
+	t.Run("should fail when log is locked", func(t *testing.T) {
+		dir := writeEntries(t, "a")
+		writer, err := log.New(dir).OpenWriter()
+		require.NoError(t, err)
+		defer writer.Close() //nolint:errcheck
+		// when
+		code, _, stderr := runCommand(t, "repair", dir)
+		// then
+		assert.Equal(t, 1, code)
+		assert.Contains(t, stderr, log.ErrLocked.Error())
+	})
+}
+
+func segmentsOf(t *testing.T, dir string) []log.Segment {
+	t.Helper()
+
+	segments, err := log.New(dir).Segments()
+	require.NoError(t, err)
+
+	return segments
+}
+
+func appendToLastSegment(t *testing.T, dir string, data []byte) {
+	t.Helper()
+
+	segments := segmentsOf(t, dir)
+	filename := segments[len(segments)-1].StartingAt.Format("2006-01-02T15_04_05.000000000Z") + ".segment"
+
+	f, err := os.OpenFile(path.Join(dir, filename), os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
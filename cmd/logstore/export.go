@@ -0,0 +1,157 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/elgopher/logstore/log"
+)
+
+func export(_ context.Context, args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("export", stderr)
+	format := fs.String("format", string(log.FormatNDJSON), "output format: ndjson, ndjson-inline or binary")
+	from := fs.String("from", "", "export entries written at or after given time (RFC 3339)")
+	to := fs.String("to", "", "export entries written before given time (RFC 3339)")
+	output := fs.String("output", "", "output file (default stdout)")
+
+	dir, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	fromTime, err := parseTime(*from)
+	if err != nil {
+		return err
+	}
+
+	toTime, err := parseTime(*to)
+	if err != nil {
+		return err
+	}
+
+	reader, err := log.New(dir).OpenReader(log.StartingFrom(fromTime))
+	if err != nil {
+		return err
+	}
+	defer reader.Close() //nolint:errcheck
+
+	w := stdout
+
+	var file *os.File
+
+	if *output != "" {
+		if file, err = os.Create(*output); err != nil {
+			return err
+		}
+
+		w = file
+	}
+
+	count, err := log.Export(readerBefore(reader, toTime), w, log.ExportFormat(*format))
+
+	if file != nil {
+		// closing the file might fail when data was not written, so export would not be complete
+		if closeErr := file.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("closing output file failed: %w", closeErr)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(stderr, "exported %d entries\n", count)
+
+	return nil
+}
+
+func importEntries(_ context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("import", stderr)
+	input := fs.String("input", "", "input file (default stdin)")
+
+	dir, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	r := stdin
+
+	if *input != "" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer file.Close() //nolint:errcheck
+
+		r = file
+	}
+
+	writer, err := log.New(dir).OpenWriter()
+	if err != nil {
+		return err
+	}
+
+	count, err := log.Import(r, writer)
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+
+	_, _ = fmt.Fprintf(stdout, "imported %d entries\n", count)
+
+	return err
+}
+
+// readerBefore returns a reader which returns log.ErrEOL once entry written at or after t is read.
+// Zero t means no limit. Returned reader implements log.StreamEntryReader when given reader does, so streams
+// and versions are still exported.
+func readerBefore(reader log.Reader, t time.Time) log.Reader {
+	if t.IsZero() {
+		return reader
+	}
+
+	if streamReader, ok := reader.(log.StreamEntryReader); ok {
+		return &limitedStreamReader{StreamEntryReader: streamReader, before: t}
+	}
+
+	return &limitedReader{Reader: reader, before: t}
+}
+
+type limitedReader struct {
+	log.Reader
+	before time.Time
+}
+
+func (r *limitedReader) Read() (time.Time, []byte, error) {
+	t, data, err := r.Reader.Read()
+	if err == nil && !t.Before(r.before) {
+		return time.Time{}, nil, log.ErrEOL
+	}
+
+	return t, data, err
+}
+
+type limitedStreamReader struct {
+	log.StreamEntryReader
+	before time.Time
+}
+
+func (r *limitedStreamReader) Read() (time.Time, []byte, error) {
+	t, _, _, data, err := r.ReadStreamEntry()
+
+	return t, data, err
+}
+
+func (r *limitedStreamReader) ReadStreamEntry() (time.Time, string, uint64, []byte, error) {
+	t, stream, version, data, err := r.StreamEntryReader.ReadStreamEntry()
+	if err == nil && !t.Before(r.before) {
+		return time.Time{}, "", 0, nil, log.ErrEOL
+	}
+
+	return t, stream, version, data, err
+}
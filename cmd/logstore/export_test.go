@@ -0,0 +1,85 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package main
+
+import (
+	"path"
+	"testing"
+
+	"github.com/elgopher/logstore/internal/tests"
+	"github.com/elgopher/logstore/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport(t *testing.T) {
+	t.Run("should export entries to stdout", func(t *testing.T) {
+		dir := writeEntries(t, "a", "b")
+		// when
+		code, stdout, stderr := runCommand(t, "export", dir)
+		// then
+		require.Equal(t, 0, code, stderr)
+		expected := `{"time":"2005-02-04T20:01:37Z","data":"YQ=="}` + "\n" +
+			`{"time":"2006-01-02T15:04:05Z","data":"Yg=="}` + "\n"
+		assert.Equal(t, expected, stdout)
+		assert.Contains(t, stderr, "exported 2 entries")
+	})
+
+	t.Run("should export entries from time range", func(t *testing.T) {
+		dir := writeEntries(t, "a", "b", "c")
+		// when
+		code, stdout, stderr := runCommand(t, "export",
+			"--from", "2006-01-02T15:04:05Z", "--to", "2007-01-02T15:04:05Z", dir)
+		// then
+		require.Equal(t, 0, code, stderr)
+		assert.Equal(t, `{"time":"2006-01-02T15:04:05Z","data":"Yg=="}`+"\n", stdout)
+	})
+
+	t.Run("should export stream entries from time range", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		require.NoError(t, writer.WriteToStreamWithTime(time2005, "order-1", 1, []byte("a")))
+		require.NoError(t, writer.WriteToStreamWithTime(time2007, "order-1", 2, []byte("b")))
+		require.NoError(t, writer.Close())
+		// when
+		code, stdout, stderr := runCommand(t, "export", "--to", "2006-01-02T15:04:05Z", l.Dir())
+		// then
+		require.Equal(t, 0, code, stderr)
+		expected := `{"time":"2005-02-04T20:01:37Z","stream":"order-1","version":1,"data":"YQ=="}` + "\n"
+		assert.Equal(t, expected, stdout)
+	})
+
+	t.Run("should return error for unsupported format", func(t *testing.T) {
+		dir := writeEntries(t, "a")
+		code, _, _ := runCommand(t, "export", "--format", "xml", dir)
+		assert.Equal(t, 1, code)
+	})
+}
+
+func TestImport(t *testing.T) {
+	t.Run("should import exported file", func(t *testing.T) {
+		src := writeEntries(t, "a", "b", "c")
+		file := path.Join(tests.TempDir(t), "export")
+		code, _, stderr := runCommand(t, "export", "--format", "binary", "--output", file, src)
+		require.Equal(t, 0, code, stderr)
+		dst := tests.TempDir(t)
+		// when
+		code, stdout, stderr := runCommand(t, "import", "--input", file, dst)
+		// then
+		require.Equal(t, 0, code, stderr)
+		assert.Contains(t, stdout, "imported 3 entries")
+		assert.Equal(t, tests.ReadAll(t, log.New(src)), tests.ReadAll(t, log.New(dst)))
+	})
+	t.Run("should import entries from stdin", func(t *testing.T) {
+		src := writeEntries(t, "a", "b")
+		code, exported, stderr := runCommand(t, "export", src)
+		require.Equal(t, 0, code, stderr)
+		dst := tests.TempDir(t)
+		// when
+		code, stdout, stderr := runCommandWithInput(t, exported, "import", dst)
+		// then
+		require.Equal(t, 0, code, stderr)
+		assert.Contains(t, stdout, "imported 2 entries")
+		assert.Equal(t, tests.ReadAll(t, log.New(src)), tests.ReadAll(t, log.New(dst)))
+	})
+}
@@ -0,0 +1,86 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/elgopher/logstore/codec"
+)
+
+const timeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+// entryPrinter prints entry time followed by entry data formatted according to the chosen format.
+type entryPrinter struct {
+	w          io.Writer
+	formatData func([]byte) (string, error)
+}
+
+func newEntryPrinter(w io.Writer, format string) (*entryPrinter, error) {
+	var formatData func([]byte) (string, error)
+
+	switch format {
+	case "raw":
+		formatData = func(data []byte) (string, error) {
+			return string(data), nil
+		}
+	case "hex":
+		formatData = func(data []byte) (string, error) {
+			return hex.EncodeToString(data), nil
+		}
+	case "base64":
+		formatData = func(data []byte) (string, error) {
+			return base64.StdEncoding.EncodeToString(data), nil
+		}
+	case "json":
+		formatData = formatJSON
+	default:
+		return nil, fmt.Errorf("unsupported format %q, must be one of raw, hex, json, base64", format)
+	}
+
+	return &entryPrinter{w: w, formatData: formatData}, nil
+}
+
+func formatJSON(data []byte) (string, error) {
+	var value interface{}
+	if err := codec.JSON().Decode(data, &value); err != nil {
+		return "", err
+	}
+
+	formatted, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	return string(formatted), nil
+}
+
+func (p *entryPrinter) print(t time.Time, data []byte) error {
+	formatted, err := p.formatData(data)
+	if err != nil {
+		return fmt.Errorf("formatting entry %s failed: %w", t.Format(timeFormat), err)
+	}
+
+	_, err = fmt.Fprintf(p.w, "%s %s\n", t.Format(timeFormat), formatted)
+
+	return err
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, must be in RFC 3339 format", s)
+	}
+
+	return t, nil
+}
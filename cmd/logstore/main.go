@@ -0,0 +1,132 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+// Command logstore inspects and maintains log directories. Inspecting commands use only readers, therefore they never
+// take the writer lock and can be used while the log is being written by another process.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+)
+
+const usage = `Usage: logstore <command> [flags] <log directory>
+
+Commands:
+`
+
+type command struct {
+	description string
+	run         func(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error
+}
+
+var commands = map[string]command{
+	"segments": {description: "list segments with sizes and time spans", run: segments},
+	"cat":      {description: "print entries", run: cat},
+	"tail":     {description: "print the last entries, optionally following new ones", run: tail},
+	"last":     {description: "print the last entry", run: last},
+	"stats":    {description: "print log statistics", run: stats},
+	"compact":  {description: "remove old segments", run: compact},
+	"verify":   {description: "check integrity of the log", run: verify},
+	"repair":   {description: "truncate torn tails and quarantine corrupt segments (locks the log)", run: repair},
+	"export":   {description: "export entries as NDJSON or binary stream", run: export},
+	"import":   {description: "import entries exported by export command (locks the log)", run: importEntries},
+}
+
+// errUsage is returned when command was used incorrectly. Usage is already printed by the flag package.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		printUsage(stderr)
+
+		return 2
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		_, _ = fmt.Fprintf(stderr, "unknown command %q\n", args[0])
+		printUsage(stderr)
+
+		return 2
+	}
+
+	err := cmd.run(ctx, args[1:], stdin, stdout, stderr)
+	if errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp) {
+		return 2
+	}
+
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, "logstore:", err)
+
+		return 1
+	}
+
+	return 0
+}
+
+func printUsage(w io.Writer) {
+	_, _ = fmt.Fprint(w, usage)
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		_, _ = fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].description)
+	}
+}
+
+// newFlagSet creates a flag set for the command, which requires exactly one positional argument - log directory.
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(stderr, "Usage: logstore %s [flags] <log directory>\n", name)
+		fs.PrintDefaults()
+	}
+
+	return fs
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) (dir string, err error) {
+	if err = fs.Parse(args); err != nil {
+		return "", err
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+
+		return "", errUsage
+	}
+
+	dir = fs.Arg(0)
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", dir)
+	}
+
+	return dir, nil
+}
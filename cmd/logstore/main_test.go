@@ -0,0 +1,264 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elgopher/logstore/internal/tests"
+	"github.com/elgopher/logstore/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	time2005 = tests.MustTime("2005-02-04T20:01:37Z")
+	time2006 = tests.MustTime("2006-01-02T15:04:05Z")
+	time2007 = tests.MustTime("2007-01-02T15:04:05Z")
+)
+
+func TestRun(t *testing.T) {
+	t.Run("should print usage when command is missing", func(t *testing.T) {
+		code, _, stderr := runCommand(t)
+		assert.Equal(t, 2, code)
+		assert.Contains(t, stderr, "Usage")
+	})
+
+	t.Run("should return error for unknown command", func(t *testing.T) {
+		code, _, stderr := runCommand(t, "unknown")
+		assert.Equal(t, 2, code)
+		assert.Contains(t, stderr, "unknown command")
+	})
+
+	t.Run("should return error when directory is missing", func(t *testing.T) {
+		code, _, _ := runCommand(t, "cat")
+		assert.Equal(t, 2, code)
+	})
+
+	t.Run("should return error when directory does not exist", func(t *testing.T) {
+		code, _, stderr := runCommand(t, "cat", "/not/existing/dir")
+		assert.Equal(t, 1, code)
+		assert.NotEmpty(t, stderr)
+	})
+}
+
+func TestSegments(t *testing.T) {
+	t.Run("should list segments", func(t *testing.T) {
+		dir := writeEntries(t, `"a"`, `"b"`, `"c"`)
+		// when
+		code, stdout, _ := runCommand(t, "segments", dir)
+		// then
+		require.Equal(t, 0, code)
+		lines := strings.Split(strings.TrimSpace(stdout), "\n")
+		assert.Len(t, lines, 4) // header + 3 segments
+		assert.Contains(t, lines[1], "2005-02-04T20:01:37.000000000Z")
+		assert.Contains(t, lines[3], "(active)")
+	})
+}
+
+func TestCat(t *testing.T) {
+	t.Run("should print all entries", func(t *testing.T) {
+		dir := writeEntries(t, `"a"`, `"b"`)
+		// when
+		code, stdout, _ := runCommand(t, "cat", dir)
+		// then
+		require.Equal(t, 0, code)
+		expected := "2005-02-04T20:01:37.000000000Z \"a\"\n" +
+			"2006-01-02T15:04:05.000000000Z \"b\"\n"
+		assert.Equal(t, expected, stdout)
+	})
+
+	t.Run("should print entries from time range", func(t *testing.T) {
+		dir := writeEntries(t, `"a"`, `"b"`, `"c"`)
+		// when
+		code, stdout, _ := runCommand(t, "cat",
+			"--from", "2006-01-02T15:04:05Z", "--to", "2007-01-02T15:04:05Z", dir)
+		// then
+		require.Equal(t, 0, code)
+		assert.Equal(t, "2006-01-02T15:04:05.000000000Z \"b\"\n", stdout)
+	})
+
+	t.Run("should print entries in given format", func(t *testing.T) {
+		dir := writeEntries(t, `{"b":1, "a":2}`)
+		formats := map[string]string{
+			"hex":    "7b2262223a312c202261223a327d",
+			"base64": "eyJiIjoxLCAiYSI6Mn0=",
+			"json":   `{"a":2,"b":1}`,
+		}
+
+		for format, expected := range formats {
+			t.Run(format, func(t *testing.T) {
+				code, stdout, _ := runCommand(t, "cat", "--format", format, dir)
+				require.Equal(t, 0, code)
+				assert.Equal(t, "2005-02-04T20:01:37.000000000Z "+expected+"\n", stdout)
+			})
+		}
+	})
+
+	t.Run("should return error when entry is not JSON", func(t *testing.T) {
+		dir := writeEntries(t, "not json")
+		code, _, stderr := runCommand(t, "cat", "--format", "json", dir)
+		assert.Equal(t, 1, code)
+		assert.Contains(t, stderr, "formatting entry")
+	})
+
+	t.Run("should return error for unsupported format", func(t *testing.T) {
+		dir := writeEntries(t, "a")
+		code, _, _ := runCommand(t, "cat", "--format", "xml", dir)
+		assert.Equal(t, 1, code)
+	})
+}
+
+func TestTail(t *testing.T) {
+	t.Run("should print last entries", func(t *testing.T) {
+		dir := writeEntries(t, "a", "b", "c")
+		// when
+		code, stdout, _ := runCommand(t, "tail", "-n", "2", dir)
+		// then
+		require.Equal(t, 0, code)
+		expected := "2006-01-02T15:04:05.000000000Z b\n" +
+			"2007-01-02T15:04:05.000000000Z c\n"
+		assert.Equal(t, expected, stdout)
+	})
+
+	t.Run("should follow new entries until context is cancelled", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		require.NoError(t, writer.WriteWithTime(time2005, []byte("a")))
+		ctx, cancel := context.WithCancel(context.Background())
+		stdout := &synchronizedBuffer{}
+		async := tests.RunAsync(func() {
+			code := run(ctx, []string{"tail", "-f", "--poll-interval", "1ms", l.Dir()}, strings.NewReader(""), stdout, &bytes.Buffer{})
+			assert.Equal(t, 0, code)
+		})
+		// when
+		require.NoError(t, writer.WriteWithTime(time2006, []byte("b")))
+		// then
+		expected := "2005-02-04T20:01:37.000000000Z a\n" +
+			"2006-01-02T15:04:05.000000000Z b\n"
+		assert.Eventually(t, func() bool {
+			return stdout.String() == expected
+		}, 5*time.Second, time.Millisecond)
+		cancel()
+		async.WaitOrFailAfter(t, 5*time.Second)
+	})
+
+	t.Run("should follow only new entries when no entries are printed", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		require.NoError(t, writer.WriteWithTime(time2005, []byte("a")))
+		ctx, cancel := context.WithCancel(context.Background())
+		stdout := &synchronizedBuffer{}
+		async := tests.RunAsync(func() {
+			code := run(ctx, []string{"tail", "-n", "0", "-f", "--poll-interval", "1ms", l.Dir()}, strings.NewReader(""), stdout, &bytes.Buffer{})
+			assert.Equal(t, 0, code)
+		})
+		// when
+		assert.Eventually(t, func() bool {
+			_, err := writer.Write([]byte("b"))
+			require.NoError(t, err)
+
+			return stdout.String() != ""
+		}, 5*time.Second, time.Millisecond)
+		// then
+		cancel()
+		async.WaitOrFailAfter(t, 5*time.Second)
+		assert.NotContains(t, stdout.String(), " a\n")
+		assert.Contains(t, stdout.String(), " b\n")
+	})
+}
+
+func TestLast(t *testing.T) {
+	t.Run("should print the last entry", func(t *testing.T) {
+		dir := writeEntries(t, "a", "b")
+		code, stdout, _ := runCommand(t, "last", dir)
+		require.Equal(t, 0, code)
+		assert.Equal(t, "2006-01-02T15:04:05.000000000Z b\n", stdout)
+	})
+
+	t.Run("should return error for empty log", func(t *testing.T) {
+		code, _, _ := runCommand(t, "last", tests.TempDir(t))
+		assert.Equal(t, 1, code)
+	})
+}
+
+func TestStats(t *testing.T) {
+	t.Run("should print statistics", func(t *testing.T) {
+		dir := writeEntries(t, "a", "bb", "ccc")
+		// when
+		code, stdout, _ := runCommand(t, "stats", dir)
+		// then
+		require.Equal(t, 0, code)
+		assert.Contains(t, stdout, "segments:     3")
+		assert.Contains(t, stdout, "entries:      3")
+		assert.Contains(t, stdout, "data size:    6B")
+		assert.Contains(t, stdout, "first entry:  2005-02-04T20:01:37.000000000Z")
+		assert.Contains(t, stdout, "last entry:   2007-01-02T15:04:05.000000000Z")
+	})
+}
+
+func TestCommands_DoNotLockLog(t *testing.T) {
+	dir := writeEntries(t, "a")
+	writer, err := log.New(dir).OpenWriter()
+	require.NoError(t, err)
+	defer tests.Close(t, writer)
+
+	for _, args := range [][]string{{"segments"}, {"cat"}, {"tail"}, {"last"}, {"stats"}} {
+		code, _, stderr := runCommand(t, append(args, dir)...)
+		assert.Equal(t, 0, code, stderr)
+	}
+}
+
+func runCommand(t *testing.T, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+
+	return runCommandWithInput(t, "", args...)
+}
+
+func runCommandWithInput(t *testing.T, stdin string, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+
+	var stdoutBuffer, stderrBuffer bytes.Buffer
+	code = run(context.Background(), args, strings.NewReader(stdin), &stdoutBuffer, &stderrBuffer)
+
+	return code, stdoutBuffer.String(), stderrBuffer.String()
+}
+
+// writeEntries writes entries at time2005, time2006, time2007..., each one to a separate segment.
+func writeEntries(t *testing.T, entries ...string) string {
+	t.Helper()
+
+	l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentDuration(time.Minute))
+	times := []time.Time{time2005, time2006, time2007}
+
+	for i, entry := range entries {
+		require.NoError(t, writer.WriteWithTime(times[i], []byte(entry)))
+	}
+
+	require.NoError(t, writer.Close())
+
+	return l.Dir()
+}
+
+type synchronizedBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *synchronizedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.buffer.Write(p)
+}
+
+func (b *synchronizedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.buffer.String()
+}
@@ -0,0 +1,58 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/elgopher/logstore/log"
+)
+
+func segments(_ context.Context, args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("segments", stderr)
+
+	dir, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	l := log.New(dir)
+
+	segments, err := l.Segments()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "STARTING AT\tENDING BEFORE\tSIZE")
+
+	for i, segment := range segments {
+		end := "(active)"
+		if i+1 < len(segments) {
+			end = segments[i+1].StartingAt.Format(timeFormat)
+		}
+
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", segment.StartingAt.Format(timeFormat), end, formatBytes(segment.SizeBytes))
+	}
+
+	return w.Flush()
+}
+
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%dB", bytes)
+	}
+
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f%ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,76 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/elgopher/logstore/log"
+)
+
+func stats(_ context.Context, args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("stats", stderr)
+
+	dir, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	l := log.New(dir)
+
+	segments, err := l.Segments()
+	if err != nil {
+		return err
+	}
+
+	var totalSize int64
+	for _, segment := range segments {
+		totalSize += segment.SizeBytes
+	}
+
+	reader, err := l.OpenReader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close() //nolint:errcheck
+
+	var (
+		entries             int
+		dataSize            int64
+		firstTime, lastTime time.Time
+	)
+
+	err = forEachEntry(reader, stderr, func(t time.Time, data []byte) (bool, error) {
+		if entries == 0 {
+			firstTime = t
+		}
+
+		entries++
+		dataSize += int64(len(data))
+		lastTime = t
+
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(w, "segments:\t%d\n", len(segments))
+	_, _ = fmt.Fprintf(w, "size:\t%s\n", formatBytes(totalSize))
+	_, _ = fmt.Fprintf(w, "entries:\t%d\n", entries)
+	_, _ = fmt.Fprintf(w, "data size:\t%s\n", formatBytes(dataSize))
+
+	if entries > 0 {
+		_, _ = fmt.Fprintf(w, "first entry:\t%s\n", firstTime.Format(timeFormat))
+		_, _ = fmt.Fprintf(w, "last entry:\t%s\n", lastTime.Format(timeFormat))
+		_, _ = fmt.Fprintf(w, "time span:\t%s\n", lastTime.Sub(firstTime))
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,58 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package codec
+
+import (
+	"encoding"
+	"fmt"
+
+	"github.com/elgopher/logstore/log"
+)
+
+// Binary returns Format for objects implementing encoding.BinaryMarshaler and encoding.BinaryUnmarshaler.
+// If the object implements AppendBinary(b []byte) ([]byte, error) method, it is used instead of MarshalBinary,
+// so the object is appended to the output slice without additional allocations.
+func Binary() Format {
+	return &binaryFormat{}
+}
+
+type binaryFormat struct{}
+
+type binaryAppender interface {
+	AppendBinary(b []byte) ([]byte, error)
+}
+
+func (b *binaryFormat) Encode(input interface{}, output []byte) (out []byte, err error) {
+	switch i := input.(type) {
+	case binaryAppender:
+		out, err = i.AppendBinary(output)
+		if err != nil {
+			return nil, fmt.Errorf("appending binary failed: %w", err)
+		}
+
+		return out, nil
+	case encoding.BinaryMarshaler:
+		data, err := i.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("binary marshalling failed: %w", err)
+		}
+
+		return append(output, data...), nil
+	default:
+		return nil, fmt.Errorf("%T does not implement encoding.BinaryMarshaler: %w", input, log.ErrInvalidParameter)
+	}
+}
+
+func (b *binaryFormat) Decode(input []byte, output interface{}) error {
+	unmarshaler, ok := output.(encoding.BinaryUnmarshaler)
+	if !ok {
+		return fmt.Errorf("%T does not implement encoding.BinaryUnmarshaler: %w", output, log.ErrInvalidParameter)
+	}
+
+	if err := unmarshaler.UnmarshalBinary(input); err != nil {
+		return fmt.Errorf("binary unmarshalling failed: %w", err)
+	}
+
+	return nil
+}
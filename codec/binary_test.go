@@ -0,0 +1,164 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package codec_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/elgopher/logstore/codec"
+	"github.com/elgopher/logstore/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBinaryFormat_Encode(t *testing.T) {
+	t.Run("should marshal binary", func(t *testing.T) {
+		msg := &BinaryMessage{ID: 1}
+		// when
+		bytes, err := codec.Binary().Encode(msg, nil)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, []byte{1, 0, 0, 0}, bytes)
+	})
+
+	t.Run("should append to output", func(t *testing.T) {
+		msg := &AppendingMessage{ID: 2}
+		output := make([]byte, 1, 16)
+		// when
+		bytes, err := codec.Binary().Encode(msg, output)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0, 2, 0, 0, 0}, bytes)
+		assert.Same(t, &output[0], &bytes[0], "output slice should be reused")
+	})
+
+	t.Run("should return error when input does not implement BinaryMarshaler", func(t *testing.T) {
+		_, err := codec.Binary().Encode("string", nil)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error when marshalling failed", func(t *testing.T) {
+		_, err := codec.Binary().Encode(&BinaryMessage{ID: invalidID}, nil)
+		assert.ErrorIs(t, err, errInvalidID)
+	})
+}
+
+func TestBinaryFormat_Decode(t *testing.T) {
+	t.Run("should unmarshal binary", func(t *testing.T) {
+		msg := BinaryMessage{}
+		// when
+		err := codec.Binary().Decode([]byte{3, 0, 0, 0}, &msg)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, BinaryMessage{ID: 3}, msg)
+	})
+
+	t.Run("should return error when output does not implement BinaryUnmarshaler", func(t *testing.T) {
+		var s string
+		err := codec.Binary().Decode([]byte{1}, &s)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error when unmarshalling failed", func(t *testing.T) {
+		msg := BinaryMessage{}
+		err := codec.Binary().Decode([]byte{1}, &msg)
+		assert.ErrorIs(t, err, errInvalidLength)
+	})
+}
+
+func TestBinaryFormat_RoundTrip(t *testing.T) {
+	l := log.New(t.TempDir())
+	writer, err := l.OpenWriter()
+	require.NoError(t, err)
+	defer writer.Close() //nolint:errcheck
+	c := codec.New(codec.Binary())
+	_, err = c.Write(writer, &AppendingMessage{ID: 42})
+	require.NoError(t, err)
+	reader, err := l.OpenReader()
+	require.NoError(t, err)
+	defer reader.Close() //nolint:errcheck
+	// when
+	var msg AppendingMessage
+	_, err = c.Read(reader, &msg)
+	// then
+	require.NoError(t, err)
+	assert.Equal(t, AppendingMessage{ID: 42}, msg)
+}
+
+func BenchmarkBinaryFormat_Encode(b *testing.B) {
+	format := codec.Binary()
+	msg := &AppendingMessage{ID: 42}
+	output := make([]byte, 0, 64)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, _ = format.Encode(msg, output[:0])
+	}
+}
+
+func BenchmarkBinaryFormat_Decode(b *testing.B) {
+	format := codec.Binary()
+	input := []byte{42, 0, 0, 0}
+
+	var msg AppendingMessage
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_ = format.Decode(input, &msg)
+	}
+}
+
+const invalidID = 0xFFFFFFFF
+
+var (
+	errInvalidID     = errors.New("invalid id")
+	errInvalidLength = errors.New("invalid length")
+)
+
+type BinaryMessage struct {
+	ID uint32
+}
+
+func (m *BinaryMessage) MarshalBinary() ([]byte, error) {
+	if m.ID == invalidID {
+		return nil, errInvalidID
+	}
+
+	return binary.LittleEndian.AppendUint32(nil, m.ID), nil
+}
+
+func (m *BinaryMessage) UnmarshalBinary(data []byte) error {
+	if len(data) != 4 {
+		return errInvalidLength
+	}
+
+	m.ID = binary.LittleEndian.Uint32(data)
+
+	return nil
+}
+
+// AppendingMessage implements AppendBinary, so it can be encoded without allocations.
+type AppendingMessage struct {
+	ID uint32
+}
+
+func (m *AppendingMessage) AppendBinary(b []byte) ([]byte, error) {
+	return binary.LittleEndian.AppendUint32(b, m.ID), nil
+}
+
+func (m *AppendingMessage) UnmarshalBinary(data []byte) error {
+	if len(data) != 4 {
+		return errInvalidLength
+	}
+
+	m.ID = binary.LittleEndian.Uint32(data)
+
+	return nil
+}
@@ -59,6 +59,27 @@ func (c *Codec) encode(object interface{}) ([]byte, error) {
 	return data, nil
 }
 
+// appendEncoded encodes input and appends it to out. It supports formats which do not append to the output slice.
+func appendEncoded(format Format, input interface{}, out []byte) ([]byte, error) {
+	rest := out[len(out):]
+
+	encoded, err := format.Encode(input, rest)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(encoded) == 0 {
+		return out, nil
+	}
+
+	if cap(rest) > 0 && &rest[:1][0] == &encoded[0] {
+		// format appended in place
+		return out[:len(out)+len(encoded)], nil
+	}
+
+	return append(out, encoded...), nil
+}
+
 func (c *Codec) WriteWithTime(writer WriterWithTime, t time.Time, object interface{}) error {
 	if writer == nil {
 		return fmt.Errorf("nil writer: %w", log.ErrInvalidParameter)
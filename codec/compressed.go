@@ -0,0 +1,339 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package codec
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/elgopher/logstore/log"
+)
+
+// Compression is a compression algorithm used by Compressed format.
+type Compression byte
+
+const (
+	Gzip  Compression = 1
+	Flate Compression = 2
+	Zlib  Compression = 3
+)
+
+func (c Compression) String() string {
+	switch c {
+	case Gzip:
+		return "gzip"
+	case Flate:
+		return "flate"
+	case Zlib:
+		return "zlib"
+	default:
+		return fmt.Sprintf("Compression(%d)", byte(c))
+	}
+}
+
+// DefaultMaxDecompressedSize is the default limit of decompressed payload size. See MaxDecompressedSize.
+const DefaultMaxDecompressedSize = 64 * 1024 * 1024
+
+// ErrDecompressedSizeExceeded is returned by Compressed format when decompressed payload is larger than
+// the limit set by MaxDecompressedSize.
+var ErrDecompressedSizeExceeded = errors.New("decompressed payload size exceeded")
+
+const (
+	notCompressed byte = 0
+	// dictionaryFlag is set in the flag byte when payload was compressed using dictionary
+	dictionaryFlag byte = 0x80
+)
+
+type CompressionOption func(*CompressionSettings) error
+
+type CompressionSettings struct {
+	level               int
+	dictionary          []byte
+	maxDecompressedSize int
+}
+
+// CompressionLevel sets compression level, for example flate.BestSpeed or flate.BestCompression.
+// Default is flate.DefaultCompression.
+func CompressionLevel(level int) CompressionOption {
+	return func(s *CompressionSettings) error {
+		if level < flate.HuffmanOnly || level > flate.BestCompression {
+			return fmt.Errorf("invalid compression level %d: %w", level, log.ErrInvalidParameter)
+		}
+
+		s.level = level
+
+		return nil
+	}
+}
+
+// Dictionary sets preset dictionary used to compress and decompress payloads. Dictionary should contain byte
+// sequences common for many entries. It improves compression of small payloads, especially when used with
+// flate.BestCompression level (lower levels may ignore the dictionary for tiny payloads). Only Flate and Zlib support
+// dictionaries. Entries compressed with dictionary can only be decoded by Format using the same dictionary.
+func Dictionary(dictionary []byte) CompressionOption {
+	return func(s *CompressionSettings) error {
+		if len(dictionary) == 0 {
+			return fmt.Errorf("empty dictionary: %w", log.ErrInvalidParameter)
+		}
+
+		s.dictionary = dictionary
+
+		return nil
+	}
+}
+
+// MaxDecompressedSize limits the size of decompressed payload, protecting the decoder from decompression bombs.
+// Payloads larger than the limit are never compressed by Encode. Default is DefaultMaxDecompressedSize.
+func MaxDecompressedSize(bytes int) CompressionOption {
+	return func(s *CompressionSettings) error {
+		if bytes <= 0 {
+			return fmt.Errorf("max decompressed size must be positive: %w", log.ErrInvalidParameter)
+		}
+
+		s.maxDecompressedSize = bytes
+
+		return nil
+	}
+}
+
+// Compressed returns Format compressing payloads encoded by inner Format. Payloads smaller than minSize bytes,
+// and payloads which do not get smaller after compression, are stored uncompressed. Each entry starts with a flag
+// byte describing the compression, therefore entries compressed with any algorithm (or not compressed at all)
+// can be decoded regardless of the algorithm passed to Compressed.
+//
+// Compressed returns error when algorithm, level, dictionary or max decompressed size is not valid.
+func Compressed(inner Format, algorithm Compression, minSize int, options ...CompressionOption) (Format, error) {
+	if inner == nil {
+		return nil, fmt.Errorf("nil inner format: %w", log.ErrInvalidParameter)
+	}
+
+	settings := &CompressionSettings{
+		level:               flate.DefaultCompression,
+		maxDecompressedSize: DefaultMaxDecompressedSize,
+	}
+
+	for _, applyOption := range options {
+		if applyOption == nil {
+			continue
+		}
+
+		if err := applyOption(settings); err != nil {
+			return nil, fmt.Errorf("error applying option: %w", err)
+		}
+	}
+
+	f := &compressedFormat{
+		inner:               inner,
+		algorithm:           algorithm,
+		minSize:             minSize,
+		level:               settings.level,
+		dictionary:          settings.dictionary,
+		maxDecompressedSize: settings.maxDecompressedSize,
+	}
+
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+
+	f.writers.New = func() interface{} {
+		w, _ := f.newWriter(io.Discard) // settings are already validated
+
+		return w
+	}
+
+	return f, nil
+}
+
+type compressedFormat struct {
+	inner               Format
+	algorithm           Compression
+	minSize             int
+	level               int
+	dictionary          []byte
+	maxDecompressedSize int
+	writers             sync.Pool // compressor
+	buffers             sync.Pool // *bytes.Buffer
+	readers             [4]sync.Pool
+}
+
+type compressor interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+func (f *compressedFormat) validate() error {
+	if f.algorithm != Gzip && f.algorithm != Flate && f.algorithm != Zlib {
+		return fmt.Errorf("unsupported compression %s: %w", f.algorithm, log.ErrInvalidParameter)
+	}
+
+	if f.dictionary != nil && f.algorithm == Gzip {
+		return fmt.Errorf("gzip does not support dictionary: %w", log.ErrInvalidParameter)
+	}
+
+	_, err := f.newWriter(io.Discard)
+
+	return err
+}
+
+func (f *compressedFormat) newWriter(w io.Writer) (compressor, error) {
+	var (
+		c   compressor
+		err error
+	)
+
+	switch f.algorithm {
+	case Gzip:
+		c, err = gzip.NewWriterLevel(w, f.level)
+	case Flate:
+		c, err = flate.NewWriterDict(w, f.level, f.dictionary)
+	case Zlib:
+		c, err = zlib.NewWriterLevelDict(w, f.level, f.dictionary)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("creating %s writer failed: %v: %w", f.algorithm, err, log.ErrInvalidParameter)
+	}
+
+	return c, nil
+}
+
+func (f *compressedFormat) Encode(input interface{}, output []byte) (out []byte, err error) {
+	flagPosition := len(output)
+	out = append(output, notCompressed)
+
+	out, err = appendEncoded(f.inner, input, out)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := out[flagPosition+1:]
+	if len(payload) < f.minSize || len(payload) > f.maxDecompressedSize {
+		return out, nil
+	}
+
+	buffer := f.buffer()
+	defer f.buffers.Put(buffer)
+
+	w := f.writers.Get().(compressor) //nolint:forcetypeassert
+	defer f.writers.Put(w)
+
+	w.Reset(buffer)
+
+	if _, err = w.Write(payload); err != nil {
+		return nil, fmt.Errorf("%s compression failed: %w", f.algorithm, err)
+	}
+
+	if err = w.Close(); err != nil {
+		return nil, fmt.Errorf("%s compression failed: %w", f.algorithm, err)
+	}
+
+	if buffer.Len() >= len(payload) {
+		return out, nil
+	}
+
+	flag := byte(f.algorithm)
+	if f.dictionary != nil {
+		flag |= dictionaryFlag
+	}
+
+	out[flagPosition] = flag
+
+	return append(out[:flagPosition+1], buffer.Bytes()...), nil
+}
+
+func (f *compressedFormat) buffer() *bytes.Buffer {
+	if b, ok := f.buffers.Get().(*bytes.Buffer); ok {
+		b.Reset()
+
+		return b
+	}
+
+	return &bytes.Buffer{}
+}
+
+func (f *compressedFormat) Decode(input []byte, output interface{}) error {
+	if len(input) == 0 {
+		return fmt.Errorf("missing compression flag: %w", io.ErrUnexpectedEOF)
+	}
+
+	flag, payload := input[0], input[1:]
+	if flag == notCompressed {
+		return f.inner.Decode(payload, output)
+	}
+
+	var dictionary []byte
+
+	if flag&dictionaryFlag != 0 {
+		if f.dictionary == nil {
+			return errors.New("payload was compressed using dictionary, but no dictionary was given")
+		}
+
+		dictionary = f.dictionary
+	}
+
+	decompressed, err := f.decompress(Compression(flag&^dictionaryFlag), payload, dictionary)
+	if err != nil {
+		return err
+	}
+
+	return f.inner.Decode(decompressed, output)
+}
+
+// decompress returns newly allocated slice, because inner Format may retain it.
+func (f *compressedFormat) decompress(algorithm Compression, payload, dictionary []byte) ([]byte, error) {
+	if algorithm != Gzip && algorithm != Flate && algorithm != Zlib {
+		return nil, fmt.Errorf("unsupported compression flag %d", byte(algorithm))
+	}
+
+	pool := &f.readers[algorithm]
+
+	r, err := resetReader(algorithm, pool.Get(), bytes.NewReader(payload), dictionary)
+	if err != nil {
+		return nil, fmt.Errorf("%s decompression failed: %w", algorithm, err)
+	}
+
+	defer pool.Put(r)
+
+	decompressed, err := io.ReadAll(io.LimitReader(r, int64(f.maxDecompressedSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s decompression failed: %w", algorithm, err)
+	}
+
+	if len(decompressed) > f.maxDecompressedSize {
+		return nil, fmt.Errorf("%s decompression failed: more than %d bytes: %w",
+			algorithm, f.maxDecompressedSize, ErrDecompressedSizeExceeded)
+	}
+
+	return decompressed, nil
+}
+
+// resetReader resets pooled reader or creates a new one when pool was empty.
+func resetReader(algorithm Compression, pooled interface{}, source io.Reader, dictionary []byte) (io.ReadCloser, error) {
+	switch algorithm {
+	case Gzip:
+		if r, ok := pooled.(*gzip.Reader); ok {
+			return r, r.Reset(source)
+		}
+
+		return gzip.NewReader(source)
+	case Flate:
+		if r, ok := pooled.(io.ReadCloser); ok {
+			return r, r.(flate.Resetter).Reset(source, dictionary) //nolint:forcetypeassert
+		}
+
+		return flate.NewReaderDict(source, dictionary), nil
+	default:
+		if r, ok := pooled.(io.ReadCloser); ok {
+			return r, r.(zlib.Resetter).Reset(source, dictionary) //nolint:forcetypeassert
+		}
+
+		return zlib.NewReaderDict(source, dictionary)
+	}
+}
@@ -0,0 +1,237 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package codec_test
+
+import (
+	"compress/flate"
+	"strings"
+	"testing"
+
+	"github.com/elgopher/logstore/codec"
+	"github.com/elgopher/logstore/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var algorithms = []codec.Compression{codec.Gzip, codec.Flate, codec.Zlib}
+
+func TestCompressed(t *testing.T) {
+	t.Run("should return error when inner format is nil", func(t *testing.T) {
+		_, err := codec.Compressed(nil, codec.Gzip, 0)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error for unsupported algorithm", func(t *testing.T) {
+		_, err := codec.Compressed(codec.JSON(), 0, 0)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error for invalid level", func(t *testing.T) {
+		_, err := codec.Compressed(codec.JSON(), codec.Flate, 0, codec.CompressionLevel(100))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error when gzip is used with dictionary", func(t *testing.T) {
+		_, err := codec.Compressed(codec.JSON(), codec.Gzip, 0, codec.Dictionary([]byte("dict")))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error for non-positive max decompressed size", func(t *testing.T) {
+		_, err := codec.Compressed(codec.JSON(), codec.Gzip, 0, codec.MaxDecompressedSize(0))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error for empty dictionary", func(t *testing.T) {
+		_, err := codec.Compressed(codec.JSON(), codec.Flate, 0, codec.Dictionary(nil))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should skip nil option", func(t *testing.T) {
+		format, err := codec.Compressed(codec.JSON(), codec.Flate, 0, nil)
+		require.NoError(t, err)
+		assert.NotNil(t, format)
+	})
+}
+
+func TestCompressedFormat(t *testing.T) {
+	large := JSONMessage{Text: strings.Repeat("text ", 100)}
+	small := JSONMessage{Text: "text"}
+
+	for _, algorithm := range algorithms {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			format := newCompressed(t, codec.JSON(), algorithm, 64)
+
+			t.Run("should compress large payload", func(t *testing.T) {
+				// when
+				bytes, err := format.Encode(large, nil)
+				// then
+				require.NoError(t, err)
+				assert.Equal(t, byte(algorithm), bytes[0])
+				assert.Less(t, len(bytes), len(large.Text))
+				var decoded JSONMessage
+				require.NoError(t, format.Decode(bytes, &decoded))
+				assert.Equal(t, large, decoded)
+			})
+
+			t.Run("should not compress payload smaller than minSize", func(t *testing.T) {
+				// when
+				bytes, err := format.Encode(small, nil)
+				// then
+				require.NoError(t, err)
+				assert.Equal(t, append([]byte{0}, `{"Text":"text"}`...), bytes)
+				var decoded JSONMessage
+				require.NoError(t, format.Decode(bytes, &decoded))
+				assert.Equal(t, small, decoded)
+			})
+
+			t.Run("should use dictionary", func(t *testing.T) {
+				if algorithm == codec.Gzip {
+					t.Skip("gzip does not support dictionary")
+				}
+
+				dictionary := []byte(`{"Text":"text text text`)
+				level := codec.CompressionLevel(flate.BestCompression)
+				withDictionary := newCompressed(t, codec.JSON(), algorithm, 0, level, codec.Dictionary(dictionary))
+				msg := JSONMessage{Text: "text text text text"}
+				withoutDictionary, err := newCompressed(t, codec.JSON(), algorithm, 0, level).Encode(msg, nil)
+				require.NoError(t, err)
+				// when
+				bytes, err := withDictionary.Encode(msg, nil)
+				// then
+				require.NoError(t, err)
+				assert.Less(t, len(bytes), len(withoutDictionary))
+				var decoded JSONMessage
+				require.NoError(t, withDictionary.Decode(bytes, &decoded))
+				assert.Equal(t, msg, decoded)
+				assert.Error(t, format.Decode(bytes, &decoded), "decoding without dictionary should fail")
+			})
+		})
+	}
+
+	t.Run("should decode payloads compressed with other algorithms", func(t *testing.T) {
+		format := newCompressed(t, codec.JSON(), codec.Gzip, 0)
+
+		for _, algorithm := range algorithms {
+			bytes, err := newCompressed(t, codec.JSON(), algorithm, 0).Encode(large, nil)
+			require.NoError(t, err)
+			var decoded JSONMessage
+			// when
+			err = format.Decode(bytes, &decoded)
+			// then
+			require.NoError(t, err)
+			assert.Equal(t, large, decoded)
+		}
+	})
+
+	t.Run("should append to output", func(t *testing.T) {
+		format := newCompressed(t, codec.MessagePack(), codec.Flate, 0, codec.CompressionLevel(flate.BestSpeed))
+		output := make([]byte, 1, 1024)
+		// when
+		bytes, err := format.Encode(large, output)
+		// then
+		require.NoError(t, err)
+		assert.Same(t, &output[0], &bytes[0], "output slice should be reused")
+		var decoded JSONMessage
+		require.NoError(t, format.Decode(bytes[1:], &decoded))
+		assert.Equal(t, large, decoded)
+	})
+
+	t.Run("should return error for unsupported flag", func(t *testing.T) {
+		format := newCompressed(t, codec.JSON(), codec.Gzip, 0)
+		var decoded JSONMessage
+		err := format.Decode([]byte{7, 1, 2, 3}, &decoded)
+		assert.Error(t, err)
+	})
+
+	t.Run("should return error when decompressed payload exceeds max size", func(t *testing.T) {
+		bytes, err := newCompressed(t, codec.JSON(), codec.Gzip, 0).Encode(large, nil)
+		require.NoError(t, err)
+		format := newCompressed(t, codec.JSON(), codec.Gzip, 0, codec.MaxDecompressedSize(100))
+		var decoded JSONMessage
+		// when
+		err = format.Decode(bytes, &decoded)
+		// then
+		assert.ErrorIs(t, err, codec.ErrDecompressedSizeExceeded)
+	})
+
+	t.Run("should not compress payload larger than max decompressed size", func(t *testing.T) {
+		format := newCompressed(t, codec.JSON(), codec.Gzip, 0, codec.MaxDecompressedSize(100))
+		// when
+		bytes, err := format.Encode(large, nil)
+		// then
+		require.NoError(t, err)
+		var decoded JSONMessage
+		require.NoError(t, format.Decode(bytes, &decoded))
+		assert.Equal(t, large, decoded)
+	})
+
+	t.Run("should return error for corrupted payload", func(t *testing.T) {
+		format := newCompressed(t, codec.JSON(), codec.Gzip, 0)
+		bytes, err := format.Encode(large, nil)
+		require.NoError(t, err)
+		var decoded JSONMessage
+		// when
+		err = format.Decode(bytes[:len(bytes)/2], &decoded)
+		// then
+		assert.Error(t, err)
+	})
+}
+
+func TestCompressedFormat_RoundTrip(t *testing.T) {
+	l := log.New(t.TempDir())
+	writer := openWriter(t, l)
+	c := codec.NewTyped[JSONMessage](newCompressed(t, codec.JSON(), codec.Zlib, 64))
+	messages := []JSONMessage{{Text: "small"}, {Text: strings.Repeat("large ", 50)}}
+
+	for _, msg := range messages {
+		_, err := c.Write(writer, msg)
+		require.NoError(t, err)
+	}
+
+	reader := openReader(t, l)
+	// when
+	entries, err := c.ReadAll(reader)
+	// then
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, messages[0], entries[0].Object)
+	assert.Equal(t, messages[1], entries[1].Object)
+}
+
+func BenchmarkCompressedFormat_Encode(b *testing.B) {
+	format := newCompressed(b, codec.MessagePack(), codec.Flate, 0)
+	msg := JSONMessage{Text: strings.Repeat("message ", 100)}
+	output := make([]byte, 0, 1024)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, _ = format.Encode(msg, output[:0])
+	}
+}
+
+func BenchmarkCompressedFormat_Decode(b *testing.B) {
+	format := newCompressed(b, codec.MessagePack(), codec.Flate, 0)
+	input, _ := format.Encode(JSONMessage{Text: strings.Repeat("message ", 100)}, nil)
+
+	var msg JSONMessage
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_ = format.Decode(input, &msg)
+	}
+}
+
+func newCompressed(t testing.TB, inner codec.Format, algorithm codec.Compression, minSize int,
+	options ...codec.CompressionOption) codec.Format {
+	t.Helper()
+
+	format, err := codec.Compressed(inner, algorithm, minSize, options...)
+	require.NoError(t, err)
+
+	return format
+}
@@ -0,0 +1,203 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/elgopher/logstore/log"
+)
+
+// ErrNoHandler is returned when there is no handler for the event and unknown events are not skipped.
+var ErrNoHandler = errors.New("no handler for event")
+
+// NewDispatcher creates Dispatcher decoding entries into interface{} using given format. Format must be able
+// to decode events into *interface{}, for example Enveloped or Gob.
+//
+// By default, Replay stops with error on first unknown event and on first handler error.
+func NewDispatcher(format Format, options ...DispatcherOption) (*Dispatcher, error) {
+	if format == nil {
+		return nil, fmt.Errorf("nil format: %w", log.ErrInvalidParameter)
+	}
+
+	settings := &DispatcherSettings{}
+
+	for _, applyOption := range options {
+		if applyOption == nil {
+			continue
+		}
+
+		if err := applyOption(settings); err != nil {
+			return nil, fmt.Errorf("error applying option: %w", err)
+		}
+	}
+
+	return &Dispatcher{
+		format:   format,
+		settings: settings,
+		handlers: map[reflect.Type]handler{},
+	}, nil
+}
+
+type DispatcherOption func(*DispatcherSettings) error
+
+type DispatcherSettings struct {
+	skipUnknown    bool
+	defaultHandler handler
+	onHandlerError func(t time.Time, event interface{}, err error)
+}
+
+// SkipUnknownEvents makes Dispatcher skip events without handler and events which type is not known
+// by the format (ErrUnknownEventType).
+func SkipUnknownEvents() DispatcherOption {
+	return func(s *DispatcherSettings) error {
+		s.skipUnknown = true
+
+		return nil
+	}
+}
+
+// DefaultHandler sets handler for events without dedicated handler. Events which type is not known by the format
+// can be handled by it only if the format decodes them (see RawFallback).
+func DefaultHandler(h func(t time.Time, event interface{}) error) DispatcherOption {
+	return func(s *DispatcherSettings) error {
+		if h == nil {
+			return fmt.Errorf("nil default handler: %w", log.ErrInvalidParameter)
+		}
+
+		s.defaultHandler = h
+
+		return nil
+	}
+}
+
+// ContinueOnHandlerError makes Replay continue when handler returns error. Each error is passed
+// to onError function.
+func ContinueOnHandlerError(onError func(t time.Time, event interface{}, err error)) DispatcherOption {
+	return func(s *DispatcherSettings) error {
+		if onError == nil {
+			return fmt.Errorf("nil onError function: %w", log.ErrInvalidParameter)
+		}
+
+		s.onHandlerError = onError
+
+		return nil
+	}
+}
+
+// Dispatcher routes decoded events to handlers registered for their types. Handlers are registered using On
+// function. Dispatcher is not safe for concurrent registration and dispatching.
+type Dispatcher struct {
+	format   Format
+	settings *DispatcherSettings
+	handlers map[reflect.Type]handler
+}
+
+type handler func(t time.Time, event interface{}) error
+
+// On registers handler for events of type T. It returns error when handler is nil or when handler for T
+// is already registered.
+//
+// T must not be a pointer type, because formats decode events into values. For example, register handler for
+// OrderPlaced, not *OrderPlaced.
+func On[T any](d *Dispatcher, h func(t time.Time, event T) error) error {
+	if d == nil {
+		return fmt.Errorf("nil dispatcher: %w", log.ErrInvalidParameter)
+	}
+
+	if h == nil {
+		return fmt.Errorf("nil handler: %w", log.ErrInvalidParameter)
+	}
+
+	eventType := reflect.TypeOf((*T)(nil)).Elem()
+	if eventType.Kind() == reflect.Pointer {
+		return fmt.Errorf("pointer event type %s: %w", eventType, log.ErrInvalidParameter)
+	}
+
+	if _, ok := d.handlers[eventType]; ok {
+		return fmt.Errorf("handler for %s already registered: %w", eventType, log.ErrInvalidParameter)
+	}
+
+	d.handlers[eventType] = func(t time.Time, event interface{}) error {
+		return h(t, event.(T)) //nolint:forcetypeassert
+	}
+
+	return nil
+}
+
+// Replay reads entries until log.ErrEOL and dispatches them to handlers. It returns the number of events
+// passed to handlers.
+//
+// When segments were compacted while replaying, Replay returns error wrapping log.ErrSegmentCompacted. Events
+// from removed segments are lost, but the reader is still valid: call Replay again with the same reader to resume
+// from the next available entry.
+func (d *Dispatcher) Replay(reader Reader) (int, error) {
+	if reader == nil {
+		return 0, fmt.Errorf("nil reader: %w", log.ErrInvalidParameter)
+	}
+
+	dispatched := 0
+
+	for {
+		t, data, err := reader.Read()
+		if errors.Is(err, log.ErrEOL) {
+			return dispatched, nil
+		}
+
+		if err != nil {
+			return dispatched, fmt.Errorf("read failed: %w", err)
+		}
+
+		var event interface{}
+
+		err = d.format.Decode(data, &event)
+		if errors.Is(err, ErrUnknownEventType) && d.settings.skipUnknown {
+			continue
+		}
+
+		if err != nil {
+			return dispatched, fmt.Errorf("decoding entry %s failed: %w", t, err)
+		}
+
+		handled, err := d.Dispatch(t, event)
+		if handled {
+			dispatched++
+		}
+
+		if err != nil {
+			return dispatched, err
+		}
+	}
+}
+
+// Dispatch passes the event to its handler. It returns false when event was skipped.
+func (d *Dispatcher) Dispatch(t time.Time, event interface{}) (bool, error) {
+	h, ok := d.handlers[reflect.TypeOf(event)]
+	if !ok {
+		h = d.settings.defaultHandler
+	}
+
+	if h == nil {
+		if d.settings.skipUnknown {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("%T: %w", event, ErrNoHandler)
+	}
+
+	if err := h(t, event); err != nil {
+		if d.settings.onHandlerError != nil {
+			d.settings.onHandlerError(t, event, err)
+
+			return true, nil
+		}
+
+		return true, fmt.Errorf("handling event %T at %s failed: %w", event, t, err)
+	}
+
+	return true, nil
+}
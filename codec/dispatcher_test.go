@@ -0,0 +1,289 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package codec_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/elgopher/logstore/codec"
+	"github.com/elgopher/logstore/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDispatcher(t *testing.T) {
+	t.Run("should return error when format is nil", func(t *testing.T) {
+		_, err := codec.NewDispatcher(nil)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error when default handler is nil", func(t *testing.T) {
+		_, err := codec.NewDispatcher(codec.JSON(), codec.DefaultHandler(nil))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error when onError function is nil", func(t *testing.T) {
+		_, err := codec.NewDispatcher(codec.JSON(), codec.ContinueOnHandlerError(nil))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+}
+
+func TestOn(t *testing.T) {
+	t.Run("should return error when handler is nil", func(t *testing.T) {
+		d := newDispatcher(t)
+		err := codec.On[OrderPlaced](d, nil)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error when dispatcher is nil", func(t *testing.T) {
+		err := codec.On(nil, func(time.Time, OrderPlaced) error { return nil })
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error when handler is already registered", func(t *testing.T) {
+		d := newDispatcher(t)
+		require.NoError(t, codec.On(d, func(time.Time, OrderPlaced) error { return nil }))
+		// when
+		err := codec.On(d, func(time.Time, OrderPlaced) error { return nil })
+		// then
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error for pointer event type", func(t *testing.T) {
+		d := newDispatcher(t)
+		// when
+		err := codec.On(d, func(time.Time, *OrderPlaced) error { return nil })
+		// then
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+}
+
+func TestDispatcher_Replay(t *testing.T) {
+	t.Run("should route events to handlers", func(t *testing.T) {
+		l := log.New(t.TempDir())
+		writeOrderEvents(t, l, OrderPlaced{OrderID: "1"}, OrderCancelled{OrderID: "1"}, OrderPlaced{OrderID: "2"})
+		d := newDispatcher(t)
+		var placed, cancelled []string
+		require.NoError(t, codec.On(d, func(_ time.Time, event OrderPlaced) error {
+			placed = append(placed, event.OrderID)
+
+			return nil
+		}))
+		require.NoError(t, codec.On(d, func(_ time.Time, event OrderCancelled) error {
+			cancelled = append(cancelled, event.OrderID)
+
+			return nil
+		}))
+		// when
+		dispatched, err := d.Replay(openReader(t, l))
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 3, dispatched)
+		assert.Equal(t, []string{"1", "2"}, placed)
+		assert.Equal(t, []string{"1"}, cancelled)
+	})
+
+	t.Run("should pass entry time to handler", func(t *testing.T) {
+		l := log.New(t.TempDir())
+		times := writeOrderEvents(t, l, OrderPlaced{OrderID: "1"})
+		d := newDispatcher(t)
+		var handledTime time.Time
+		require.NoError(t, codec.On(d, func(t time.Time, _ OrderPlaced) error {
+			handledTime = t
+
+			return nil
+		}))
+		// when
+		_, err := d.Replay(openReader(t, l))
+		// then
+		require.NoError(t, err)
+		assert.True(t, times[0].Equal(handledTime))
+	})
+
+	t.Run("should return error when there is no handler", func(t *testing.T) {
+		l := log.New(t.TempDir())
+		writeOrderEvents(t, l, OrderPlaced{OrderID: "1"})
+		d := newDispatcher(t)
+		// when
+		_, err := d.Replay(openReader(t, l))
+		// then
+		assert.ErrorIs(t, err, codec.ErrNoHandler)
+	})
+
+	t.Run("should skip events without handler", func(t *testing.T) {
+		l := log.New(t.TempDir())
+		writeOrderEvents(t, l, OrderPlaced{OrderID: "1"}, OrderCancelled{OrderID: "1"})
+		d := newDispatcher(t, codec.SkipUnknownEvents())
+		require.NoError(t, codec.On(d, func(time.Time, OrderCancelled) error { return nil }))
+		// when
+		dispatched, err := d.Replay(openReader(t, l))
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, dispatched)
+	})
+
+	t.Run("should skip events of unknown type", func(t *testing.T) {
+		l := log.New(t.TempDir())
+		writeOrderEvents(t, l, OrderPlaced{OrderID: "1"})
+		registry := codec.NewRegistry()
+		registry.MustRegister("OrderCancelled", OrderCancelled{})
+		d, err := codec.NewDispatcher(newEnveloped(t, codec.JSON(), registry), codec.SkipUnknownEvents())
+		require.NoError(t, err)
+		// when
+		dispatched, err := d.Replay(openReader(t, l))
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 0, dispatched)
+	})
+
+	t.Run("should return error for event of unknown type", func(t *testing.T) {
+		l := log.New(t.TempDir())
+		writeOrderEvents(t, l, OrderPlaced{OrderID: "1"})
+		d, err := codec.NewDispatcher(newEnveloped(t, codec.JSON(), codec.NewRegistry()))
+		require.NoError(t, err)
+		// when
+		_, err = d.Replay(openReader(t, l))
+		// then
+		assert.ErrorIs(t, err, codec.ErrUnknownEventType)
+	})
+
+	t.Run("should pass events without handler to default handler", func(t *testing.T) {
+		l := log.New(t.TempDir())
+		writeOrderEvents(t, l, OrderPlaced{OrderID: "1"}, OrderCancelled{OrderID: "1"})
+		var unhandled []interface{}
+		d := newDispatcher(t, codec.DefaultHandler(func(_ time.Time, event interface{}) error {
+			unhandled = append(unhandled, event)
+
+			return nil
+		}))
+		require.NoError(t, codec.On(d, func(time.Time, OrderPlaced) error { return nil }))
+		// when
+		dispatched, err := d.Replay(openReader(t, l))
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 2, dispatched)
+		assert.Equal(t, []interface{}{OrderCancelled{OrderID: "1"}}, unhandled)
+	})
+
+	t.Run("should stop on handler error", func(t *testing.T) {
+		l := log.New(t.TempDir())
+		writeOrderEvents(t, l, OrderPlaced{OrderID: "1"}, OrderPlaced{OrderID: "2"})
+		d := newDispatcher(t)
+		handlerErr := errors.New("handler error")
+		var handled []string
+		require.NoError(t, codec.On(d, func(_ time.Time, event OrderPlaced) error {
+			handled = append(handled, event.OrderID)
+
+			return handlerErr
+		}))
+		// when
+		dispatched, err := d.Replay(openReader(t, l))
+		// then
+		assert.ErrorIs(t, err, handlerErr)
+		assert.Equal(t, 1, dispatched)
+		assert.Equal(t, []string{"1"}, handled)
+	})
+
+	t.Run("should continue on handler error", func(t *testing.T) {
+		l := log.New(t.TempDir())
+		writeOrderEvents(t, l, OrderPlaced{OrderID: "1"}, OrderPlaced{OrderID: "2"})
+		handlerErr := errors.New("handler error")
+		var reportedErrors []error
+		d := newDispatcher(t, codec.ContinueOnHandlerError(func(_ time.Time, _ interface{}, err error) {
+			reportedErrors = append(reportedErrors, err)
+		}))
+		require.NoError(t, codec.On(d, func(time.Time, OrderPlaced) error {
+			return handlerErr
+		}))
+		// when
+		dispatched, err := d.Replay(openReader(t, l))
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 2, dispatched)
+		assert.Equal(t, []error{handlerErr, handlerErr}, reportedErrors)
+	})
+
+	t.Run("should resume after segments were compacted", func(t *testing.T) {
+		format := newEnveloped(t, codec.JSON(), orderRegistry())
+		placed1, err := format.Encode(OrderPlaced{OrderID: "1"}, nil)
+		require.NoError(t, err)
+		placed2, err := format.Encode(OrderPlaced{OrderID: "2"}, nil)
+		require.NoError(t, err)
+		reader := &readerStub{
+			entries: [][]byte{placed1, nil, placed2},
+			errors:  []error{nil, log.ErrSegmentCompacted, nil},
+		}
+		d := newDispatcher(t)
+		var placed []string
+		require.NoError(t, codec.On(d, func(_ time.Time, event OrderPlaced) error {
+			placed = append(placed, event.OrderID)
+
+			return nil
+		}))
+		dispatched, err := d.Replay(reader)
+		require.ErrorIs(t, err, log.ErrSegmentCompacted)
+		assert.Equal(t, 1, dispatched)
+		// when
+		dispatched, err = d.Replay(reader)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, dispatched)
+		assert.Equal(t, []string{"1", "2"}, placed)
+	})
+
+	t.Run("should return error when reader is nil", func(t *testing.T) {
+		d := newDispatcher(t)
+		_, err := d.Replay(nil)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+}
+
+func newDispatcher(t *testing.T, options ...codec.DispatcherOption) *codec.Dispatcher {
+	t.Helper()
+
+	d, err := codec.NewDispatcher(newEnveloped(t, codec.JSON(), orderRegistry()), options...)
+	require.NoError(t, err)
+
+	return d
+}
+
+func writeOrderEvents(t *testing.T, l *log.Log, events ...interface{}) []time.Time {
+	t.Helper()
+
+	writer, err := l.OpenWriter()
+	require.NoError(t, err)
+
+	defer writer.Close() //nolint:errcheck
+
+	c := codec.New(newEnveloped(t, codec.JSON(), orderRegistry()))
+
+	var times []time.Time
+
+	for _, event := range events {
+		writtenTime, err := c.Write(writer, event)
+		require.NoError(t, err)
+
+		times = append(times, writtenTime)
+	}
+
+	return times
+}
+
+type readerStub struct {
+	entries [][]byte
+	errors  []error
+}
+
+func (r *readerStub) Read() (time.Time, []byte, error) {
+	if len(r.entries) == 0 {
+		return time.Time{}, nil, log.ErrEOL
+	}
+
+	data, err := r.entries[0], r.errors[0]
+	r.entries, r.errors = r.entries[1:], r.errors[1:]
+
+	return time.Now(), data, err
+}
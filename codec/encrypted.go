@@ -0,0 +1,282 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package codec
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sync"
+
+	"github.com/elgopher/logstore/log"
+)
+
+// Keyring provides keys for Encrypted format. Format caches ciphers by key ID, but the cached cipher is used only
+// when the key returned by Keyring is the same.
+type Keyring interface {
+	// EncryptionKey returns the key used to encrypt the event. Event is the object passed to Format.Encode.
+	EncryptionKey(event interface{}) (keyID string, key []byte, err error)
+	// Key returns the key used to decrypt entries encrypted using keyID. *MissingKeyError should be returned
+	// when key is not available.
+	Key(keyID string) ([]byte, error)
+}
+
+// MissingKeyError is returned when entry was encrypted with a key which is not available in the Keyring.
+type MissingKeyError struct {
+	KeyID string
+}
+
+func (e *MissingKeyError) Error() string {
+	return fmt.Sprintf("missing encryption key %q", e.KeyID)
+}
+
+// Encrypted returns Format encrypting payloads encoded by inner Format with AES-GCM. Each entry starts with
+// the ID of the key used to encrypt it, therefore keys can be rotated and different events can be encrypted
+// with different keys. Key ID is authenticated, but not encrypted.
+//
+// Decode returns *MissingKeyError when the key is not available in the keyring.
+func Encrypted(inner Format, keyring Keyring) (Format, error) {
+	if inner == nil {
+		return nil, fmt.Errorf("nil inner format: %w", log.ErrInvalidParameter)
+	}
+
+	if keyring == nil {
+		return nil, fmt.Errorf("nil keyring: %w", log.ErrInvalidParameter)
+	}
+
+	return &encryptedFormat{inner: inner, keyring: keyring}, nil
+}
+
+type encryptedFormat struct {
+	inner   Format
+	keyring Keyring
+	ciphers sync.Map // key ID -> *cachedCipher
+}
+
+type cachedCipher struct {
+	key  []byte
+	aead cipher.AEAD
+}
+
+func (f *encryptedFormat) aead(keyID string, key []byte) (cipher.AEAD, error) {
+	if cached, ok := f.ciphers.Load(keyID); ok {
+		c := cached.(*cachedCipher) //nolint:forcetypeassert
+		if bytes.Equal(c.key, key) {
+			return c.aead, nil
+		}
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key %q: %v: %w", keyID, err, log.ErrInvalidParameter)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("creating GCM for key %q failed: %w", keyID, err)
+	}
+
+	// key is copied, because Keyring may reuse the slice
+	f.ciphers.Store(keyID, &cachedCipher{key: append([]byte{}, key...), aead: aead})
+
+	return aead, nil
+}
+
+func (f *encryptedFormat) Encode(input interface{}, output []byte) (out []byte, err error) {
+	keyID, key, err := f.keyring.EncryptionKey(input)
+	if err != nil {
+		return nil, fmt.Errorf("getting encryption key failed: %w", err)
+	}
+
+	if len(keyID) > math.MaxUint8 {
+		return nil, fmt.Errorf("key ID %q is longer than 255 bytes: %w", keyID, log.ErrInvalidParameter)
+	}
+
+	aead, err := f.aead(keyID, key)
+	if err != nil {
+		return nil, err
+	}
+
+	headerStart := len(output)
+	out = append(output, byte(len(keyID)))
+	out = append(out, keyID...)
+	nonceStart := len(out)
+	out = append(out, make([]byte, aead.NonceSize())...)
+
+	nonce := out[nonceStart:]
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("generating nonce failed: %w", err)
+	}
+
+	plaintextStart := len(out)
+
+	out, err = appendEncoded(f.inner, input, out)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext := out[plaintextStart:]
+	additionalData := out[headerStart:nonceStart]
+	sealed := aead.Seal(plaintext[:0], out[nonceStart:plaintextStart], plaintext, additionalData)
+
+	return append(out[:plaintextStart], sealed...), nil
+}
+
+func (f *encryptedFormat) Decode(input []byte, output interface{}) error {
+	if len(input) == 0 {
+		return fmt.Errorf("missing key ID: %w", io.ErrUnexpectedEOF)
+	}
+
+	nonceStart := 1 + int(input[0])
+	if len(input) < nonceStart {
+		return fmt.Errorf("truncated key ID: %w", io.ErrUnexpectedEOF)
+	}
+
+	keyID := string(input[1:nonceStart])
+
+	key, err := f.keyring.Key(keyID)
+	if err != nil {
+		return err
+	}
+
+	aead, err := f.aead(keyID, key)
+	if err != nil {
+		return err
+	}
+
+	ciphertextStart := nonceStart + aead.NonceSize()
+	if len(input) < ciphertextStart+aead.Overhead() {
+		return fmt.Errorf("truncated ciphertext: %w", io.ErrUnexpectedEOF)
+	}
+
+	// plaintext is not decrypted in place, because input must not be modified
+	plaintext, err := aead.Open(nil, input[nonceStart:ciphertextStart], input[ciphertextStart:], input[:nonceStart])
+	if err != nil {
+		return fmt.Errorf("decrypting with key %q failed: %w", keyID, err)
+	}
+
+	return f.inner.Decode(plaintext, output)
+}
+
+// NewKeyring creates in-memory Keyring. Use AddKey to add keys.
+func NewKeyring() *MemoryKeyring {
+	return &MemoryKeyring{
+		keys:         map[string][]byte{},
+		keyIDsByType: map[reflect.Type]string{},
+	}
+}
+
+// MemoryKeyring is a Keyring storing keys in memory. It is safe to use by multiple goroutines.
+type MemoryKeyring struct {
+	mutex          sync.RWMutex
+	keys           map[string][]byte
+	keyIDsByType   map[reflect.Type]string
+	defaultKeyID   string
+	defaultKeyUsed bool
+}
+
+// AddKey adds AES key (16, 24 or 32 bytes long). The first added key is used by default for encryption.
+// Keys cannot be replaced.
+func (k *MemoryKeyring) AddKey(keyID string, key []byte) error {
+	if len(key) != 16 && len(key) != 24 && len(key) != 32 {
+		return fmt.Errorf("key must be 16, 24 or 32 bytes long: %w", log.ErrInvalidParameter)
+	}
+
+	if len(keyID) > math.MaxUint8 {
+		return fmt.Errorf("key ID is longer than 255 bytes: %w", log.ErrInvalidParameter)
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if _, ok := k.keys[keyID]; ok {
+		return fmt.Errorf("key %q already added: %w", keyID, log.ErrInvalidParameter)
+	}
+
+	k.keys[keyID] = append([]byte{}, key...)
+
+	if !k.defaultKeyUsed {
+		k.defaultKeyID = keyID
+		k.defaultKeyUsed = true
+	}
+
+	return nil
+}
+
+// UseKey sets the key used to encrypt events without a dedicated key. It can be used to rotate keys.
+func (k *MemoryKeyring) UseKey(keyID string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if _, ok := k.keys[keyID]; !ok {
+		return &MissingKeyError{KeyID: keyID}
+	}
+
+	k.defaultKeyID = keyID
+	k.defaultKeyUsed = true
+
+	return nil
+}
+
+// UseKeyFor sets the key used to encrypt events of the example's type. Pointers are dereferenced.
+// When Envelope is encrypted, the type of Envelope.Event is used.
+func (k *MemoryKeyring) UseKeyFor(example interface{}, keyID string) error {
+	t := eventType(example)
+	if t == nil {
+		return fmt.Errorf("nil example: %w", log.ErrInvalidParameter)
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if _, ok := k.keys[keyID]; !ok {
+		return &MissingKeyError{KeyID: keyID}
+	}
+
+	k.keyIDsByType[t] = keyID
+
+	return nil
+}
+
+func (k *MemoryKeyring) EncryptionKey(event interface{}) (string, []byte, error) {
+	switch e := event.(type) {
+	case Envelope:
+		event = e.Event
+	case *Envelope:
+		if e != nil {
+			event = e.Event
+		}
+	}
+
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	keyID, ok := k.keyIDsByType[eventType(event)]
+	if !ok {
+		if !k.defaultKeyUsed {
+			return "", nil, fmt.Errorf("no keys in keyring: %w", log.ErrInvalidParameter)
+		}
+
+		keyID = k.defaultKeyID
+	}
+
+	return keyID, k.keys[keyID], nil
+}
+
+func (k *MemoryKeyring) Key(keyID string) ([]byte, error) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, &MissingKeyError{KeyID: keyID}
+	}
+
+	return key, nil
+}
@@ -0,0 +1,237 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package codec_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/elgopher/logstore/codec"
+	"github.com/elgopher/logstore/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	key1 = bytes.Repeat([]byte{1}, 32)
+	key2 = bytes.Repeat([]byte{2}, 16)
+)
+
+func TestEncrypted(t *testing.T) {
+	t.Run("should return error when inner format is nil", func(t *testing.T) {
+		_, err := codec.Encrypted(nil, codec.NewKeyring())
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error when keyring is nil", func(t *testing.T) {
+		_, err := codec.Encrypted(codec.JSON(), nil)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+}
+
+func TestEncryptedFormat(t *testing.T) {
+	msg := JSONMessage{Text: "secret"}
+
+	t.Run("should decrypt encrypted payload", func(t *testing.T) {
+		format := newEncrypted(t, codec.JSON(), newKeyring(t))
+		// when
+		encrypted, err := format.Encode(msg, nil)
+		// then
+		require.NoError(t, err)
+		assert.NotContains(t, string(encrypted), "secret")
+		var decoded JSONMessage
+		require.NoError(t, format.Decode(encrypted, &decoded))
+		assert.Equal(t, msg, decoded)
+	})
+
+	t.Run("should use different nonce for each entry", func(t *testing.T) {
+		format := newEncrypted(t, codec.JSON(), newKeyring(t))
+		// when
+		encrypted1, err1 := format.Encode(msg, nil)
+		encrypted2, err2 := format.Encode(msg, nil)
+		// then
+		require.NoError(t, err1)
+		require.NoError(t, err2)
+		assert.NotEqual(t, encrypted1, encrypted2)
+	})
+
+	t.Run("should append to output", func(t *testing.T) {
+		format := newEncrypted(t, codec.MessagePack(), newKeyring(t))
+		output := make([]byte, 1, 128)
+		// when
+		encrypted, err := format.Encode(msg, output)
+		// then
+		require.NoError(t, err)
+		assert.Same(t, &output[0], &encrypted[0], "output slice should be reused")
+		var decoded JSONMessage
+		require.NoError(t, format.Decode(encrypted[1:], &decoded))
+		assert.Equal(t, msg, decoded)
+	})
+
+	t.Run("should return MissingKeyError when key is not available", func(t *testing.T) {
+		encrypted, err := newEncrypted(t, codec.JSON(), newKeyring(t)).Encode(msg, nil)
+		require.NoError(t, err)
+		otherKeyring := codec.NewKeyring()
+		require.NoError(t, otherKeyring.AddKey("other", key2))
+		var decoded JSONMessage
+		// when
+		err = newEncrypted(t, codec.JSON(), otherKeyring).Decode(encrypted, &decoded)
+		// then
+		var missingKeyErr *codec.MissingKeyError
+		require.ErrorAs(t, err, &missingKeyErr)
+		assert.Equal(t, "key1", missingKeyErr.KeyID)
+	})
+
+	t.Run("should return error when payload was modified", func(t *testing.T) {
+		format := newEncrypted(t, codec.JSON(), newKeyring(t))
+		encrypted, err := format.Encode(msg, nil)
+		require.NoError(t, err)
+		encrypted[len(encrypted)-1]++
+		var decoded JSONMessage
+		// when
+		err = format.Decode(encrypted, &decoded)
+		// then
+		assert.Error(t, err)
+	})
+
+	t.Run("should return error for truncated entry", func(t *testing.T) {
+		format := newEncrypted(t, codec.JSON(), newKeyring(t))
+		encrypted, err := format.Encode(msg, nil)
+		require.NoError(t, err)
+		var decoded JSONMessage
+		// when
+		err = format.Decode(encrypted[:10], &decoded)
+		// then
+		assert.Error(t, err)
+	})
+
+	t.Run("should decrypt entries encrypted with rotated key", func(t *testing.T) {
+		keyring := newKeyring(t)
+		format := newEncrypted(t, codec.JSON(), keyring)
+		encryptedWithKey1, err := format.Encode(msg, nil)
+		require.NoError(t, err)
+		require.NoError(t, keyring.UseKey("key2"))
+		encryptedWithKey2, err := format.Encode(msg, nil)
+		require.NoError(t, err)
+		var decoded1, decoded2 JSONMessage
+		// when
+		err1 := format.Decode(encryptedWithKey1, &decoded1)
+		err2 := format.Decode(encryptedWithKey2, &decoded2)
+		// then
+		require.NoError(t, err1)
+		require.NoError(t, err2)
+		assert.Equal(t, msg, decoded1)
+		assert.Equal(t, msg, decoded2)
+	})
+
+	t.Run("should encrypt event types with different keys", func(t *testing.T) {
+		keyring := newKeyring(t)
+		require.NoError(t, keyring.UseKeyFor(OrderCancelled{}, "key2"))
+		format := newEncrypted(t, newEnveloped(t, codec.JSON(), orderRegistry()), keyring)
+		placed, err := format.Encode(OrderPlaced{OrderID: "1"}, nil)
+		require.NoError(t, err)
+		cancelled, err := format.Encode(codec.Envelope{Event: OrderCancelled{OrderID: "1"}}, nil)
+		require.NoError(t, err)
+		readerKeyring := codec.NewKeyring()
+		require.NoError(t, readerKeyring.AddKey("key1", key1))
+		readerFormat := newEncrypted(t, newEnveloped(t, codec.JSON(), orderRegistry()), readerKeyring)
+		var decoded1, decoded2 interface{}
+		// when
+		err1 := readerFormat.Decode(placed, &decoded1)
+		err2 := readerFormat.Decode(cancelled, &decoded2)
+		// then
+		require.NoError(t, err1)
+		assert.Equal(t, OrderPlaced{OrderID: "1"}, decoded1)
+		var missingKeyErr *codec.MissingKeyError
+		assert.ErrorAs(t, err2, &missingKeyErr)
+	})
+
+	t.Run("should use new key when key with the same ID was changed", func(t *testing.T) {
+		keyring := &singleKeyring{keyID: "key", key: key1}
+		format := newEncrypted(t, codec.JSON(), keyring)
+		_, err := format.Encode(msg, nil)
+		require.NoError(t, err)
+		keyring.key = key2
+		encrypted, err := format.Encode(msg, nil)
+		require.NoError(t, err)
+		var decoded JSONMessage
+		// when
+		err = newEncrypted(t, codec.JSON(), keyring).Decode(encrypted, &decoded)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, msg, decoded)
+	})
+}
+
+func TestMemoryKeyring(t *testing.T) {
+	t.Run("should return error for invalid key size", func(t *testing.T) {
+		err := codec.NewKeyring().AddKey("key", []byte{1, 2, 3})
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error when key is already added", func(t *testing.T) {
+		keyring := newKeyring(t)
+		err := keyring.AddKey("key1", key2)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return MissingKeyError when using missing key", func(t *testing.T) {
+		keyring := codec.NewKeyring()
+		var missingKeyErr *codec.MissingKeyError
+		assert.ErrorAs(t, keyring.UseKey("missing"), &missingKeyErr)
+		assert.ErrorAs(t, keyring.UseKeyFor(OrderPlaced{}, "missing"), &missingKeyErr)
+	})
+
+	t.Run("should return error when encrypting without keys", func(t *testing.T) {
+		_, err := newEncrypted(t, codec.JSON(), codec.NewKeyring()).Encode(JSONMessage{}, nil)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+}
+
+func TestEncryptedFormat_RoundTrip(t *testing.T) {
+	l := log.New(t.TempDir())
+	writer := openWriter(t, l)
+	c := codec.NewTyped[JSONMessage](newEncrypted(t, codec.JSON(), newKeyring(t)))
+	_, err := c.Write(writer, JSONMessage{Text: "secret"})
+	require.NoError(t, err)
+	reader := openReader(t, l)
+	// when
+	_, msg, err := c.Read(reader)
+	// then
+	require.NoError(t, err)
+	assert.Equal(t, JSONMessage{Text: "secret"}, msg)
+}
+
+func newKeyring(t *testing.T) *codec.MemoryKeyring {
+	t.Helper()
+
+	keyring := codec.NewKeyring()
+	require.NoError(t, keyring.AddKey("key1", key1))
+	require.NoError(t, keyring.AddKey("key2", key2))
+
+	return keyring
+}
+
+// singleKeyring returns the same key for all events. Key can be changed.
+type singleKeyring struct {
+	keyID string
+	key   []byte
+}
+
+func (k *singleKeyring) EncryptionKey(interface{}) (string, []byte, error) {
+	return k.keyID, k.key, nil
+}
+
+func (k *singleKeyring) Key(string) ([]byte, error) {
+	return k.key, nil
+}
+
+func newEncrypted(t testing.TB, inner codec.Format, keyring codec.Keyring) codec.Format {
+	t.Helper()
+
+	format, err := codec.Encrypted(inner, keyring)
+	require.NoError(t, err)
+
+	return format
+}
@@ -0,0 +1,334 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+
+	"github.com/elgopher/logstore/log"
+)
+
+// ErrUnknownEventType is returned when event type is not registered in the Registry.
+var ErrUnknownEventType = errors.New("unknown event type")
+
+// Envelope is an event together with its type name and optional metadata (such as correlation ID).
+type Envelope struct {
+	// Type is the registered name of the event type. It is filled during encoding and decoding.
+	Type     string
+	Metadata map[string]string
+	Event    interface{}
+}
+
+// RawEvent is an event of unknown type or unknown schema version. It is returned by Format created with RawFallback
+// option. Data is the payload encoded by the inner Format. RawEvent can be encoded again without changes.
+type RawEvent struct {
+	Type string
+	// Version is the schema version of Data. Zero is treated as 1.
+	Version int
+	Data    []byte
+}
+
+type EnvelopeOption func(*EnvelopeSettings) error
+
+type EnvelopeSettings struct {
+	rawFallback bool
+}
+
+// RawFallback makes Format decode events of unknown type as RawEvent instead of returning ErrUnknownEventType.
+// RawEvent is returned only when decoding into *Envelope or *interface{}.
+func RawFallback() EnvelopeOption {
+	return func(s *EnvelopeSettings) error {
+		s.rawFallback = true
+
+		return nil
+	}
+}
+
+// Enveloped returns Format storing event type name and metadata together with the payload encoded by inner Format.
+// It allows to store many event types in one log.
+//
+// Encode accepts Envelope, *Envelope or a bare event. Type of the event must be registered in the registry.
+// Event is stored together with its current schema version (see Registry.RegisterVersions).
+// Decode accepts *Envelope, *interface{} (decoded event is stored) or pointer to a registered type. Events stored
+// with older schema versions are upcasted to the current version.
+func Enveloped(inner Format, registry *Registry, options ...EnvelopeOption) (Format, error) {
+	if inner == nil {
+		return nil, fmt.Errorf("nil inner format: %w", log.ErrInvalidParameter)
+	}
+
+	if registry == nil {
+		return nil, fmt.Errorf("nil registry: %w", log.ErrInvalidParameter)
+	}
+
+	settings := &EnvelopeSettings{}
+
+	for _, applyOption := range options {
+		if applyOption == nil {
+			continue
+		}
+
+		if err := applyOption(settings); err != nil {
+			return nil, fmt.Errorf("error applying option: %w", err)
+		}
+	}
+
+	return &envelopeFormat{inner: inner, registry: registry, settings: settings}, nil
+}
+
+const (
+	envelopeVersion1 byte = 1
+	// envelopeVersion2 adds schema version of the event
+	envelopeVersion2 byte = 2
+)
+
+type envelopeFormat struct {
+	inner    Format
+	registry *Registry
+	settings *EnvelopeSettings
+}
+
+func (f *envelopeFormat) Encode(input interface{}, output []byte) (out []byte, err error) {
+	envelope := Envelope{Event: input}
+
+	switch e := input.(type) {
+	case Envelope:
+		envelope = e
+	case *Envelope:
+		if e == nil {
+			return nil, fmt.Errorf("nil envelope: %w", log.ErrInvalidParameter)
+		}
+
+		envelope = *e
+	}
+
+	raw, isRaw := envelope.Event.(RawEvent)
+	if rawPointer, ok := envelope.Event.(*RawEvent); ok && rawPointer != nil {
+		raw, isRaw = *rawPointer, true
+	}
+
+	name, version := raw.Type, raw.Version
+	if version == 0 {
+		version = 1
+	}
+
+	if !isRaw {
+		var ok bool
+
+		name, ok = f.registry.Name(envelope.Event)
+		if !ok {
+			return nil, fmt.Errorf("%T: %w", envelope.Event, ErrUnknownEventType)
+		}
+
+		version, _ = f.registry.Version(name)
+	}
+
+	if envelope.Type != "" && envelope.Type != name {
+		return nil, fmt.Errorf("envelope type %s does not match event type %s: %w",
+			envelope.Type, name, log.ErrInvalidParameter)
+	}
+
+	out = append(output, envelopeVersion2)
+	out = appendString(out, name)
+	out = binary.AppendUvarint(out, uint64(version))
+	out = appendMetadata(out, envelope.Metadata)
+
+	if isRaw {
+		return append(out, raw.Data...), nil
+	}
+
+	out, err = appendEncoded(f.inner, envelope.Event, out)
+	if err != nil {
+		return nil, fmt.Errorf("encoding event %s failed: %w", name, err)
+	}
+
+	return out, nil
+}
+
+func appendString(out []byte, s string) []byte {
+	out = binary.AppendUvarint(out, uint64(len(s)))
+
+	return append(out, s...)
+}
+
+func appendMetadata(out []byte, metadata map[string]string) []byte {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	out = binary.AppendUvarint(out, uint64(len(keys)))
+
+	for _, key := range keys {
+		out = appendString(out, key)
+		out = appendString(out, metadata[key])
+	}
+
+	return out
+}
+
+func (f *envelopeFormat) Decode(input []byte, output interface{}) error {
+	name, version, metadata, payload, err := decodeEnvelopeHeader(input)
+	if err != nil {
+		return err
+	}
+
+	switch out := output.(type) {
+	case *Envelope:
+		if out == nil {
+			return fmt.Errorf("nil envelope: %w", log.ErrInvalidParameter)
+		}
+
+		event, err := f.decodeEvent(name, version, payload)
+		if err != nil {
+			return err
+		}
+
+		*out = Envelope{Type: name, Metadata: metadata, Event: event}
+
+		return nil
+	case *interface{}:
+		if out == nil {
+			return fmt.Errorf("nil output: %w", log.ErrInvalidParameter)
+		}
+
+		event, err := f.decodeEvent(name, version, payload)
+		if err != nil {
+			return err
+		}
+
+		*out = event
+
+		return nil
+	}
+
+	registered, ok := f.registry.registeredType(name)
+	if !ok || !registered.supportsVersion(version) {
+		return fmt.Errorf("%s version %d: %w", name, version, ErrUnknownEventType)
+	}
+
+	outputValue := reflect.ValueOf(output)
+	if outputValue.Kind() != reflect.Pointer || outputValue.IsNil() || outputValue.Elem().Type() != registered.t {
+		return fmt.Errorf("cannot decode event %s into %T: %w", name, output, log.ErrInvalidParameter)
+	}
+
+	if version == registered.version() {
+		if err = f.inner.Decode(payload, output); err != nil {
+			return fmt.Errorf("decoding event %s failed: %w", name, err)
+		}
+
+		return nil
+	}
+
+	event, err := registered.decode(f.inner, version, payload)
+	if err != nil {
+		return fmt.Errorf("decoding event %s version %d failed: %w", name, version, err)
+	}
+
+	outputValue.Elem().Set(reflect.ValueOf(event))
+
+	return nil
+}
+
+func (f *envelopeFormat) decodeEvent(name string, version int, payload []byte) (interface{}, error) {
+	registered, ok := f.registry.registeredType(name)
+	if !ok || !registered.supportsVersion(version) {
+		if f.settings.rawFallback {
+			return RawEvent{Type: name, Version: version, Data: append([]byte{}, payload...)}, nil
+		}
+
+		return nil, fmt.Errorf("%s version %d: %w", name, version, ErrUnknownEventType)
+	}
+
+	event, err := registered.decode(f.inner, version, payload)
+	if err != nil {
+		return nil, fmt.Errorf("decoding event %s version %d failed: %w", name, version, err)
+	}
+
+	return event, nil
+}
+
+func decodeEnvelopeHeader(input []byte) (name string, version int, metadata map[string]string, payload []byte,
+	err error) {
+	if len(input) == 0 {
+		return "", 0, nil, nil, fmt.Errorf("empty envelope: %w", io.ErrUnexpectedEOF)
+	}
+
+	envelopeVersion := input[0]
+	if envelopeVersion != envelopeVersion1 && envelopeVersion != envelopeVersion2 {
+		return "", 0, nil, nil, fmt.Errorf("unsupported envelope version %d", envelopeVersion)
+	}
+
+	d := &envelopeDecoder{data: input[1:]}
+
+	name = d.readString()
+
+	version = 1
+	if envelopeVersion == envelopeVersion2 {
+		version = int(d.readUvarint())
+	}
+
+	metadataLen := d.readUvarint()
+	if metadataLen > 0 && d.err == nil {
+		metadata = map[string]string{}
+	}
+
+	for i := uint64(0); i < metadataLen && d.err == nil; i++ {
+		key := d.readString()
+		metadata[key] = d.readString()
+	}
+
+	if d.err != nil {
+		return "", 0, nil, nil, fmt.Errorf("invalid envelope: %w", d.err)
+	}
+
+	return name, version, metadata, d.data, nil
+}
+
+// envelopeDecoder reads envelope header. After first error all reads return zero values.
+type envelopeDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *envelopeDecoder) readUvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+
+	value, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err = io.ErrUnexpectedEOF
+
+		return 0
+	}
+
+	d.data = d.data[n:]
+
+	return value
+}
+
+func (d *envelopeDecoder) readString() string {
+	length := d.readUvarint()
+	if d.err != nil {
+		return ""
+	}
+
+	if length > uint64(len(d.data)) {
+		d.err = io.ErrUnexpectedEOF
+
+		return ""
+	}
+
+	s := string(d.data[:length])
+	d.data = d.data[length:]
+
+	return s
+}
@@ -0,0 +1,231 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package codec_test
+
+import (
+	"testing"
+
+	"github.com/elgopher/logstore/codec"
+	"github.com/elgopher/logstore/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnveloped(t *testing.T) {
+	t.Run("should return error when inner format is nil", func(t *testing.T) {
+		_, err := codec.Enveloped(nil, codec.NewRegistry())
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error when registry is nil", func(t *testing.T) {
+		_, err := codec.Enveloped(codec.JSON(), nil)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should skip nil option", func(t *testing.T) {
+		format, err := codec.Enveloped(codec.JSON(), codec.NewRegistry(), nil)
+		require.NoError(t, err)
+		assert.NotNil(t, format)
+	})
+
+	t.Run("should return error returned by option", func(t *testing.T) {
+		option := func(*codec.EnvelopeSettings) error {
+			return log.ErrInvalidParameter
+		}
+		// when
+		_, err := codec.Enveloped(codec.JSON(), codec.NewRegistry(), option)
+		// then
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+}
+
+func TestEnvelopeFormat_Encode(t *testing.T) {
+	registry := orderRegistry()
+	format := newEnveloped(t, codec.JSON(), registry)
+
+	t.Run("should append to output", func(t *testing.T) {
+		output := make([]byte, 1, 64)
+		// when
+		bytes, err := format.Encode(OrderPlaced{OrderID: "1"}, output)
+		// then
+		require.NoError(t, err)
+		assert.Same(t, &output[0], &bytes[0], "output slice should be reused")
+	})
+
+	t.Run("should return error for unknown event type", func(t *testing.T) {
+		_, err := format.Encode(JSONMessage{}, nil)
+		assert.ErrorIs(t, err, codec.ErrUnknownEventType)
+	})
+
+	t.Run("should return error when envelope type does not match event type", func(t *testing.T) {
+		envelope := codec.Envelope{Type: "OrderCancelled", Event: OrderPlaced{}}
+		// when
+		_, err := format.Encode(envelope, nil)
+		// then
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+}
+
+func TestEnvelopeFormat_Decode(t *testing.T) {
+	registry := orderRegistry()
+	format := newEnveloped(t, codec.JSON(), registry)
+
+	t.Run("should decode envelope", func(t *testing.T) {
+		envelope := &codec.Envelope{
+			Metadata: map[string]string{"correlationID": "123", "user": "john"},
+			Event:    OrderPlaced{OrderID: "1", Amount: 10},
+		}
+		bytes, err := format.Encode(envelope, nil)
+		require.NoError(t, err)
+		var decoded codec.Envelope
+		// when
+		err = format.Decode(bytes, &decoded)
+		// then
+		require.NoError(t, err)
+		expected := codec.Envelope{
+			Type:     "OrderPlaced",
+			Metadata: map[string]string{"correlationID": "123", "user": "john"},
+			Event:    OrderPlaced{OrderID: "1", Amount: 10},
+		}
+		assert.Equal(t, expected, decoded)
+	})
+
+	t.Run("should decode different event types into interface", func(t *testing.T) {
+		placed, err := format.Encode(&OrderPlaced{OrderID: "1"}, nil)
+		require.NoError(t, err)
+		cancelled, err := format.Encode(OrderCancelled{OrderID: "1", Reason: "reason"}, nil)
+		require.NoError(t, err)
+		var event1, event2 interface{}
+		// when
+		err1 := format.Decode(placed, &event1)
+		err2 := format.Decode(cancelled, &event2)
+		// then
+		require.NoError(t, err1)
+		require.NoError(t, err2)
+		assert.Equal(t, OrderPlaced{OrderID: "1"}, event1)
+		assert.Equal(t, OrderCancelled{OrderID: "1", Reason: "reason"}, event2)
+	})
+
+	t.Run("should decode into registered type", func(t *testing.T) {
+		bytes, err := format.Encode(OrderPlaced{OrderID: "1"}, nil)
+		require.NoError(t, err)
+		var decoded OrderPlaced
+		// when
+		err = format.Decode(bytes, &decoded)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, OrderPlaced{OrderID: "1"}, decoded)
+	})
+
+	t.Run("should return error when decoding into another type", func(t *testing.T) {
+		bytes, err := format.Encode(OrderPlaced{OrderID: "1"}, nil)
+		require.NoError(t, err)
+		var decoded OrderCancelled
+		// when
+		err = format.Decode(bytes, &decoded)
+		// then
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error for unknown event type", func(t *testing.T) {
+		bytes, err := format.Encode(OrderPlaced{OrderID: "1"}, nil)
+		require.NoError(t, err)
+		otherFormat := newEnveloped(t, codec.JSON(), codec.NewRegistry())
+		var decoded codec.Envelope
+		// when
+		err = otherFormat.Decode(bytes, &decoded)
+		// then
+		assert.ErrorIs(t, err, codec.ErrUnknownEventType)
+	})
+
+	t.Run("should return error for truncated envelope", func(t *testing.T) {
+		bytes, err := format.Encode(OrderPlaced{OrderID: "1"}, nil)
+		require.NoError(t, err)
+		var decoded codec.Envelope
+		// when
+		err = format.Decode(bytes[:3], &decoded)
+		// then
+		assert.Error(t, err)
+	})
+
+	t.Run("should return error for unsupported version", func(t *testing.T) {
+		var decoded codec.Envelope
+		err := format.Decode([]byte{99}, &decoded)
+		assert.Error(t, err)
+	})
+}
+
+func TestRawFallback(t *testing.T) {
+	registry := orderRegistry()
+	format := newEnveloped(t, codec.JSON(), registry)
+	fallbackFormat := newEnveloped(t, codec.JSON(), codec.NewRegistry(), codec.RawFallback())
+
+	t.Run("should decode unknown event as RawEvent", func(t *testing.T) {
+		envelope := codec.Envelope{
+			Metadata: map[string]string{"key": "value"},
+			Event:    OrderPlaced{OrderID: "1"},
+		}
+		bytes, err := format.Encode(envelope, nil)
+		require.NoError(t, err)
+		var decoded codec.Envelope
+		// when
+		err = fallbackFormat.Decode(bytes, &decoded)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "OrderPlaced", decoded.Type)
+		assert.Equal(t, map[string]string{"key": "value"}, decoded.Metadata)
+		raw, ok := decoded.Event.(codec.RawEvent)
+		require.True(t, ok)
+		assert.Equal(t, "OrderPlaced", raw.Type)
+		assert.JSONEq(t, `{"OrderID":"1","Amount":0}`, string(raw.Data))
+	})
+
+	t.Run("should encode RawEvent without changes", func(t *testing.T) {
+		bytes, err := format.Encode(OrderPlaced{OrderID: "1"}, nil)
+		require.NoError(t, err)
+		var decoded codec.Envelope
+		require.NoError(t, fallbackFormat.Decode(bytes, &decoded))
+		// when
+		encoded, err := fallbackFormat.Encode(decoded, nil)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, bytes, encoded)
+	})
+}
+
+func TestEnvelopeFormat_RoundTrip(t *testing.T) {
+	l := log.New(t.TempDir())
+	writer := openWriter(t, l)
+	c := codec.NewTyped[codec.Envelope](newEnveloped(t, codec.MessagePack(), orderRegistry()))
+	_, err := c.Write(writer, codec.Envelope{Event: OrderPlaced{OrderID: "1"}})
+	require.NoError(t, err)
+	_, err = c.Write(writer, codec.Envelope{Event: OrderCancelled{OrderID: "1"}})
+	require.NoError(t, err)
+	reader := openReader(t, l)
+	// when
+	entries, err := c.ReadAll(reader)
+	// then
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, OrderPlaced{OrderID: "1"}, entries[0].Object.Event)
+	assert.Equal(t, OrderCancelled{OrderID: "1"}, entries[1].Object.Event)
+}
+
+func orderRegistry() *codec.Registry {
+	registry := codec.NewRegistry()
+	registry.MustRegister("OrderPlaced", OrderPlaced{})
+	registry.MustRegister("OrderCancelled", OrderCancelled{})
+
+	return registry
+}
+
+func newEnveloped(t testing.TB, inner codec.Format, registry *codec.Registry,
+	options ...codec.EnvelopeOption) codec.Format {
+	t.Helper()
+
+	format, err := codec.Enveloped(inner, registry, options...)
+	require.NoError(t, err)
+
+	return format
+}
@@ -0,0 +1,67 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package codec
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"reflect"
+
+	"github.com/elgopher/logstore/log"
+)
+
+// Gob returns Format using encoding/gob. Objects are encoded together with their type name, therefore all types
+// written to the log must be registered by passing their sample values. Registered types are decoded into
+// *interface{} as well. Gob panics when type cannot be registered (see gob.Register).
+//
+// Each entry is a self-contained gob stream, so type information is repeated in every entry.
+func Gob(types ...interface{}) Format {
+	for _, t := range types {
+		gob.Register(t)
+	}
+
+	return &gobFormat{}
+}
+
+type gobFormat struct{}
+
+func (g *gobFormat) Encode(input interface{}, output []byte) (out []byte, err error) {
+	buffer := bytes.NewBuffer(output)
+
+	// encoding pointer to interface makes gob write the type name
+	if err = gob.NewEncoder(buffer).Encode(&input); err != nil {
+		return nil, fmt.Errorf("gob encoding failed: %w", err)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func (g *gobFormat) Decode(input []byte, output interface{}) error {
+	outputValue := reflect.ValueOf(output)
+	if outputValue.Kind() != reflect.Pointer || outputValue.IsNil() {
+		return fmt.Errorf("output must be a non-nil pointer: %w", log.ErrInvalidParameter)
+	}
+
+	var decoded interface{}
+	if err := gob.NewDecoder(bytes.NewReader(input)).Decode(&decoded); err != nil {
+		return fmt.Errorf("gob decoding failed: %w", err)
+	}
+
+	target := outputValue.Elem()
+	decodedValue := reflect.ValueOf(decoded)
+
+	switch {
+	case decoded == nil:
+		target.Set(reflect.Zero(target.Type()))
+	case decodedValue.Type().AssignableTo(target.Type()):
+		target.Set(decodedValue)
+	case decodedValue.Kind() == reflect.Pointer && decodedValue.Elem().Type().AssignableTo(target.Type()):
+		target.Set(decodedValue.Elem())
+	default:
+		return fmt.Errorf("cannot decode %s into %s: %w", decodedValue.Type(), target.Type(), log.ErrInvalidParameter)
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package codec_test
+
+import (
+	"testing"
+
+	"github.com/elgopher/logstore/codec"
+	"github.com/elgopher/logstore/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGobFormat(t *testing.T) {
+	format := codec.Gob(GobMessage{}, OtherGobMessage{})
+
+	t.Run("should decode encoded object", func(t *testing.T) {
+		bytes, err := format.Encode(GobMessage{Text: "text", Number: 1}, nil)
+		require.NoError(t, err)
+		var msg GobMessage
+		// when
+		err = format.Decode(bytes, &msg)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, GobMessage{Text: "text", Number: 1}, msg)
+	})
+
+	t.Run("should decode object encoded as pointer", func(t *testing.T) {
+		bytes, err := format.Encode(&GobMessage{Text: "text"}, nil)
+		require.NoError(t, err)
+		var msg GobMessage
+		// when
+		err = format.Decode(bytes, &msg)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, GobMessage{Text: "text"}, msg)
+	})
+
+	t.Run("should decode registered type into interface", func(t *testing.T) {
+		bytes, err := format.Encode(OtherGobMessage{Value: 2}, nil)
+		require.NoError(t, err)
+		var msg interface{}
+		// when
+		err = format.Decode(bytes, &msg)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, OtherGobMessage{Value: 2}, msg)
+	})
+
+	t.Run("should append to output", func(t *testing.T) {
+		output := make([]byte, 1, 256)
+		// when
+		bytes, err := format.Encode(GobMessage{Text: "text"}, output)
+		// then
+		require.NoError(t, err)
+		assert.Same(t, &output[0], &bytes[0], "output slice should be reused")
+		var msg GobMessage
+		require.NoError(t, format.Decode(bytes[1:], &msg))
+		assert.Equal(t, GobMessage{Text: "text"}, msg)
+	})
+
+	t.Run("should return error when type was not registered", func(t *testing.T) {
+		_, err := format.Encode(notRegisteredGobMessage{}, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("should return error when decoding into different type", func(t *testing.T) {
+		bytes, err := format.Encode(GobMessage{}, nil)
+		require.NoError(t, err)
+		var msg OtherGobMessage
+		// when
+		err = format.Decode(bytes, &msg)
+		// then
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error when output is not a pointer", func(t *testing.T) {
+		bytes, err := format.Encode(GobMessage{}, nil)
+		require.NoError(t, err)
+		err = format.Decode(bytes, GobMessage{})
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error for invalid input", func(t *testing.T) {
+		var msg GobMessage
+		err := format.Decode([]byte{1, 2, 3}, &msg)
+		assert.Error(t, err)
+	})
+}
+
+func BenchmarkGobFormat_Encode(b *testing.B) {
+	format := codec.Gob(GobMessage{})
+	msg := GobMessage{Text: "text", Number: 42}
+	output := make([]byte, 0, 256)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, _ = format.Encode(msg, output[:0])
+	}
+}
+
+func BenchmarkGobFormat_Decode(b *testing.B) {
+	format := codec.Gob(GobMessage{})
+	input, err := format.Encode(GobMessage{Text: "text", Number: 42}, nil)
+	require.NoError(b, err)
+
+	var msg GobMessage
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_ = format.Decode(input, &msg)
+	}
+}
+
+type GobMessage struct {
+	Text   string
+	Number int
+}
+
+type OtherGobMessage struct {
+	Value int
+}
+
+type notRegisteredGobMessage struct {
+	Value int
+}
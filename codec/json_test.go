@@ -7,6 +7,8 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/elgopher/logstore/codec"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -37,3 +39,30 @@ func TestJsonFormat_Decode(t *testing.T) {
 type JSONMessage struct {
 	Text string
 }
+
+func BenchmarkJsonFormat_Encode(b *testing.B) {
+	format := codec.JSON()
+	msg := JSONMessage{Text: "message"}
+	output := make([]byte, 0, 64)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, _ = format.Encode(msg, output[:0])
+	}
+}
+
+func BenchmarkJsonFormat_Decode(b *testing.B) {
+	format := codec.JSON()
+	input := []byte(`{"Text":"message"}`)
+
+	var msg JSONMessage
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_ = format.Decode(input, &msg)
+	}
+}
@@ -0,0 +1,1150 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elgopher/logstore/log"
+)
+
+// MessagePack returns Format encoding objects using MessagePack (https://msgpack.org). It is a compact
+// replacement for JSON() supporting booleans, numbers, strings, byte slices, slices, arrays, maps, pointers,
+// time.Time (as timestamp extension, decoded in UTC) and structs.
+//
+// Structs are encoded as maps. Field name can be changed using `msgpack:"name"` tag. Fields with
+// `msgpack:"-"` tag are skipped and fields with `msgpack:",omitempty"` tag are skipped when they are empty.
+// Embedded structs without a tag are inlined.
+//
+// Decoding into interface{} produces nil, bool, int64, uint64, float32, float64, string, []byte, []interface{},
+// map[string]interface{} (or map[interface{}]interface{} when some keys are not strings) and time.Time.
+//
+// Decode returns ErrMaxDepthExceeded when arrays, maps and structs are nested deeper than 1000 levels.
+func MessagePack() Format {
+	return &msgpackFormat{}
+}
+
+// ErrMaxDepthExceeded is returned by MessagePack format when decoded input is nested too deeply.
+var ErrMaxDepthExceeded = errors.New("max nesting depth exceeded")
+
+// msgpackMaxDepth limits recursion, so crafted input cannot exhaust the stack.
+const msgpackMaxDepth = 1000
+
+type msgpackFormat struct{}
+
+func (m *msgpackFormat) Encode(input interface{}, output []byte) (out []byte, err error) {
+	out, err = msgpackEncode(output, reflect.ValueOf(input))
+	if err != nil {
+		return nil, fmt.Errorf("msgpack encoding failed: %w", err)
+	}
+
+	return out, nil
+}
+
+func (m *msgpackFormat) Decode(input []byte, output interface{}) error {
+	outputValue := reflect.ValueOf(output)
+	if outputValue.Kind() != reflect.Pointer || outputValue.IsNil() {
+		return fmt.Errorf("output must be a non-nil pointer: %w", log.ErrInvalidParameter)
+	}
+
+	d := &msgpackDecoder{data: input}
+	if err := d.decode(outputValue.Elem()); err != nil {
+		return fmt.Errorf("msgpack decoding failed: %w", err)
+	}
+
+	if d.pos != len(d.data) {
+		return fmt.Errorf("msgpack decoding failed: %d bytes left after decoding", len(d.data)-d.pos)
+	}
+
+	return nil
+}
+
+const (
+	msgpackNil          byte = 0xc0
+	msgpackFalse        byte = 0xc2
+	msgpackTrue         byte = 0xc3
+	msgpackBin8         byte = 0xc4
+	msgpackBin16        byte = 0xc5
+	msgpackBin32        byte = 0xc6
+	msgpackExt8         byte = 0xc7
+	msgpackExt16        byte = 0xc8
+	msgpackExt32        byte = 0xc9
+	msgpackFloat32      byte = 0xca
+	msgpackFloat64      byte = 0xcb
+	msgpackUint8        byte = 0xcc
+	msgpackUint16       byte = 0xcd
+	msgpackUint32       byte = 0xce
+	msgpackUint64       byte = 0xcf
+	msgpackInt8         byte = 0xd0
+	msgpackInt16        byte = 0xd1
+	msgpackInt32        byte = 0xd2
+	msgpackInt64        byte = 0xd3
+	msgpackFixExt1      byte = 0xd4
+	msgpackFixExt2      byte = 0xd5
+	msgpackFixExt4      byte = 0xd6
+	msgpackFixExt8      byte = 0xd7
+	msgpackFixExt16     byte = 0xd8
+	msgpackStr8         byte = 0xd9
+	msgpackStr16        byte = 0xda
+	msgpackStr32        byte = 0xdb
+	msgpackArray16      byte = 0xdc
+	msgpackArray32      byte = 0xdd
+	msgpackMap16        byte = 0xde
+	msgpackMap32        byte = 0xdf
+	msgpackFixMap       byte = 0x80
+	msgpackFixArray     byte = 0x90
+	msgpackFixStr       byte = 0xa0
+	msgpackNegFixInt    byte = 0xe0
+	msgpackTimestampExt byte = 0xff // -1 as int8
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func msgpackEncode(out []byte, v reflect.Value) ([]byte, error) {
+	if !v.IsValid() {
+		return append(out, msgpackNil), nil
+	}
+
+	if v.Type() == timeType {
+		return appendMsgpackTime(out, v.Interface().(time.Time)), nil //nolint:forcetypeassert
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return append(out, msgpackNil), nil
+		}
+
+		return msgpackEncode(out, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			return append(out, msgpackTrue), nil
+		}
+
+		return append(out, msgpackFalse), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendMsgpackInt(out, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return appendMsgpackUint(out, v.Uint()), nil
+	case reflect.Float32:
+		out = append(out, msgpackFloat32)
+
+		return binary.BigEndian.AppendUint32(out, math.Float32bits(float32(v.Float()))), nil
+	case reflect.Float64:
+		out = append(out, msgpackFloat64)
+
+		return binary.BigEndian.AppendUint64(out, math.Float64bits(v.Float())), nil
+	case reflect.String:
+		return appendMsgpackString(out, v.String()), nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return append(out, msgpackNil), nil
+		}
+
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return appendMsgpackBin(out, v.Bytes()), nil
+		}
+
+		return appendMsgpackArray(out, v)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			bytes := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(bytes), v)
+
+			return appendMsgpackBin(out, bytes), nil
+		}
+
+		return appendMsgpackArray(out, v)
+	case reflect.Map:
+		if v.IsNil() {
+			return append(out, msgpackNil), nil
+		}
+
+		return appendMsgpackMap(out, v)
+	case reflect.Struct:
+		return appendMsgpackStruct(out, v)
+	default:
+		return nil, fmt.Errorf("unsupported type %s: %w", v.Type(), log.ErrInvalidParameter)
+	}
+}
+
+func appendMsgpackInt(out []byte, i int64) []byte {
+	switch {
+	case i >= 0:
+		return appendMsgpackUint(out, uint64(i))
+	case i >= -32:
+		return append(out, byte(i))
+	case i >= math.MinInt8:
+		return append(out, msgpackInt8, byte(i))
+	case i >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(out, msgpackInt16), uint16(i))
+	case i >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(out, msgpackInt32), uint32(i))
+	default:
+		return binary.BigEndian.AppendUint64(append(out, msgpackInt64), uint64(i))
+	}
+}
+
+func appendMsgpackUint(out []byte, u uint64) []byte {
+	switch {
+	case u <= 0x7f:
+		return append(out, byte(u))
+	case u <= math.MaxUint8:
+		return append(out, msgpackUint8, byte(u))
+	case u <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(out, msgpackUint16), uint16(u))
+	case u <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(out, msgpackUint32), uint32(u))
+	default:
+		return binary.BigEndian.AppendUint64(append(out, msgpackUint64), u)
+	}
+}
+
+func appendMsgpackString(out []byte, s string) []byte {
+	out = appendMsgpackHeader(out, len(s), msgpackFixStr, 32, msgpackStr8, msgpackStr16, msgpackStr32)
+
+	return append(out, s...)
+}
+
+func appendMsgpackBin(out []byte, b []byte) []byte {
+	out = appendMsgpackHeader(out, len(b), 0, 0, msgpackBin8, msgpackBin16, msgpackBin32)
+
+	return append(out, b...)
+}
+
+// appendMsgpackHeader appends type and length. Fix variant is used when length is lower than fixLimit.
+// Zero code8 means there is no 8-bit variant.
+func appendMsgpackHeader(out []byte, length int, fixCode byte, fixLimit int, code8, code16, code32 byte) []byte {
+	switch {
+	case length < fixLimit:
+		return append(out, fixCode|byte(length))
+	case code8 != 0 && length <= math.MaxUint8:
+		return append(out, code8, byte(length))
+	case length <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(out, code16), uint16(length))
+	default:
+		return binary.BigEndian.AppendUint32(append(out, code32), uint32(length))
+	}
+}
+
+func appendMsgpackArray(out []byte, v reflect.Value) ([]byte, error) {
+	out = appendMsgpackHeader(out, v.Len(), msgpackFixArray, 16, 0, msgpackArray16, msgpackArray32)
+
+	var err error
+
+	for i := 0; i < v.Len(); i++ {
+		if out, err = msgpackEncode(out, v.Index(i)); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+func appendMsgpackMap(out []byte, v reflect.Value) ([]byte, error) {
+	out = appendMsgpackHeader(out, v.Len(), msgpackFixMap, 16, 0, msgpackMap16, msgpackMap32)
+
+	keys := v.MapKeys()
+	if v.Type().Key().Kind() == reflect.String {
+		// sorting makes the output deterministic
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+	}
+
+	var err error
+
+	for _, key := range keys {
+		if out, err = msgpackEncode(out, key); err != nil {
+			return nil, err
+		}
+
+		if out, err = msgpackEncode(out, v.MapIndex(key)); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+func appendMsgpackStruct(out []byte, v reflect.Value) ([]byte, error) {
+	fields := msgpackFields(v.Type())
+
+	values := make([]reflect.Value, len(fields))
+	count := 0
+
+	for i, field := range fields {
+		fieldValue, ok := fieldByIndex(v, field.index)
+		if !ok || (field.omitEmpty && isEmptyValue(fieldValue)) {
+			continue
+		}
+
+		values[i] = fieldValue
+		count++
+	}
+
+	out = appendMsgpackHeader(out, count, msgpackFixMap, 16, 0, msgpackMap16, msgpackMap32)
+
+	var err error
+
+	for i, field := range fields {
+		if !values[i].IsValid() {
+			continue
+		}
+
+		out = appendMsgpackString(out, field.name)
+
+		if out, err = msgpackEncode(out, values[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// fieldByIndex returns false when the field is inside nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+
+			v = v.Elem()
+		}
+
+		v = v.Field(x)
+	}
+
+	return v, true
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return v.Interface().(time.Time).IsZero() //nolint:forcetypeassert
+		}
+	}
+
+	return false
+}
+
+func appendMsgpackTime(out []byte, t time.Time) []byte {
+	sec := t.Unix()
+	nsec := uint64(t.Nanosecond())
+
+	switch {
+	case uint64(sec)>>34 == 0 && nsec == 0 && sec <= math.MaxUint32:
+		out = append(out, msgpackFixExt4, msgpackTimestampExt)
+
+		return binary.BigEndian.AppendUint32(out, uint32(sec))
+	case uint64(sec)>>34 == 0:
+		out = append(out, msgpackFixExt8, msgpackTimestampExt)
+
+		return binary.BigEndian.AppendUint64(out, nsec<<34|uint64(sec))
+	default:
+		out = append(out, msgpackExt8, 12, msgpackTimestampExt)
+		out = binary.BigEndian.AppendUint32(out, uint32(nsec))
+
+		return binary.BigEndian.AppendUint64(out, uint64(sec))
+	}
+}
+
+type msgpackField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var msgpackFieldsCache sync.Map // map[reflect.Type][]msgpackField
+
+func msgpackFields(t reflect.Type) []msgpackField {
+	if fields, ok := msgpackFieldsCache.Load(t); ok {
+		return fields.([]msgpackField) //nolint:forcetypeassert
+	}
+
+	fields := collectMsgpackFields(t, nil)
+	msgpackFieldsCache.Store(t, fields)
+
+	return fields
+}
+
+func collectMsgpackFields(t reflect.Type, parentIndex []int) []msgpackField {
+	var fields []msgpackField
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("msgpack")
+
+		if tag == "-" {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+		index := append(parentIndex[:len(parentIndex):len(parentIndex)], i)
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+
+		// unexported embedded pointer cannot be allocated during decoding
+		unexportedPointer := !field.IsExported() && field.Type.Kind() == reflect.Pointer
+
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct && fieldType != timeType &&
+			!unexportedPointer {
+			fields = append(fields, collectMsgpackFields(fieldType, index)...)
+
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		fields = append(fields, msgpackField{
+			name:      name,
+			index:     index,
+			omitEmpty: options == "omitempty",
+		})
+	}
+
+	return fields
+}
+
+type msgpackDecoder struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+// enter must be called before decoding elements of array, map or struct. leave must be called after.
+func (d *msgpackDecoder) enter() error {
+	d.depth++
+	if d.depth > msgpackMaxDepth {
+		return fmt.Errorf("more than %d nested levels: %w", msgpackMaxDepth, ErrMaxDepthExceeded)
+	}
+
+	return nil
+}
+
+func (d *msgpackDecoder) leave() {
+	d.depth--
+}
+
+func (d *msgpackDecoder) readByte() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	b := d.data[d.pos]
+	d.pos++
+
+	return b, nil
+}
+
+func (d *msgpackDecoder) peekByte() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	return d.data[d.pos], nil
+}
+
+func (d *msgpackDecoder) readN(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.pos {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+
+	return b, nil
+}
+
+func (d *msgpackDecoder) readUint(size int) (uint64, error) {
+	b, err := d.readN(size)
+	if err != nil {
+		return 0, err
+	}
+
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	default:
+		return binary.BigEndian.Uint64(b), nil
+	}
+}
+
+// readLength reads length of size bytes and checks if there are at least minElementSize*length bytes left.
+func (d *msgpackDecoder) readLength(size int, minElementSize int) (int, error) {
+	length, err := d.readUint(size)
+	if err != nil {
+		return 0, err
+	}
+
+	if length*uint64(minElementSize) > uint64(len(d.data)-d.pos) {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	return int(length), nil
+}
+
+func (d *msgpackDecoder) decode(v reflect.Value) error {
+	code, err := d.peekByte()
+	if err != nil {
+		return err
+	}
+
+	if code == msgpackNil {
+		d.pos++
+		v.Set(reflect.Zero(v.Type()))
+
+		return nil
+	}
+
+	if v.Type() == timeType {
+		t, err := d.readTime()
+		if err != nil {
+			return err
+		}
+
+		v.Set(reflect.ValueOf(t))
+
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+
+		return d.decode(v.Elem())
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return fmt.Errorf("cannot decode into non-empty interface %s: %w", v.Type(), log.ErrInvalidParameter)
+		}
+
+		value, err := d.decodeGeneric()
+		if err != nil {
+			return err
+		}
+
+		if value == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(value))
+		}
+
+		return nil
+	case reflect.Bool:
+		return d.decodeBool(v)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return d.decodeInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return d.decodeUint(v)
+	case reflect.Float32, reflect.Float64:
+		return d.decodeFloat(v)
+	case reflect.String:
+		s, err := d.readStringOrBin()
+		if err != nil {
+			return err
+		}
+
+		v.SetString(string(s))
+
+		return nil
+	case reflect.Slice:
+		return d.decodeSlice(v)
+	case reflect.Array:
+		return d.decodeArray(v)
+	case reflect.Map:
+		return d.decodeMap(v)
+	case reflect.Struct:
+		return d.decodeStruct(v)
+	default:
+		return fmt.Errorf("unsupported type %s: %w", v.Type(), log.ErrInvalidParameter)
+	}
+}
+
+func (d *msgpackDecoder) decodeBool(v reflect.Value) error {
+	code, err := d.readByte()
+	if err != nil {
+		return err
+	}
+
+	switch code {
+	case msgpackTrue:
+		v.SetBool(true)
+	case msgpackFalse:
+		v.SetBool(false)
+	default:
+		return unexpectedCode(code, v.Type())
+	}
+
+	return nil
+}
+
+func (d *msgpackDecoder) decodeInt(v reflect.Value) error {
+	code, err := d.peekByte()
+	if err != nil {
+		return err
+	}
+
+	if !isMsgpackInt(code) {
+		return unexpectedCode(code, v.Type())
+	}
+
+	value, err := d.decodeGeneric()
+	if err != nil {
+		return err
+	}
+
+	var i int64
+
+	switch n := value.(type) {
+	case int64:
+		i = n
+	case uint64:
+		if n > math.MaxInt64 {
+			return fmt.Errorf("value %d overflows %s", n, v.Type())
+		}
+
+		i = int64(n)
+	}
+
+	if v.OverflowInt(i) {
+		return fmt.Errorf("value %d overflows %s", i, v.Type())
+	}
+
+	v.SetInt(i)
+
+	return nil
+}
+
+func (d *msgpackDecoder) decodeUint(v reflect.Value) error {
+	code, err := d.peekByte()
+	if err != nil {
+		return err
+	}
+
+	if !isMsgpackInt(code) {
+		return unexpectedCode(code, v.Type())
+	}
+
+	value, err := d.decodeGeneric()
+	if err != nil {
+		return err
+	}
+
+	var u uint64
+
+	switch n := value.(type) {
+	case int64:
+		if n < 0 {
+			return fmt.Errorf("value %d overflows %s", n, v.Type())
+		}
+
+		u = uint64(n)
+	case uint64:
+		u = n
+	}
+
+	if v.OverflowUint(u) {
+		return fmt.Errorf("value %d overflows %s", u, v.Type())
+	}
+
+	v.SetUint(u)
+
+	return nil
+}
+
+func (d *msgpackDecoder) decodeFloat(v reflect.Value) error {
+	code, err := d.peekByte()
+	if err != nil {
+		return err
+	}
+
+	if !isMsgpackInt(code) && code != msgpackFloat32 && code != msgpackFloat64 {
+		return unexpectedCode(code, v.Type())
+	}
+
+	value, err := d.decodeGeneric()
+	if err != nil {
+		return err
+	}
+
+	switch n := value.(type) {
+	case int64:
+		v.SetFloat(float64(n))
+	case uint64:
+		v.SetFloat(float64(n))
+	case float32:
+		v.SetFloat(float64(n))
+	case float64:
+		v.SetFloat(n)
+	}
+
+	return nil
+}
+
+func (d *msgpackDecoder) decodeSlice(v reflect.Value) error {
+	if v.Type().Elem().Kind() == reflect.Uint8 {
+		b, err := d.readStringOrBin()
+		if err != nil {
+			return err
+		}
+
+		v.SetBytes(append([]byte{}, b...))
+
+		return nil
+	}
+
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+
+	length, err := d.readArrayLength(v.Type())
+	if err != nil {
+		return err
+	}
+
+	slice := reflect.MakeSlice(v.Type(), length, length)
+
+	for i := 0; i < length; i++ {
+		if err = d.decode(slice.Index(i)); err != nil {
+			return err
+		}
+	}
+
+	v.Set(slice)
+
+	return nil
+}
+
+func (d *msgpackDecoder) decodeArray(v reflect.Value) error {
+	if v.Type().Elem().Kind() == reflect.Uint8 {
+		b, err := d.readStringOrBin()
+		if err != nil {
+			return err
+		}
+
+		if len(b) != v.Len() {
+			return fmt.Errorf("cannot decode %d bytes into %s", len(b), v.Type())
+		}
+
+		reflect.Copy(v, reflect.ValueOf(b))
+
+		return nil
+	}
+
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+
+	length, err := d.readArrayLength(v.Type())
+	if err != nil {
+		return err
+	}
+
+	if length != v.Len() {
+		return fmt.Errorf("cannot decode array of %d elements into %s", length, v.Type())
+	}
+
+	for i := 0; i < length; i++ {
+		if err = d.decode(v.Index(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *msgpackDecoder) decodeMap(v reflect.Value) error {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+
+	length, err := d.readMapLength(v.Type())
+	if err != nil {
+		return err
+	}
+
+	m := reflect.MakeMapWithSize(v.Type(), length)
+
+	for i := 0; i < length; i++ {
+		key := reflect.New(v.Type().Key()).Elem()
+		if err = d.decode(key); err != nil {
+			return err
+		}
+
+		value := reflect.New(v.Type().Elem()).Elem()
+		if err = d.decode(value); err != nil {
+			return err
+		}
+
+		m.SetMapIndex(key, value)
+	}
+
+	v.Set(m)
+
+	return nil
+}
+
+func (d *msgpackDecoder) decodeStruct(v reflect.Value) error {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+
+	length, err := d.readMapLength(v.Type())
+	if err != nil {
+		return err
+	}
+
+	fields := msgpackFields(v.Type())
+
+	for i := 0; i < length; i++ {
+		name, err := d.readStringOrBin()
+		if err != nil {
+			return err
+		}
+
+		field, found := findMsgpackField(fields, string(name))
+		if !found {
+			if _, err = d.decodeGeneric(); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err = d.decode(allocatedFieldByIndex(v, field.index)); err != nil {
+			return fmt.Errorf("decoding field %s failed: %w", field.name, err)
+		}
+	}
+
+	return nil
+}
+
+func findMsgpackField(fields []msgpackField, name string) (msgpackField, bool) {
+	for _, field := range fields {
+		if field.name == name {
+			return field, true
+		}
+	}
+
+	for _, field := range fields {
+		if strings.EqualFold(field.name, name) {
+			return field, true
+		}
+	}
+
+	return msgpackField{}, false
+}
+
+// allocatedFieldByIndex returns the field, allocating nil embedded pointers.
+func allocatedFieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+
+			v = v.Elem()
+		}
+
+		v = v.Field(x)
+	}
+
+	return v
+}
+
+func (d *msgpackDecoder) readArrayLength(t reflect.Type) (int, error) {
+	code, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case code&0xf0 == msgpackFixArray:
+		return int(code & 0x0f), nil
+	case code == msgpackArray16:
+		return d.readLength(2, 1)
+	case code == msgpackArray32:
+		return d.readLength(4, 1)
+	default:
+		return 0, unexpectedCode(code, t)
+	}
+}
+
+func (d *msgpackDecoder) readMapLength(t reflect.Type) (int, error) {
+	code, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case code&0xf0 == msgpackFixMap:
+		return int(code & 0x0f), nil
+	case code == msgpackMap16:
+		return d.readLength(2, 2)
+	case code == msgpackMap32:
+		return d.readLength(4, 2)
+	default:
+		return 0, unexpectedCode(code, t)
+	}
+}
+
+// readStringOrBin returns a slice of decoder data. It must be copied before it is retained.
+func (d *msgpackDecoder) readStringOrBin() ([]byte, error) {
+	code, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	var length int
+
+	switch {
+	case code&0xe0 == msgpackFixStr:
+		length = int(code & 0x1f)
+	case code == msgpackStr8 || code == msgpackBin8:
+		length, err = d.readLength(1, 1)
+	case code == msgpackStr16 || code == msgpackBin16:
+		length, err = d.readLength(2, 1)
+	case code == msgpackStr32 || code == msgpackBin32:
+		length, err = d.readLength(4, 1)
+	default:
+		return nil, fmt.Errorf("unexpected msgpack code 0x%x, expected string or binary", code)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return d.readN(length)
+}
+
+func (d *msgpackDecoder) readTime() (time.Time, error) {
+	code, err := d.readByte()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var length int
+
+	switch code {
+	case msgpackFixExt4:
+		length = 4
+	case msgpackFixExt8:
+		length = 8
+	case msgpackExt8:
+		if length, err = d.readLength(1, 1); err != nil {
+			return time.Time{}, err
+		}
+	default:
+		return time.Time{}, unexpectedCode(code, timeType)
+	}
+
+	extType, err := d.readByte()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if extType != msgpackTimestampExt {
+		return time.Time{}, fmt.Errorf("unexpected msgpack extension type %d, expected timestamp", int8(extType))
+	}
+
+	data, err := d.readN(length)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	switch length {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0).UTC(), nil
+	case 8:
+		value := binary.BigEndian.Uint64(data)
+
+		return time.Unix(int64(value&(1<<34-1)), int64(value>>34)).UTC(), nil
+	case 12:
+		nsec := binary.BigEndian.Uint32(data)
+		sec := int64(binary.BigEndian.Uint64(data[4:]))
+
+		return time.Unix(sec, int64(nsec)).UTC(), nil
+	default:
+		return time.Time{}, fmt.Errorf("invalid timestamp length %d", length)
+	}
+}
+
+//nolint:gocyclo
+func (d *msgpackDecoder) decodeGeneric() (interface{}, error) {
+	code, err := d.peekByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case code <= 0x7f:
+		d.pos++
+
+		return int64(code), nil
+	case code >= msgpackNegFixInt:
+		d.pos++
+
+		return int64(int8(code)), nil
+	case code&0xf0 == msgpackFixMap, code == msgpackMap16, code == msgpackMap32:
+		return d.decodeGenericMap()
+	case code&0xf0 == msgpackFixArray, code == msgpackArray16, code == msgpackArray32:
+		var slice []interface{}
+		if err = d.decodeSlice(reflect.ValueOf(&slice).Elem()); err != nil {
+			return nil, err
+		}
+
+		return slice, nil
+	case code&0xe0 == msgpackFixStr, code == msgpackStr8, code == msgpackStr16, code == msgpackStr32:
+		s, err := d.readStringOrBin()
+
+		return string(s), err
+	case code == msgpackBin8, code == msgpackBin16, code == msgpackBin32:
+		b, err := d.readStringOrBin()
+
+		return append([]byte{}, b...), err
+	}
+
+	d.pos++
+
+	switch code {
+	case msgpackNil:
+		return nil, nil
+	case msgpackFalse:
+		return false, nil
+	case msgpackTrue:
+		return true, nil
+	case msgpackUint8, msgpackUint16, msgpackUint32, msgpackUint64:
+		return d.readUint(1 << (code - msgpackUint8))
+	case msgpackInt8, msgpackInt16, msgpackInt32, msgpackInt64:
+		size := 1 << (code - msgpackInt8)
+
+		u, err := d.readUint(size)
+		if err != nil {
+			return nil, err
+		}
+
+		shift := 64 - 8*size
+
+		return int64(u<<shift) >> shift, nil
+	case msgpackFloat32:
+		u, err := d.readUint(4)
+
+		return math.Float32frombits(uint32(u)), err
+	case msgpackFloat64:
+		u, err := d.readUint(8)
+
+		return math.Float64frombits(u), err
+	case msgpackFixExt4, msgpackFixExt8, msgpackExt8:
+		d.pos--
+
+		return d.readTime()
+	case msgpackFixExt1, msgpackFixExt2, msgpackFixExt16, msgpackExt16, msgpackExt32:
+		return nil, fmt.Errorf("unsupported msgpack extension 0x%x", code)
+	default:
+		return nil, fmt.Errorf("invalid msgpack code 0x%x", code)
+	}
+}
+
+func (d *msgpackDecoder) decodeGenericMap() (interface{}, error) {
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+
+	length, err := d.readMapLength(reflect.TypeOf(map[string]interface{}{}))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]interface{}, length)
+	values := make([]interface{}, length)
+	allKeysAreStrings := true
+
+	for i := 0; i < length; i++ {
+		if keys[i], err = d.decodeGeneric(); err != nil {
+			return nil, err
+		}
+
+		if _, ok := keys[i].(string); !ok {
+			allKeysAreStrings = false
+		}
+
+		if values[i], err = d.decodeGeneric(); err != nil {
+			return nil, err
+		}
+	}
+
+	if allKeysAreStrings {
+		m := make(map[string]interface{}, length)
+		for i, key := range keys {
+			m[key.(string)] = values[i] //nolint:forcetypeassert
+		}
+
+		return m, nil
+	}
+
+	m := make(map[interface{}]interface{}, length)
+
+	for i, key := range keys {
+		if key != nil && !reflect.TypeOf(key).Comparable() {
+			return nil, fmt.Errorf("map key of type %T is not supported", key)
+		}
+
+		m[key] = values[i]
+	}
+
+	return m, nil
+}
+
+func isMsgpackInt(code byte) bool {
+	return code <= 0x7f || code >= msgpackNegFixInt ||
+		(code >= msgpackUint8 && code <= msgpackUint64) ||
+		(code >= msgpackInt8 && code <= msgpackInt64)
+}
+
+func unexpectedCode(code byte, t reflect.Type) error {
+	return fmt.Errorf("unexpected msgpack code 0x%x for type %s", code, t)
+}
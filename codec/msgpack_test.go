@@ -0,0 +1,298 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package codec_test
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/elgopher/logstore/codec"
+	"github.com/elgopher/logstore/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type MsgpackMessage struct {
+	Text     string            `msgpack:"text"`
+	Number   int               `msgpack:"number,omitempty"`
+	Ratio    float64           `msgpack:"ratio"`
+	Payload  []byte            `msgpack:"payload"`
+	Tags     []string          `msgpack:"tags"`
+	Labels   map[string]string `msgpack:"labels"`
+	Created  time.Time         `msgpack:"created"`
+	Parent   *MsgpackMessage   `msgpack:"parent,omitempty"`
+	Ignored  string            `msgpack:"-"`
+	Untagged bool
+	MsgpackEmbedded
+}
+
+type MsgpackEmbedded struct {
+	Source string `msgpack:"source"`
+}
+
+func TestMessagePackFormat_Encode(t *testing.T) {
+	format := codec.MessagePack()
+
+	tests := map[string]struct {
+		input    interface{}
+		expected []byte
+	}{
+		"nil":             {input: nil, expected: []byte{0xc0}},
+		"true":            {input: true, expected: []byte{0xc3}},
+		"positive fixint": {input: 7, expected: []byte{0x07}},
+		"negative fixint": {input: -1, expected: []byte{0xff}},
+		"uint8":           {input: 200, expected: []byte{0xcc, 200}},
+		"int16":           {input: -300, expected: []byte{0xd1, 0xfe, 0xd4}},
+		"float64":         {input: 1.5, expected: []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		"fixstr":          {input: "ab", expected: []byte{0xa2, 'a', 'b'}},
+		"bin":             {input: []byte{1, 2}, expected: []byte{0xc4, 2, 1, 2}},
+		"fixarray":        {input: []int{1, 2}, expected: []byte{0x92, 1, 2}},
+		"fixmap":          {input: map[string]int{"b": 2, "a": 1}, expected: []byte{0x82, 0xa1, 'a', 1, 0xa1, 'b', 2}},
+		"timestamp32":     {input: time.Unix(1, 0), expected: []byte{0xd6, 0xff, 0, 0, 0, 1}},
+		"timestamp64": {
+			input:    time.Unix(1, 1),
+			expected: []byte{0xd7, 0xff, 0, 0, 0, 0x04, 0, 0, 0, 1},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// when
+			bytes, err := format.Encode(test.input, nil)
+			// then
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, bytes)
+		})
+	}
+
+	t.Run("should append to output", func(t *testing.T) {
+		output := make([]byte, 1, 256)
+		// when
+		bytes, err := format.Encode(MsgpackMessage{Text: "text"}, output)
+		// then
+		require.NoError(t, err)
+		assert.Same(t, &output[0], &bytes[0], "output slice should be reused")
+	})
+
+	t.Run("should skip empty field with omitempty", func(t *testing.T) {
+		bytes, err := format.Encode(MsgpackMessage{}, nil)
+		require.NoError(t, err)
+		var decoded map[string]interface{}
+		// when
+		err = format.Decode(bytes, &decoded)
+		// then
+		require.NoError(t, err)
+		assert.NotContains(t, decoded, "number")
+		assert.NotContains(t, decoded, "parent")
+		assert.NotContains(t, decoded, "Ignored")
+		assert.Contains(t, decoded, "text")
+		assert.Contains(t, decoded, "Untagged")
+		assert.Contains(t, decoded, "source", "embedded struct should be inlined")
+	})
+
+	t.Run("should return error for unsupported type", func(t *testing.T) {
+		_, err := format.Encode(make(chan int), nil)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+}
+
+func TestMessagePackFormat_Decode(t *testing.T) {
+	format := codec.MessagePack()
+
+	t.Run("should decode encoded struct", func(t *testing.T) {
+		msg := MsgpackMessage{
+			Text:     "text",
+			Number:   -1000,
+			Ratio:    0.25,
+			Payload:  []byte{0, 1, 2},
+			Tags:     []string{"a", "b"},
+			Labels:   map[string]string{"key": "value"},
+			Created:  time.Date(2021, 1, 2, 3, 4, 5, 6, time.UTC),
+			Parent:   &MsgpackMessage{Text: "parent"},
+			Untagged: true,
+			MsgpackEmbedded: MsgpackEmbedded{
+				Source: "source",
+			},
+		}
+		bytes, err := format.Encode(msg, nil)
+		require.NoError(t, err)
+		var decoded MsgpackMessage
+		// when
+		err = format.Decode(bytes, &decoded)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, msg, decoded)
+	})
+
+	t.Run("should decode time before 1970", func(t *testing.T) {
+		created := time.Date(1900, 1, 2, 3, 4, 5, 6, time.UTC)
+		bytes, err := format.Encode(created, nil)
+		require.NoError(t, err)
+		var decoded time.Time
+		// when
+		err = format.Decode(bytes, &decoded)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, created, decoded)
+	})
+
+	t.Run("should decode large numbers", func(t *testing.T) {
+		numbers := []int64{math.MinInt64, math.MinInt32, math.MaxInt32, math.MaxInt64}
+		bytes, err := format.Encode(numbers, nil)
+		require.NoError(t, err)
+		var decoded []int64
+		// when
+		err = format.Decode(bytes, &decoded)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, numbers, decoded)
+	})
+
+	t.Run("should decode into interface", func(t *testing.T) {
+		bytes, err := format.Encode(map[string]interface{}{
+			"int":    -2,
+			"uint":   uint64(math.MaxUint64),
+			"string": "s",
+			"slice":  []int{1},
+			"nil":    nil,
+		}, nil)
+		require.NoError(t, err)
+		var decoded interface{}
+		// when
+		err = format.Decode(bytes, &decoded)
+		// then
+		require.NoError(t, err)
+		expected := map[string]interface{}{
+			"int":    int64(-2),
+			"uint":   uint64(math.MaxUint64),
+			"string": "s",
+			"slice":  []interface{}{int64(1)},
+			"nil":    nil,
+		}
+		assert.Equal(t, expected, decoded)
+	})
+
+	t.Run("should skip unknown fields", func(t *testing.T) {
+		bytes, err := format.Encode(map[string]interface{}{
+			"text":    "text",
+			"unknown": []interface{}{1, "two", map[string]int{"three": 3}},
+		}, nil)
+		require.NoError(t, err)
+		var decoded MsgpackMessage
+		// when
+		err = format.Decode(bytes, &decoded)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, MsgpackMessage{Text: "text"}, decoded)
+	})
+
+	t.Run("should return error when number overflows field", func(t *testing.T) {
+		bytes, err := format.Encode(300, nil)
+		require.NoError(t, err)
+		var decoded int8
+		// when
+		err = format.Decode(bytes, &decoded)
+		// then
+		assert.Error(t, err)
+	})
+
+	t.Run("should return error when type does not match", func(t *testing.T) {
+		bytes, err := format.Encode("text", nil)
+		require.NoError(t, err)
+		var decoded int
+		// when
+		err = format.Decode(bytes, &decoded)
+		// then
+		assert.Error(t, err)
+	})
+
+	t.Run("should return error for truncated input", func(t *testing.T) {
+		bytes, err := format.Encode(MsgpackMessage{Text: "text"}, nil)
+		require.NoError(t, err)
+		var decoded MsgpackMessage
+		// when
+		err = format.Decode(bytes[:len(bytes)-1], &decoded)
+		// then
+		assert.Error(t, err)
+	})
+
+	t.Run("should return error when array length exceeds input", func(t *testing.T) {
+		var decoded []int
+		// when
+		err := format.Decode([]byte{0xdd, 0xff, 0xff, 0xff, 0xff}, &decoded)
+		// then
+		assert.Error(t, err)
+	})
+
+	t.Run("should return error when input is nested too deeply", func(t *testing.T) {
+		nestedArrays := bytes.Repeat([]byte{0x91}, 100000) // arrays with one element
+		var decoded interface{}
+		// when
+		err := format.Decode(append(nestedArrays, 1), &decoded)
+		// then
+		assert.ErrorIs(t, err, codec.ErrMaxDepthExceeded)
+	})
+
+	t.Run("should decode nested arrays up to max depth", func(t *testing.T) {
+		nestedArrays := bytes.Repeat([]byte{0x91}, 1000)
+		var decoded interface{}
+		// when
+		err := format.Decode(append(nestedArrays, 1), &decoded)
+		// then
+		assert.NoError(t, err)
+	})
+
+	t.Run("should return error when output is not a pointer", func(t *testing.T) {
+		err := format.Decode([]byte{1}, MsgpackMessage{})
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+}
+
+func TestMessagePackFormat_RoundTrip(t *testing.T) {
+	l := log.New(t.TempDir())
+	writer, err := l.OpenWriter()
+	require.NoError(t, err)
+	defer writer.Close() //nolint:errcheck
+	c := codec.New(codec.MessagePack())
+	_, err = c.Write(writer, MsgpackMessage{Text: "text", Number: 1})
+	require.NoError(t, err)
+	reader, err := l.OpenReader()
+	require.NoError(t, err)
+	defer reader.Close() //nolint:errcheck
+	var msg MsgpackMessage
+	// when
+	_, err = c.Read(reader, &msg)
+	// then
+	require.NoError(t, err)
+	assert.Equal(t, MsgpackMessage{Text: "text", Number: 1}, msg)
+}
+
+func BenchmarkMessagePackFormat_Encode(b *testing.B) {
+	format := codec.MessagePack()
+	msg := JSONMessage{Text: "message"}
+	output := make([]byte, 0, 64)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, _ = format.Encode(msg, output[:0])
+	}
+}
+
+func BenchmarkMessagePackFormat_Decode(b *testing.B) {
+	format := codec.MessagePack()
+	input, _ := format.Encode(JSONMessage{Text: "message"}, nil)
+
+	var msg JSONMessage
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_ = format.Decode(input, &msg)
+	}
+}
@@ -0,0 +1,131 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package codec
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/elgopher/logstore/log"
+)
+
+func NewRegistry() *Registry {
+	return &Registry{
+		typesByName: map[string]registeredType{},
+		namesByType: map[reflect.Type]string{},
+	}
+}
+
+// Registry maps event type names to Go types. It is safe to use by multiple goroutines.
+type Registry struct {
+	mutex       sync.RWMutex
+	typesByName map[string]registeredType
+	namesByType map[reflect.Type]string
+}
+
+type registeredType struct {
+	t         reflect.Type
+	upcasters []Upcaster
+}
+
+// version returns current schema version.
+func (r registeredType) version() int {
+	return len(r.upcasters) + 1
+}
+
+// Register registers the type of the example under the name with schema version 1. Pointers are dereferenced,
+// so registering Event{} and &Event{} is the same. Both the name and the type can be registered only once.
+func (r *Registry) Register(name string, example interface{}) error {
+	return r.RegisterVersions(name, example)
+}
+
+// RegisterVersions registers the type of the example as the current schema version of the event. Upcasters convert
+// older versions: first upcaster converts version 1 to 2, second 2 to 3 and so on. Therefore, the current version
+// is len(upcasters)+1. The chain is validated during registration: each upcaster must return the type accepted
+// by the next one and the last upcaster must return the type of the example.
+func (r *Registry) RegisterVersions(name string, example interface{}, upcasters ...Upcaster) error {
+	if name == "" {
+		return fmt.Errorf("empty event type name: %w", log.ErrInvalidParameter)
+	}
+
+	t := eventType(example)
+	if t == nil {
+		return fmt.Errorf("nil example: %w", log.ErrInvalidParameter)
+	}
+
+	if err := validateUpcasters(t, upcasters); err != nil {
+		return fmt.Errorf("invalid upcasters for event type %s: %w", name, err)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.typesByName[name]; ok {
+		return fmt.Errorf("event type name %s already registered: %w", name, log.ErrInvalidParameter)
+	}
+
+	if registeredName, ok := r.namesByType[t]; ok {
+		return fmt.Errorf("type %s already registered as %s: %w", t, registeredName, log.ErrInvalidParameter)
+	}
+
+	r.typesByName[name] = registeredType{t: t, upcasters: upcasters}
+	r.namesByType[t] = name
+
+	return nil
+}
+
+// MustRegister is like Register but panics on error.
+func (r *Registry) MustRegister(name string, example interface{}) {
+	if err := r.Register(name, example); err != nil {
+		panic(err)
+	}
+}
+
+// Name returns the name under which the type of the event was registered.
+func (r *Registry) Name(event interface{}) (string, bool) {
+	t := eventType(event)
+	if t == nil {
+		return "", false
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	name, ok := r.namesByType[t]
+
+	return name, ok
+}
+
+// Type returns the Go type registered under the name.
+func (r *Registry) Type(name string) (reflect.Type, bool) {
+	registered, ok := r.registeredType(name)
+
+	return registered.t, ok
+}
+
+// Version returns the current schema version of the event type registered under the name.
+func (r *Registry) Version(name string) (int, bool) {
+	registered, ok := r.registeredType(name)
+
+	return registered.version(), ok
+}
+
+func (r *Registry) registeredType(name string) (registeredType, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	registered, ok := r.typesByName[name]
+
+	return registered, ok
+}
+
+func eventType(event interface{}) reflect.Type {
+	t := reflect.TypeOf(event)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	return t
+}
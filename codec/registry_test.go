@@ -0,0 +1,87 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package codec_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/elgopher/logstore/codec"
+	"github.com/elgopher/logstore/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_Register(t *testing.T) {
+	t.Run("should register type", func(t *testing.T) {
+		registry := codec.NewRegistry()
+		// when
+		err := registry.Register("OrderPlaced", OrderPlaced{})
+		// then
+		require.NoError(t, err)
+		name, ok := registry.Name(OrderPlaced{})
+		assert.True(t, ok)
+		assert.Equal(t, "OrderPlaced", name)
+		typ, ok := registry.Type("OrderPlaced")
+		assert.True(t, ok)
+		assert.Equal(t, reflect.TypeOf(OrderPlaced{}), typ)
+	})
+
+	t.Run("should dereference pointers", func(t *testing.T) {
+		registry := codec.NewRegistry()
+		// when
+		err := registry.Register("OrderPlaced", &OrderPlaced{})
+		// then
+		require.NoError(t, err)
+		name, ok := registry.Name(OrderPlaced{})
+		assert.True(t, ok)
+		assert.Equal(t, "OrderPlaced", name)
+	})
+
+	t.Run("should not find unregistered type", func(t *testing.T) {
+		registry := codec.NewRegistry()
+		// when
+		_, ok := registry.Name(OrderPlaced{})
+		// then
+		assert.False(t, ok)
+	})
+
+	invalid := map[string]struct {
+		name    string
+		example interface{}
+	}{
+		"empty name":     {name: "", example: OrderPlaced{}},
+		"nil example":    {name: "OrderPlaced", example: nil},
+		"duplicate name": {name: "OrderPlaced", example: OrderCancelled{}},
+		"duplicate type": {name: "Other", example: OrderPlaced{}},
+	}
+
+	for name, test := range invalid {
+		t.Run("should return error for "+name, func(t *testing.T) {
+			registry := codec.NewRegistry()
+			registry.MustRegister("OrderPlaced", OrderPlaced{})
+			// when
+			err := registry.Register(test.name, test.example)
+			// then
+			assert.ErrorIs(t, err, log.ErrInvalidParameter)
+		})
+	}
+
+	t.Run("MustRegister should panic on error", func(t *testing.T) {
+		registry := codec.NewRegistry()
+		assert.Panics(t, func() {
+			registry.MustRegister("", OrderPlaced{})
+		})
+	})
+}
+
+type OrderPlaced struct {
+	OrderID string
+	Amount  int
+}
+
+type OrderCancelled struct {
+	OrderID string
+	Reason  string
+}
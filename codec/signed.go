@@ -0,0 +1,148 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package codec
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/elgopher/logstore/log"
+)
+
+var (
+	// ErrInvalidSignature is returned when entry signature does not match its payload.
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrSigningNotSupported is returned when Signer can only verify signatures (see Ed25519Verifier).
+	ErrSigningNotSupported = errors.New("signing not supported")
+)
+
+// Signer signs and verifies payloads. Signatures must have fixed size.
+type Signer interface {
+	// Size returns the size of the signature in bytes.
+	Size() int
+	// AppendSignature appends signature of data to out.
+	AppendSignature(out, data []byte) ([]byte, error)
+	Verify(data, signature []byte) bool
+}
+
+// Signed returns Format appending signature to payloads encoded by inner Format. Decode returns
+// ErrInvalidSignature when the entry was modified or signed using another key.
+func Signed(inner Format, signer Signer) (Format, error) {
+	if inner == nil {
+		return nil, fmt.Errorf("nil inner format: %w", log.ErrInvalidParameter)
+	}
+
+	if signer == nil {
+		return nil, fmt.Errorf("nil signer: %w", log.ErrInvalidParameter)
+	}
+
+	return &signedFormat{inner: inner, signer: signer}, nil
+}
+
+type signedFormat struct {
+	inner  Format
+	signer Signer
+}
+
+func (f *signedFormat) Encode(input interface{}, output []byte) (out []byte, err error) {
+	payloadStart := len(output)
+
+	out, err = appendEncoded(f.inner, input, output)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err = f.signer.AppendSignature(out, out[payloadStart:])
+	if err != nil {
+		return nil, fmt.Errorf("signing failed: %w", err)
+	}
+
+	return out, nil
+}
+
+func (f *signedFormat) Decode(input []byte, output interface{}) error {
+	signatureStart := len(input) - f.signer.Size()
+	if signatureStart < 0 {
+		return fmt.Errorf("entry is shorter than signature: %w", ErrInvalidSignature)
+	}
+
+	payload := input[:signatureStart]
+	if !f.signer.Verify(payload, input[signatureStart:]) {
+		return ErrInvalidSignature
+	}
+
+	return f.inner.Decode(payload, output)
+}
+
+// HMACSigner returns Signer using HMAC-SHA256. The same key is used for signing and verifying.
+func HMACSigner(key []byte) Signer {
+	return &hmacSigner{key: append([]byte{}, key...)}
+}
+
+type hmacSigner struct {
+	key []byte
+}
+
+func (h *hmacSigner) Size() int {
+	return sha256.Size
+}
+
+func (h *hmacSigner) AppendSignature(out, data []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write(data)
+
+	return mac.Sum(out), nil
+}
+
+func (h *hmacSigner) Verify(data, signature []byte) bool {
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write(data)
+
+	return hmac.Equal(mac.Sum(nil), signature)
+}
+
+// Ed25519Signer returns Signer using ed25519 private key. Readers can verify signatures using
+// Ed25519Verifier with the public key.
+func Ed25519Signer(privateKey ed25519.PrivateKey) (Signer, error) {
+	if len(privateKey) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid ed25519 private key size: %w", log.ErrInvalidParameter)
+	}
+
+	publicKey, _ := privateKey.Public().(ed25519.PublicKey)
+
+	return &ed25519Signer{privateKey: privateKey, publicKey: publicKey}, nil
+}
+
+// Ed25519Verifier returns Signer which only verifies signatures. AppendSignature returns ErrSigningNotSupported.
+func Ed25519Verifier(publicKey ed25519.PublicKey) (Signer, error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid ed25519 public key size: %w", log.ErrInvalidParameter)
+	}
+
+	return &ed25519Signer{publicKey: publicKey}, nil
+}
+
+type ed25519Signer struct {
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+}
+
+func (e *ed25519Signer) Size() int {
+	return ed25519.SignatureSize
+}
+
+func (e *ed25519Signer) AppendSignature(out, data []byte) ([]byte, error) {
+	if e.privateKey == nil {
+		return nil, ErrSigningNotSupported
+	}
+
+	return append(out, ed25519.Sign(e.privateKey, data)...), nil
+}
+
+func (e *ed25519Signer) Verify(data, signature []byte) bool {
+	return ed25519.Verify(e.publicKey, data, signature)
+}
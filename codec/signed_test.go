@@ -0,0 +1,163 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package codec_test
+
+import (
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/elgopher/logstore/codec"
+	"github.com/elgopher/logstore/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigned(t *testing.T) {
+	t.Run("should return error when inner format is nil", func(t *testing.T) {
+		_, err := codec.Signed(nil, codec.HMACSigner([]byte("key")))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error when signer is nil", func(t *testing.T) {
+		_, err := codec.Signed(codec.JSON(), nil)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error for invalid ed25519 keys", func(t *testing.T) {
+		_, err := codec.Ed25519Signer([]byte{1})
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+		_, err = codec.Ed25519Verifier([]byte{1})
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+}
+
+func TestSignedFormat(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	signers := map[string]struct {
+		signer   codec.Signer
+		verifier codec.Signer
+		other    codec.Signer
+	}{
+		"hmac": {
+			signer:   codec.HMACSigner([]byte("key")),
+			verifier: codec.HMACSigner([]byte("key")),
+			other:    codec.HMACSigner([]byte("other key")),
+		},
+		"ed25519": {
+			signer:   newEd25519Signer(t, privateKey),
+			verifier: newEd25519Verifier(t, publicKey),
+			other:    newEd25519Verifier(t, otherEd25519PublicKey(t)),
+		},
+	}
+
+	msg := JSONMessage{Text: "text"}
+
+	for name, test := range signers {
+		t.Run(name, func(t *testing.T) {
+			format := newSigned(t, codec.JSON(), test.signer)
+
+			t.Run("should verify signed entry", func(t *testing.T) {
+				signed, err := format.Encode(msg, nil)
+				require.NoError(t, err)
+				var decoded JSONMessage
+				// when
+				err = newSigned(t, codec.JSON(), test.verifier).Decode(signed, &decoded)
+				// then
+				require.NoError(t, err)
+				assert.Equal(t, msg, decoded)
+			})
+
+			t.Run("should return ErrInvalidSignature when entry was modified", func(t *testing.T) {
+				signed, err := format.Encode(msg, nil)
+				require.NoError(t, err)
+				signed[2]++
+				var decoded JSONMessage
+				// when
+				err = format.Decode(signed, &decoded)
+				// then
+				assert.ErrorIs(t, err, codec.ErrInvalidSignature)
+			})
+
+			t.Run("should return ErrInvalidSignature for another key", func(t *testing.T) {
+				signed, err := format.Encode(msg, nil)
+				require.NoError(t, err)
+				var decoded JSONMessage
+				// when
+				err = newSigned(t, codec.JSON(), test.other).Decode(signed, &decoded)
+				// then
+				assert.ErrorIs(t, err, codec.ErrInvalidSignature)
+			})
+
+			t.Run("should return ErrInvalidSignature for too short entry", func(t *testing.T) {
+				var decoded JSONMessage
+				err := format.Decode([]byte{1}, &decoded)
+				assert.ErrorIs(t, err, codec.ErrInvalidSignature)
+			})
+
+			t.Run("should append to output", func(t *testing.T) {
+				output := make([]byte, 1, 256)
+				// when
+				signed, err := newSigned(t, codec.MessagePack(), test.signer).Encode(msg, output)
+				// then
+				require.NoError(t, err)
+				assert.Same(t, &output[0], &signed[0], "output slice should be reused")
+			})
+		})
+	}
+
+	t.Run("should return error when signing using verifier", func(t *testing.T) {
+		_, err := newSigned(t, codec.JSON(), newEd25519Verifier(t, publicKey)).Encode(msg, nil)
+		assert.ErrorIs(t, err, codec.ErrSigningNotSupported)
+	})
+
+	t.Run("should sign encrypted entry", func(t *testing.T) {
+		format := newSigned(t, newEncrypted(t, codec.JSON(), newKeyring(t)), codec.HMACSigner([]byte("key")))
+		signed, err := format.Encode(msg, nil)
+		require.NoError(t, err)
+		var decoded JSONMessage
+		// when
+		err = format.Decode(signed, &decoded)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, msg, decoded)
+	})
+}
+
+func otherEd25519PublicKey(t *testing.T) ed25519.PublicKey {
+	t.Helper()
+
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	return publicKey
+}
+
+func newSigned(t testing.TB, inner codec.Format, signer codec.Signer) codec.Format {
+	t.Helper()
+
+	format, err := codec.Signed(inner, signer)
+	require.NoError(t, err)
+
+	return format
+}
+
+func newEd25519Signer(t testing.TB, privateKey ed25519.PrivateKey) codec.Signer {
+	t.Helper()
+
+	signer, err := codec.Ed25519Signer(privateKey)
+	require.NoError(t, err)
+
+	return signer
+}
+
+func newEd25519Verifier(t testing.TB, publicKey ed25519.PublicKey) codec.Signer {
+	t.Helper()
+
+	verifier, err := codec.Ed25519Verifier(publicKey)
+	require.NoError(t, err)
+
+	return verifier
+}
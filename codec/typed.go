@@ -0,0 +1,84 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elgopher/logstore/log"
+)
+
+func NewTyped[T any](format Format) *Typed[T] {
+	return &Typed[T]{codec: New(format)}
+}
+
+// Typed is a type-safe version of Codec. It writes and reads objects of type T only.
+type Typed[T any] struct {
+	codec *Codec
+}
+
+func (c *Typed[T]) Write(writer Writer, object T) (time.Time, error) {
+	return c.codec.Write(writer, object)
+}
+
+func (c *Typed[T]) WriteWithTime(writer WriterWithTime, t time.Time, object T) error {
+	return c.codec.WriteWithTime(writer, t, object)
+}
+
+// Read reads the next entry and decodes it into a new T. Errors returned by the reader, such as log.ErrEOL,
+// are wrapped.
+func (c *Typed[T]) Read(reader Reader) (time.Time, T, error) {
+	var object T
+
+	t, err := c.codec.Read(reader, &object)
+	if err != nil {
+		var zero T
+
+		return time.Time{}, zero, err
+	}
+
+	return t, object, nil
+}
+
+type Entry[T any] struct {
+	Time   time.Time
+	Object T
+}
+
+// ReadAll reads entries until log.ErrEOL. On error, entries read so far are returned together with the error.
+func (c *Typed[T]) ReadAll(reader Reader) ([]Entry[T], error) {
+	var entries []Entry[T]
+
+	err := c.ForEach(reader, func(t time.Time, object T) error {
+		entries = append(entries, Entry[T]{Time: t, Object: object})
+
+		return nil
+	})
+
+	return entries, err
+}
+
+// ForEach reads entries until log.ErrEOL and runs f for each of them. Iteration stops when f returns error.
+func (c *Typed[T]) ForEach(reader Reader, f func(t time.Time, object T) error) error {
+	if f == nil {
+		return fmt.Errorf("nil function: %w", log.ErrInvalidParameter)
+	}
+
+	for {
+		t, object, err := c.Read(reader)
+		if errors.Is(err, log.ErrEOL) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err = f(t, object); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package codec_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/elgopher/logstore/codec"
+	"github.com/elgopher/logstore/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTyped(t *testing.T) {
+	t.Run("should panic when format is nil", func(t *testing.T) {
+		assert.Panics(t, func() {
+			codec.NewTyped[JSONMessage](nil)
+		})
+	})
+
+	t.Run("should read written object", func(t *testing.T) {
+		l := log.New(t.TempDir())
+		writer := openWriter(t, l)
+		c := codec.NewTyped[JSONMessage](codec.JSON())
+		writtenTime, err := c.Write(writer, JSONMessage{Text: "text"})
+		require.NoError(t, err)
+		reader := openReader(t, l)
+		// when
+		readTime, msg, err := c.Read(reader)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, JSONMessage{Text: "text"}, msg)
+		assert.True(t, writtenTime.Equal(readTime))
+	})
+
+	t.Run("should read pointer", func(t *testing.T) {
+		l := log.New(t.TempDir())
+		writer := openWriter(t, l)
+		c := codec.NewTyped[*JSONMessage](codec.JSON())
+		_, err := c.Write(writer, &JSONMessage{Text: "text"})
+		require.NoError(t, err)
+		reader := openReader(t, l)
+		// when
+		_, msg, err := c.Read(reader)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, &JSONMessage{Text: "text"}, msg)
+	})
+
+	t.Run("should write with time", func(t *testing.T) {
+		l := log.New(t.TempDir())
+		writer := openWriter(t, l)
+		c := codec.NewTyped[JSONMessage](codec.JSON())
+		writtenTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		require.NoError(t, c.WriteWithTime(writer, writtenTime, JSONMessage{Text: "text"}))
+		reader := openReader(t, l)
+		// when
+		readTime, _, err := c.Read(reader)
+		// then
+		require.NoError(t, err)
+		assert.True(t, writtenTime.Equal(readTime))
+	})
+
+	t.Run("should return ErrEOL when there is no more to read", func(t *testing.T) {
+		l := log.New(t.TempDir())
+		_ = openWriter(t, l)
+		c := codec.NewTyped[JSONMessage](codec.JSON())
+		reader := openReader(t, l)
+		// when
+		_, msg, err := c.Read(reader)
+		// then
+		assert.ErrorIs(t, err, log.ErrEOL)
+		assert.Zero(t, msg)
+	})
+
+	t.Run("should read all", func(t *testing.T) {
+		l := log.New(t.TempDir())
+		writer := openWriter(t, l)
+		c := codec.NewTyped[JSONMessage](codec.JSON())
+		time1, err := c.Write(writer, JSONMessage{Text: "1"})
+		require.NoError(t, err)
+		time2, err := c.Write(writer, JSONMessage{Text: "2"})
+		require.NoError(t, err)
+		reader := openReader(t, l)
+		// when
+		entries, err := c.ReadAll(reader)
+		// then
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Equal(t, JSONMessage{Text: "1"}, entries[0].Object)
+		assert.True(t, time1.Equal(entries[0].Time))
+		assert.Equal(t, JSONMessage{Text: "2"}, entries[1].Object)
+		assert.True(t, time2.Equal(entries[1].Time))
+	})
+
+	t.Run("should return entries read before decoding error", func(t *testing.T) {
+		l := log.New(t.TempDir())
+		writer := openWriter(t, l)
+		c := codec.NewTyped[JSONMessage](codec.JSON())
+		_, err := c.Write(writer, JSONMessage{Text: "1"})
+		require.NoError(t, err)
+		_, err = writer.Write([]byte("not json"))
+		require.NoError(t, err)
+		reader := openReader(t, l)
+		// when
+		entries, err := c.ReadAll(reader)
+		// then
+		assert.Error(t, err)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("should stop iteration when function returns error", func(t *testing.T) {
+		l := log.New(t.TempDir())
+		writer := openWriter(t, l)
+		c := codec.NewTyped[JSONMessage](codec.JSON())
+		_, err := c.Write(writer, JSONMessage{Text: "1"})
+		require.NoError(t, err)
+		_, err = c.Write(writer, JSONMessage{Text: "2"})
+		require.NoError(t, err)
+		reader := openReader(t, l)
+		stop := errors.New("stop")
+		var visited []string
+		// when
+		err = c.ForEach(reader, func(t time.Time, msg JSONMessage) error {
+			visited = append(visited, msg.Text)
+
+			return stop
+		})
+		// then
+		assert.ErrorIs(t, err, stop)
+		assert.Equal(t, []string{"1"}, visited)
+	})
+
+	t.Run("should return error for nil function", func(t *testing.T) {
+		c := codec.NewTyped[JSONMessage](codec.JSON())
+		err := c.ForEach(nil, nil)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+}
+
+func openWriter(t *testing.T, l *log.Log) *log.Writer {
+	t.Helper()
+
+	writer, err := l.OpenWriter()
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = writer.Close()
+	})
+
+	return writer
+}
+
+func openReader(t *testing.T, l *log.Log) log.Reader {
+	t.Helper()
+
+	reader, err := l.OpenReader()
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = reader.Close()
+	})
+
+	return reader
+}
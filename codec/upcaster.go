@@ -0,0 +1,92 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package codec
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/elgopher/logstore/log"
+)
+
+// Upcaster converts event from one schema version to the next one. Use Upcast to create it.
+type Upcaster struct {
+	from   reflect.Type
+	to     reflect.Type
+	upcast func(old interface{}) (interface{}, error)
+}
+
+// Upcast creates Upcaster converting event of type From to type To. Old entries are decoded into From,
+// therefore From must have the shape of the old schema version.
+func Upcast[From, To any](f func(From) (To, error)) Upcaster {
+	upcaster := Upcaster{
+		from: reflect.TypeOf((*From)(nil)).Elem(),
+		to:   reflect.TypeOf((*To)(nil)).Elem(),
+	}
+
+	if f != nil {
+		upcaster.upcast = func(old interface{}) (interface{}, error) {
+			return f(old.(From)) //nolint:forcetypeassert
+		}
+	}
+
+	return upcaster
+}
+
+func validateUpcasters(current reflect.Type, upcasters []Upcaster) error {
+	for i, upcaster := range upcasters {
+		fromVersion := i + 1
+
+		if upcaster.upcast == nil {
+			return fmt.Errorf("nil upcaster from version %d: %w", fromVersion, log.ErrInvalidParameter)
+		}
+
+		next := current
+		if i+1 < len(upcasters) {
+			next = upcasters[i+1].from
+		}
+
+		if upcaster.to != next {
+			return fmt.Errorf("upcaster from version %d returns %s, but version %d is %s: %w",
+				fromVersion, upcaster.to, fromVersion+1, next, log.ErrInvalidParameter)
+		}
+	}
+
+	return nil
+}
+
+func (r registeredType) supportsVersion(version int) bool {
+	return version >= 1 && version <= r.version()
+}
+
+// decode decodes payload stored with given schema version and upcasts it to the current version.
+func (r registeredType) decode(format Format, version int, payload []byte) (interface{}, error) {
+	if version == r.version() {
+		event := reflect.New(r.t)
+		if err := format.Decode(payload, event.Interface()); err != nil {
+			return nil, err
+		}
+
+		return event.Elem().Interface(), nil
+	}
+
+	upcasters := r.upcasters[version-1:]
+
+	old := reflect.New(upcasters[0].from)
+	if err := format.Decode(payload, old.Interface()); err != nil {
+		return nil, err
+	}
+
+	event := old.Elem().Interface()
+
+	for i, upcaster := range upcasters {
+		var err error
+
+		if event, err = upcaster.upcast(event); err != nil {
+			return nil, fmt.Errorf("upcasting from version %d failed: %w", version+i, err)
+		}
+	}
+
+	return event, nil
+}
@@ -0,0 +1,196 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package codec_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/elgopher/logstore/codec"
+	"github.com/elgopher/logstore/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type CustomerRegisteredV1 struct {
+	Name string
+}
+
+type CustomerRegisteredV2 struct {
+	FirstName string
+	LastName  string
+}
+
+type CustomerRegistered struct {
+	FirstName string
+	LastName  string
+	Country   string
+}
+
+func upcastCustomerV1(v1 CustomerRegisteredV1) (CustomerRegisteredV2, error) {
+	firstName, lastName, _ := strings.Cut(v1.Name, " ")
+
+	return CustomerRegisteredV2{FirstName: firstName, LastName: lastName}, nil
+}
+
+func upcastCustomerV2(v2 CustomerRegisteredV2) (CustomerRegistered, error) {
+	return CustomerRegistered{FirstName: v2.FirstName, LastName: v2.LastName, Country: "unknown"}, nil
+}
+
+func TestRegistry_RegisterVersions(t *testing.T) {
+	t.Run("should register current version", func(t *testing.T) {
+		registry := codec.NewRegistry()
+		// when
+		err := registry.RegisterVersions("CustomerRegistered", CustomerRegistered{},
+			codec.Upcast(upcastCustomerV1),
+			codec.Upcast(upcastCustomerV2),
+		)
+		// then
+		require.NoError(t, err)
+		version, ok := registry.Version("CustomerRegistered")
+		assert.True(t, ok)
+		assert.Equal(t, 3, version)
+	})
+
+	t.Run("should register version 1 when there are no upcasters", func(t *testing.T) {
+		registry := codec.NewRegistry()
+		registry.MustRegister("CustomerRegistered", CustomerRegistered{})
+		// when
+		version, ok := registry.Version("CustomerRegistered")
+		// then
+		assert.True(t, ok)
+		assert.Equal(t, 1, version)
+	})
+
+	invalidChains := map[string][]codec.Upcaster{
+		"missing upcaster in the middle": {
+			codec.Upcast(upcastCustomerV1),
+		},
+		"upcasters in wrong order": {
+			codec.Upcast(upcastCustomerV2),
+			codec.Upcast(upcastCustomerV1),
+		},
+		"nil upcaster function": {
+			codec.Upcast[CustomerRegisteredV1, CustomerRegisteredV2](nil),
+			codec.Upcast(upcastCustomerV2),
+		},
+	}
+
+	for name, upcasters := range invalidChains {
+		t.Run("should return error for "+name, func(t *testing.T) {
+			registry := codec.NewRegistry()
+			// when
+			err := registry.RegisterVersions("CustomerRegistered", CustomerRegistered{}, upcasters...)
+			// then
+			assert.ErrorIs(t, err, log.ErrInvalidParameter)
+			_, registered := registry.Type("CustomerRegistered")
+			assert.False(t, registered)
+		})
+	}
+}
+
+func TestEnvelopeFormat_Upcasting(t *testing.T) {
+	v1Registry := codec.NewRegistry()
+	v1Registry.MustRegister("CustomerRegistered", CustomerRegisteredV1{})
+	v1Format := newEnveloped(t, codec.JSON(), v1Registry)
+
+	v2Registry := codec.NewRegistry()
+	require.NoError(t, v2Registry.RegisterVersions("CustomerRegistered", CustomerRegisteredV2{},
+		codec.Upcast(upcastCustomerV1),
+	))
+	v2Format := newEnveloped(t, codec.JSON(), v2Registry)
+
+	registry := codec.NewRegistry()
+	require.NoError(t, registry.RegisterVersions("CustomerRegistered", CustomerRegistered{},
+		codec.Upcast(upcastCustomerV1),
+		codec.Upcast(upcastCustomerV2),
+	))
+	format := newEnveloped(t, codec.JSON(), registry)
+
+	expected := CustomerRegistered{FirstName: "John", LastName: "Smith", Country: "unknown"}
+
+	t.Run("should upcast old versions into envelope", func(t *testing.T) {
+		v1, err := v1Format.Encode(CustomerRegisteredV1{Name: "John Smith"}, nil)
+		require.NoError(t, err)
+		v2, err := v2Format.Encode(CustomerRegisteredV2{FirstName: "John", LastName: "Smith"}, nil)
+		require.NoError(t, err)
+		var decoded1, decoded2 codec.Envelope
+		// when
+		err1 := format.Decode(v1, &decoded1)
+		err2 := format.Decode(v2, &decoded2)
+		// then
+		require.NoError(t, err1)
+		require.NoError(t, err2)
+		assert.Equal(t, expected, decoded1.Event)
+		assert.Equal(t, expected, decoded2.Event)
+	})
+
+	t.Run("should upcast old version into current type", func(t *testing.T) {
+		v1, err := v1Format.Encode(CustomerRegisteredV1{Name: "John Smith"}, nil)
+		require.NoError(t, err)
+		var decoded CustomerRegistered
+		// when
+		err = format.Decode(v1, &decoded)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, expected, decoded)
+	})
+
+	t.Run("should decode envelope written without schema version", func(t *testing.T) {
+		legacy := append([]byte{1, 18}, "CustomerRegistered"...)
+		legacy = append(legacy, 0)
+		legacy = append(legacy, `{"Name":"John Smith"}`...)
+		var decoded interface{}
+		// when
+		err := format.Decode(legacy, &decoded)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, expected, decoded)
+	})
+
+	t.Run("should return error for version newer than registered", func(t *testing.T) {
+		current, err := format.Encode(expected, nil)
+		require.NoError(t, err)
+		var decoded codec.Envelope
+		// when
+		err = v2Format.Decode(current, &decoded)
+		// then
+		assert.ErrorIs(t, err, codec.ErrUnknownEventType)
+	})
+
+	t.Run("should decode version newer than registered as RawEvent", func(t *testing.T) {
+		current, err := format.Encode(expected, nil)
+		require.NoError(t, err)
+		fallbackFormat := newEnveloped(t, codec.JSON(), v2Registry, codec.RawFallback())
+		var decoded codec.Envelope
+		// when
+		err = fallbackFormat.Decode(current, &decoded)
+		// then
+		require.NoError(t, err)
+		raw, ok := decoded.Event.(codec.RawEvent)
+		require.True(t, ok)
+		assert.Equal(t, 3, raw.Version)
+		reencoded, err := fallbackFormat.Encode(decoded, nil)
+		require.NoError(t, err)
+		assert.Equal(t, current, reencoded)
+	})
+
+	t.Run("should return upcaster error", func(t *testing.T) {
+		upcasterErr := errors.New("upcaster error")
+		failingRegistry := codec.NewRegistry()
+		require.NoError(t, failingRegistry.RegisterVersions("CustomerRegistered", CustomerRegisteredV2{},
+			codec.Upcast(func(CustomerRegisteredV1) (CustomerRegisteredV2, error) {
+				return CustomerRegisteredV2{}, upcasterErr
+			}),
+		))
+		v1, err := v1Format.Encode(CustomerRegisteredV1{Name: "John Smith"}, nil)
+		require.NoError(t, err)
+		var decoded interface{}
+		// when
+		err = newEnveloped(t, codec.JSON(), failingRegistry).Decode(v1, &decoded)
+		// then
+		assert.ErrorIs(t, err, upcasterErr)
+	})
+}
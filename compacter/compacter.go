@@ -6,7 +6,8 @@ package compacter
 import (
 	"context"
 	"fmt"
-	stdlog "log"
+	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/elgopher/logstore/log"
@@ -39,12 +40,37 @@ type Log interface {
 }
 
 type Results struct {
-	SegmentsRemoved []log.Segment
+	SegmentsRemoved   []log.Segment
+	SegmentsRewritten []log.Segment
+	SegmentsArchived  []log.Segment
+	SegmentsMerged    []log.Segment
+	EntriesRemoved    int
+	BytesFreed        int64
+	// BytesFreedByPolicy contains bytes of removed segments by policy name. Segment required by many policies
+	// is counted for each of them.
+	BytesFreedByPolicy map[string]int64
+}
+
+func (r *Results) addBytesFreedByPolicy(policy string, bytes int64) {
+	if r.BytesFreedByPolicy == nil {
+		r.BytesFreedByPolicy = map[string]int64{}
+	}
+
+	r.BytesFreedByPolicy[policy] += bytes
 }
 
 func Start(ctx context.Context, l Log, options ...Option) error {
+	c, err := New(l, options...)
+	if err != nil {
+		return err
+	}
+
+	return c.Run(ctx)
+}
+
+func New(l Log, options ...Option) (*Compacter, error) {
 	if l == nil {
-		return fmt.Errorf("nil log: %w", log.ErrInvalidParameter)
+		return nil, fmt.Errorf("nil log: %w", log.ErrInvalidParameter)
 	}
 
 	const sevenDays = time.Hour * 24 * 7
@@ -52,39 +78,213 @@ func Start(ctx context.Context, l Log, options ...Option) error {
 	settings := &Settings{
 		interval:  time.Hour,
 		retention: sevenDays,
+		now:       time.Now,
+		after:     time.After,
+		logger:    slog.Default(),
+		onError:   func(error) {},
+		onRemoved: func(log.Segment) {},
+		observer:  nopObserver{},
 	}
 
 	for _, applyOption := range options {
+		if applyOption == nil {
+			continue
+		}
+
 		if err := applyOption(settings); err != nil {
-			return fmt.Errorf("error applying option: %w", err)
+			return nil, fmt.Errorf("error applying option: %w", err)
 		}
 	}
 
+	if _, ok := l.(ArchiveLog); settings.archive != nil && !ok {
+		return nil, fmt.Errorf("log does not support archiving: %w", log.ErrInvalidParameter)
+	}
+
+	if _, ok := l.(MergeLog); settings.mergeMaxSizeBytes > 0 && !ok {
+		return nil, fmt.Errorf("log does not support merging: %w", log.ErrInvalidParameter)
+	}
+
+	return &Compacter{
+		log:      l,
+		settings: settings,
+		trigger:  make(chan struct{}, 1),
+	}, nil
+}
+
+// Compacter compacts the log periodically in the background.
+type Compacter struct {
+	log      Log
+	settings *Settings
+	trigger  chan struct{}
+
+	mutex   sync.Mutex
+	lastRun RunStats
+}
+
+type RunStats struct {
+	StartedAt time.Time
+	Duration  time.Duration
+	Results   Results
+	// Plan is only available in DryRun mode
+	Plan CompactionPlan
+	Err  error
+}
+
+// Run compacts the log every interval until ctx is cancelled.
+func (c *Compacter) Run(ctx context.Context) error {
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
-		case <-time.After(settings.interval):
-			olderThan := time.Now().Add(-settings.retention)
-
-			results, err := RemoveOldSegments(l, olderThan)
-			if err != nil {
-				stdlog.Printf("compacter.RemoveOldSegments failed: %s", err)
-			} else {
-				count := len(results.SegmentsRemoved)
-				if count > 0 {
-					stdlog.Printf("%d segments removed older than %s", count, olderThan)
-				}
-			}
+		case <-c.settings.after(c.settings.interval):
+			c.compact()
+		case <-c.trigger:
+			c.compact()
 		}
 	}
 }
 
+// TriggerNow makes Run compact the log immediately, without waiting for the interval to pass. It does not block.
+func (c *Compacter) TriggerNow() {
+	select {
+	case c.trigger <- struct{}{}:
+	default:
+		// compaction is already triggered
+	}
+}
+
+func (c *Compacter) LastRun() RunStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.lastRun
+}
+
+func (c *Compacter) policies() []Policy {
+	return append([]Policy{MaxAge(c.settings.retention)}, c.settings.policies...)
+}
+
+func (c *Compacter) compact() {
+	if c.settings.dryRun {
+		c.planOnly()
+
+		return
+	}
+
+	settings := c.settings
+	startedAt := settings.now()
+	policies := c.policies()
+
+	var (
+		results Results
+		err     error
+	)
+
+	if settings.archive != nil {
+		results, err = ArchiveSegments(c.log.(ArchiveLog), settings.archive, startedAt, policies...)
+	} else {
+		results, err = RemoveSegments(c.log, startedAt, policies...)
+	}
+
+	if err == nil && settings.mergeMaxSizeBytes > 0 {
+		var mergeResults Results
+
+		mergeResults, err = MergeSmallSegments(c.log.(MergeLog), settings.mergeMaxSizeBytes)
+		results.SegmentsMerged = mergeResults.SegmentsMerged
+		results.EntriesRemoved += mergeResults.EntriesRemoved
+		results.BytesFreed += mergeResults.BytesFreed
+	}
+
+	stats := RunStats{
+		StartedAt: startedAt,
+		Duration:  settings.now().Sub(startedAt),
+		Results:   results,
+		Err:       err,
+	}
+
+	c.mutex.Lock()
+	c.lastRun = stats
+	c.mutex.Unlock()
+
+	settings.observer.Compacted(stats)
+
+	for _, segment := range results.SegmentsRemoved {
+		settings.onRemoved(segment)
+	}
+
+	for _, segment := range results.SegmentsArchived {
+		settings.onRemoved(segment)
+	}
+
+	if err != nil {
+		settings.logger.Error("compaction failed", "err", err)
+		settings.onError(err)
+
+		return
+	}
+
+	if count := len(results.SegmentsRemoved) + len(results.SegmentsArchived) + len(results.SegmentsMerged); count > 0 {
+		settings.logger.Info("log compacted",
+			"segmentsRemoved", len(results.SegmentsRemoved),
+			"segmentsArchived", len(results.SegmentsArchived),
+			"segmentsMerged", len(results.SegmentsMerged),
+			"bytesFreed", results.BytesFreed,
+			"duration", stats.Duration,
+		)
+	}
+}
+
+func (c *Compacter) planOnly() {
+	settings := c.settings
+	startedAt := settings.now()
+	plan, err := c.Plan()
+
+	stats := RunStats{
+		StartedAt: startedAt,
+		Duration:  settings.now().Sub(startedAt),
+		Plan:      plan,
+		Err:       err,
+	}
+
+	c.mutex.Lock()
+	c.lastRun = stats
+	c.mutex.Unlock()
+
+	settings.observer.Compacted(stats)
+
+	if err != nil {
+		settings.logger.Error("compaction planning failed", "err", err)
+		settings.onError(err)
+
+		return
+	}
+
+	for _, action := range plan.Actions {
+		settings.logger.Info("dry run: segment would be compacted",
+			"action", action.Action,
+			"segment", action.Segment.StartingAt,
+			"sizeBytes", action.Segment.SizeBytes,
+			"reason", action.Reason,
+		)
+	}
+}
+
 type Option func(*Settings) error
 
 type Settings struct {
 	interval  time.Duration
 	retention time.Duration
+	policies  []Policy
+	archive   *log.Log
+	now       func() time.Time
+	after     func(time.Duration) <-chan time.Time
+	logger    *slog.Logger
+	onError   func(error)
+	onRemoved func(log.Segment)
+	observer  Observer
+
+	mergeMaxSizeBytes int64
+	dryRun            bool
 }
 
 func Interval(duration time.Duration) Option {
@@ -102,3 +302,125 @@ func Retention(duration time.Duration) Option {
 		return nil
 	}
 }
+
+// Policies adds policies which are applied together with Retention.
+func Policies(policies ...Policy) Option {
+	return func(s *Settings) error {
+		s.policies = append(s.policies, policies...)
+
+		return nil
+	}
+}
+
+// ArchiveTo moves segments to the archive instead of removing them.
+func ArchiveTo(archive *log.Log) Option {
+	return func(s *Settings) error {
+		if archive == nil {
+			return fmt.Errorf("nil archive: %w", log.ErrInvalidParameter)
+		}
+
+		s.archive = archive
+
+		return nil
+	}
+}
+
+func NowFunc(f func() time.Time) Option {
+	return func(s *Settings) error {
+		if f == nil {
+			return fmt.Errorf("nil now function: %w", log.ErrInvalidParameter)
+		}
+
+		s.now = f
+
+		return nil
+	}
+}
+
+// AfterFunc replaces time.After used for waiting between compactions.
+func AfterFunc(f func(time.Duration) <-chan time.Time) Option {
+	return func(s *Settings) error {
+		if f == nil {
+			return fmt.Errorf("nil after function: %w", log.ErrInvalidParameter)
+		}
+
+		s.after = f
+
+		return nil
+	}
+}
+
+func Logger(logger *slog.Logger) Option {
+	return func(s *Settings) error {
+		if logger == nil {
+			return fmt.Errorf("nil logger: %w", log.ErrInvalidParameter)
+		}
+
+		s.logger = logger
+
+		return nil
+	}
+}
+
+// OnError registers a function called when compaction run by Compacter failed.
+func OnError(f func(error)) Option {
+	return func(s *Settings) error {
+		if f == nil {
+			return fmt.Errorf("nil error function: %w", log.ErrInvalidParameter)
+		}
+
+		s.onError = f
+
+		return nil
+	}
+}
+
+// OnRemoved registers a function called for each segment removed or archived by Compacter.
+func OnRemoved(f func(log.Segment)) Option {
+	return func(s *Settings) error {
+		if f == nil {
+			return fmt.Errorf("nil removed function: %w", log.ErrInvalidParameter)
+		}
+
+		s.onRemoved = f
+
+		return nil
+	}
+}
+
+// MergeSegmentsUpTo makes Compacter merge adjacent small segments into segments no larger than maxSizeBytes.
+// See MergeSmallSegments.
+func MergeSegmentsUpTo(maxSizeBytes int64) Option {
+	return func(s *Settings) error {
+		if maxSizeBytes <= 0 {
+			return fmt.Errorf("max size must be positive: %w", log.ErrInvalidParameter)
+		}
+
+		s.mergeMaxSizeBytes = maxSizeBytes
+
+		return nil
+	}
+}
+
+// Observer receives results of each compaction run by Compacter. It can be used to collect metrics. In DryRun mode
+// only the plan is reported.
+type Observer interface {
+	Compacted(stats RunStats)
+}
+
+// Observe registers an observer receiving results of each compaction.
+func Observe(observer Observer) Option {
+	return func(s *Settings) error {
+		if observer == nil {
+			return fmt.Errorf("nil observer: %w", log.ErrInvalidParameter)
+		}
+
+		s.observer = observer
+
+		return nil
+	}
+}
+
+type nopObserver struct{}
+
+func (nopObserver) Compacted(RunStats) {}
@@ -4,7 +4,9 @@
 package compacter_test
 
 import (
+	"bytes"
 	"context"
+	"log/slog"
 	"testing"
 	"time"
 
@@ -99,6 +101,271 @@ func TestStart(t *testing.T) {
 	})
 }
 
+func TestPolicies(t *testing.T) {
+	t.Run("should apply policies together with retention", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentSizeMB(1))
+		ctx, cancel := context.WithCancel(context.Background())
+		async := tests.RunAsync(func() {
+			_ = compacter.Start(ctx, l,
+				compacter.Interval(time.Millisecond),
+				compacter.Retention(time.Hour),
+				compacter.Policies(maxSegmentsPolicy(t, 2)),
+			)
+		})
+		// when
+		tests.WriteEntry(t, writer, tests.OneMegabyte)
+		tests.WriteEntry(t, writer, tests.OneMegabyte)
+		tests.WriteEntry(t, writer, tests.OneMegabyte)
+		// then
+		assert.Eventually(t, numberOfSegments(l, 2), 100*time.Millisecond, time.Millisecond)
+		// cleanup
+		cancel()
+		async.WaitOrFailAfter(t, time.Second)
+	})
+}
+
+func TestArchiveTo(t *testing.T) {
+	t.Run("should return error for nil archive", func(t *testing.T) {
+		l := log.New(tests.TempDir(t))
+		err := compacter.Start(context.Background(), l, compacter.ArchiveTo(nil))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should continuously archive segments in the background", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentSizeMB(1))
+		archive := log.New(tests.TempDir(t))
+		ctx, cancel := context.WithCancel(context.Background())
+		async := tests.RunAsync(func() {
+			_ = compacter.Start(ctx, l,
+				compacter.Interval(time.Millisecond),
+				compacter.Retention(time.Millisecond),
+				compacter.ArchiveTo(archive),
+			)
+		})
+		// when
+		tests.WriteEntry(t, writer, tests.OneMegabyte)
+		tests.WriteEntry(t, writer, tests.OneMegabyte)
+		// then
+		assert.Eventually(t, numberOfSegments(archive, 2), 100*time.Millisecond, time.Millisecond)
+		// cleanup
+		cancel()
+		async.WaitOrFailAfter(t, time.Second)
+	})
+}
+
+func TestNew(t *testing.T) {
+	t.Run("should return error for nil log", func(t *testing.T) {
+		c, err := compacter.New(nil)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+		assert.Nil(t, c)
+	})
+
+	t.Run("should skip nil option", func(t *testing.T) {
+		c, err := compacter.New(log.New(tests.TempDir(t)), nil)
+		require.NoError(t, err)
+		assert.NotNil(t, c)
+	})
+
+	t.Run("should return error for nil logger", func(t *testing.T) {
+		_, err := compacter.New(log.New(tests.TempDir(t)), compacter.Logger(nil))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error for nil functions", func(t *testing.T) {
+		_, err := compacter.New(log.New(tests.TempDir(t)), compacter.OnError(nil))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+		_, err = compacter.New(log.New(tests.TempDir(t)), compacter.OnRemoved(nil))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+		_, err = compacter.New(log.New(tests.TempDir(t)), compacter.NowFunc(nil))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+		_, err = compacter.New(log.New(tests.TempDir(t)), compacter.AfterFunc(nil))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+}
+
+func TestCompacter_Run(t *testing.T) {
+	t.Run("should compact log once interval passed", func(t *testing.T) {
+		l := writeMegabyteSegments(t, 3)
+		ticks := make(chan time.Time)
+		c, err := compacter.New(l,
+			compacter.Retention(time.Nanosecond),
+			compacter.AfterFunc(func(time.Duration) <-chan time.Time { return ticks }),
+		)
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		async := tests.RunAsync(func() {
+			_ = c.Run(ctx)
+		})
+		// when
+		ticks <- time.Now()
+		ticks <- time.Now() // second tick is received once first compaction has finished
+		// then
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		assert.Len(t, segments, 1)
+		// cleanup
+		cancel()
+		async.WaitOrFailAfter(t, time.Second)
+	})
+
+	t.Run("should compact log when triggered", func(t *testing.T) {
+		l := writeMegabyteSegments(t, 3)
+		c := newCompacterWaitingForever(t, l, compacter.Retention(time.Nanosecond))
+		ctx, cancel := context.WithCancel(context.Background())
+		async := tests.RunAsync(func() {
+			_ = c.Run(ctx)
+		})
+		// when
+		c.TriggerNow()
+		// then
+		assert.Eventually(t, numberOfSegments(l, 1), time.Second, time.Millisecond)
+		// cleanup
+		cancel()
+		async.WaitOrFailAfter(t, time.Second)
+	})
+
+	t.Run("should report last run", func(t *testing.T) {
+		l := writeMegabyteSegments(t, 3)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		currentTime := time.Now()
+		clock := &tests.Clock{CurrentTime: &currentTime}
+		c := newCompacterWaitingForever(t, l,
+			compacter.Retention(time.Nanosecond),
+			compacter.NowFunc(clock.Now),
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		async := tests.RunAsync(func() {
+			_ = c.Run(ctx)
+		})
+		// when
+		c.TriggerNow()
+		// then
+		assert.Eventually(t, func() bool {
+			return !c.LastRun().StartedAt.IsZero()
+		}, time.Second, time.Millisecond)
+		lastRun := c.LastRun()
+		assert.Equal(t, currentTime, lastRun.StartedAt)
+		assert.NoError(t, lastRun.Err)
+		assert.Equal(t, segments[:len(segments)-1], lastRun.Results.SegmentsRemoved)
+		assert.Positive(t, lastRun.Results.BytesFreed)
+		// cleanup
+		cancel()
+		async.WaitOrFailAfter(t, time.Second)
+	})
+
+	t.Run("should notify about removed segments", func(t *testing.T) {
+		l := writeMegabyteSegments(t, 2)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		removed := make(chan log.Segment, len(segments))
+		c := newCompacterWaitingForever(t, l,
+			compacter.Retention(time.Nanosecond),
+			compacter.OnRemoved(func(segment log.Segment) {
+				removed <- segment
+			}),
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		async := tests.RunAsync(func() {
+			_ = c.Run(ctx)
+		})
+		// when
+		c.TriggerNow()
+		// then
+		assert.Equal(t, segments[0], <-removed)
+		assert.Equal(t, segments[1], <-removed)
+		// cleanup
+		cancel()
+		async.WaitOrFailAfter(t, time.Second)
+	})
+
+	t.Run("should notify observer", func(t *testing.T) {
+		l := writeMegabyteSegments(t, 2)
+		observer := &compactionObserver{stats: make(chan compacter.RunStats, 1)}
+		c := newCompacterWaitingForever(t, l,
+			compacter.Retention(time.Nanosecond),
+			compacter.Observe(observer),
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		async := tests.RunAsync(func() {
+			_ = c.Run(ctx)
+		})
+		// when
+		c.TriggerNow()
+		// then
+		stats := <-observer.stats
+		assert.Len(t, stats.Results.SegmentsRemoved, 2)
+		cancel()
+		async.WaitOrFailAfter(t, time.Second)
+	})
+
+	t.Run("should notify and log error", func(t *testing.T) {
+		errs := make(chan error, 1)
+		logs := &bytes.Buffer{}
+		c := newCompacterWaitingForever(t, failingLog{},
+			compacter.OnError(func(err error) {
+				errs <- err
+			}),
+			compacter.Logger(slog.New(slog.NewTextHandler(logs, nil))),
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		async := tests.RunAsync(func() {
+			_ = c.Run(ctx)
+		})
+		// when
+		c.TriggerNow()
+		// then
+		assert.ErrorIs(t, <-errs, tests.ErrFixed)
+		cancel()
+		async.WaitOrFailAfter(t, time.Second)
+		assert.Contains(t, logs.String(), "compaction failed")
+		assert.ErrorIs(t, c.LastRun().Err, tests.ErrFixed)
+	})
+}
+
+func TestMergeSegmentsUpTo(t *testing.T) {
+	t.Run("should return error for non-positive size", func(t *testing.T) {
+		_, err := compacter.New(log.New(tests.TempDir(t)), compacter.MergeSegmentsUpTo(0))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should merge segments in the background", func(t *testing.T) {
+		l := writeMegabyteSegments(t, 4)
+		c := newCompacterWaitingForever(t, l, compacter.MergeSegmentsUpTo(10*tests.OneMegabyte))
+		ctx, cancel := context.WithCancel(context.Background())
+		async := tests.RunAsync(func() {
+			_ = c.Run(ctx)
+		})
+		// when
+		c.TriggerNow()
+		// then
+		assert.Eventually(t, numberOfSegments(l, 2), time.Second, time.Millisecond)
+		// cleanup
+		cancel()
+		async.WaitOrFailAfter(t, time.Second)
+	})
+}
+
+func newCompacterWaitingForever(t *testing.T, l compacter.Log, options ...compacter.Option) *compacter.Compacter {
+	t.Helper()
+
+	never := func(time.Duration) <-chan time.Time { return nil }
+	c, err := compacter.New(l, append(options, compacter.AfterFunc(never))...)
+	require.NoError(t, err)
+
+	return c
+}
+
+type failingLog struct{}
+
+func (f failingLog) Segments() ([]log.Segment, error) {
+	return nil, tests.ErrFixed
+}
+
+func (f failingLog) RemoveSegmentStartingAt(time.Time) error {
+	return tests.ErrFixed
+}
+
 func numberOfSegments(l *log.Log, expected int) func() bool {
 	return func() bool {
 		segments, err := l.Segments()
@@ -109,3 +376,11 @@ func numberOfSegments(l *log.Log, expected int) func() bool {
 		return len(segments) == expected
 	}
 }
+
+type compactionObserver struct {
+	stats chan compacter.RunStats
+}
+
+func (o *compactionObserver) Compacted(stats compacter.RunStats) {
+	o.stats <- stats
+}
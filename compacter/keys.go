@@ -0,0 +1,166 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package compacter
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elgopher/logstore/log"
+)
+
+// KeyFunc extracts the key from entry data. Entries without a key (ok=false) are never removed.
+type KeyFunc func(data []byte) (key string, ok bool)
+
+type KeyLog interface {
+	Log
+	OpenReader(options ...log.OpenReaderOption) (log.Reader, error)
+	FilterSegmentStartingAt(t time.Time, keep func(t time.Time, data []byte) bool) (kept, removed int, err error)
+}
+
+// CompactKeys rewrites sealed segments (all except the last one), so only the latest entry per key survives.
+// Entries keep their original time. Segments which became empty are removed.
+func CompactKeys(l KeyLog, key KeyFunc, options ...KeyOption) (Results, error) {
+	if l == nil {
+		return Results{}, fmt.Errorf("nil log: %w", log.ErrInvalidParameter)
+	}
+
+	if key == nil {
+		return Results{}, fmt.Errorf("nil key func: %w", log.ErrInvalidParameter)
+	}
+
+	settings := &KeySettings{
+		isTombstone: func([]byte) bool { return false },
+	}
+
+	for _, applyOption := range options {
+		if applyOption == nil {
+			continue
+		}
+
+		if err := applyOption(settings); err != nil {
+			return Results{}, fmt.Errorf("error applying option: %w", err)
+		}
+	}
+
+	segments, err := l.Segments()
+	if err != nil {
+		return Results{}, fmt.Errorf("listing segments failed: %w", err)
+	}
+
+	if len(segments) < 2 {
+		return Results{}, nil
+	}
+
+	latest, err := latestEntryTimePerKey(l, key)
+	if err != nil {
+		return Results{}, err
+	}
+
+	keep := func(t time.Time, data []byte) bool {
+		k, ok := key(data)
+		if !ok {
+			return true
+		}
+
+		if !latest[k].Equal(t) {
+			return false
+		}
+
+		return !settings.isTombstone(data) || !t.Before(settings.dropTombstonesBefore)
+	}
+
+	res := Results{}
+	sealed := segments[:len(segments)-1]
+
+	for _, segment := range sealed {
+		kept, removed, err := l.FilterSegmentStartingAt(segment.StartingAt, keep)
+		if err != nil {
+			return res, fmt.Errorf("rewriting segment failed: %w", err)
+		}
+
+		if removed == 0 {
+			continue
+		}
+
+		res.EntriesRemoved += removed
+
+		if kept > 0 {
+			res.SegmentsRewritten = append(res.SegmentsRewritten, segment)
+
+			continue
+		}
+
+		if err = l.RemoveSegmentStartingAt(segment.StartingAt); err != nil {
+			return res, fmt.Errorf("removing empty segment failed: %w", err)
+		}
+
+		res.SegmentsRemoved = append(res.SegmentsRemoved, segment)
+	}
+
+	return res, nil
+}
+
+func latestEntryTimePerKey(l KeyLog, key KeyFunc) (map[string]time.Time, error) {
+	reader, err := l.OpenReader()
+	if err != nil {
+		return nil, fmt.Errorf("opening reader failed: %w", err)
+	}
+
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	latest := map[string]time.Time{}
+
+	for {
+		t, data, err := reader.Read()
+		if errors.Is(err, log.ErrEOL) {
+			return latest, nil
+		}
+
+		if errors.Is(err, log.ErrSegmentCompacted) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("reading entry failed: %w", err)
+		}
+
+		if k, ok := key(data); ok {
+			latest[k] = t
+		}
+	}
+}
+
+type KeyOption func(*KeySettings) error
+
+type KeySettings struct {
+	isTombstone          func(data []byte) bool
+	dropTombstonesBefore time.Time
+}
+
+// Tombstone marks entries deleting the key. Older entries with the same key are removed, but the tombstone itself
+// is kept, so readers can still find out that the key was deleted. See DropTombstonesBefore.
+func Tombstone(isTombstone func(data []byte) bool) KeyOption {
+	return func(s *KeySettings) error {
+		if isTombstone == nil {
+			return fmt.Errorf("nil tombstone func: %w", log.ErrInvalidParameter)
+		}
+
+		s.isTombstone = isTombstone
+
+		return nil
+	}
+}
+
+// DropTombstonesBefore removes tombstones written before t.
+func DropTombstonesBefore(t time.Time) KeyOption {
+	return func(s *KeySettings) error {
+		s.dropTombstonesBefore = t
+
+		return nil
+	}
+}
@@ -0,0 +1,153 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package compacter_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elgopher/logstore/compacter"
+	"github.com/elgopher/logstore/internal/tests"
+	"github.com/elgopher/logstore/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactKeys(t *testing.T) {
+	t.Run("should return error for nil log", func(t *testing.T) {
+		_, err := compacter.CompactKeys(nil, keyBeforeEqualSign)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error for nil key func", func(t *testing.T) {
+		l := log.New(tests.TempDir(t))
+		_, err := compacter.CompactKeys(l, nil)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error when option returned error", func(t *testing.T) {
+		l := log.New(tests.TempDir(t))
+		option := func(s *compacter.KeySettings) error {
+			return tests.ErrFixed
+		}
+		_, err := compacter.CompactKeys(l, keyBeforeEqualSign, option)
+		assert.ErrorIs(t, err, tests.ErrFixed)
+	})
+
+	t.Run("should keep only the latest entry per key", func(t *testing.T) {
+		l := writeEntriesHourByHour(t, "a=1", "b=1", "a=2", "a=3")
+		// when
+		results, err := compacter.CompactKeys(l, keyBeforeEqualSign)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 2, results.EntriesRemoved)
+		entries := tests.ReadAll(t, l)
+		require.Len(t, entries, 2)
+		assert.Equal(t, "b=1", string(entries[0].Data))
+		assert.Equal(t, time2005.Add(time.Hour), entries[0].Time)
+		assert.Equal(t, "a=3", string(entries[1].Data))
+		assert.Equal(t, time2005.Add(3*time.Hour), entries[1].Time)
+	})
+
+	t.Run("should keep entries without a key", func(t *testing.T) {
+		l := writeEntriesHourByHour(t, "no key", "a=1", "a=2")
+		// when
+		_, err := compacter.CompactKeys(l, keyBeforeEqualSign)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, []string{"no key", "a=2"}, readAllData(t, l))
+	})
+
+	t.Run("should remove segments which became empty", func(t *testing.T) {
+		l := writeEntriesHourByHour(t, "a=1", "b=1", "b=2", "b=3")
+		segmentsBefore, err := l.Segments()
+		require.NoError(t, err)
+		// when
+		results, err := compacter.CompactKeys(l, keyBeforeEqualSign)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, segmentsBefore[1:2], results.SegmentsRemoved)
+		assert.Equal(t, segmentsBefore[:1], results.SegmentsRewritten)
+		assert.Equal(t, []string{"a=1", "b=3"}, readAllData(t, l))
+	})
+
+	t.Run("should not rewrite the last segment", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		require.NoError(t, writer.WriteWithTime(time2005, []byte("a=1")))
+		require.NoError(t, writer.WriteWithTime(time2005.Add(time.Second), []byte("a=2")))
+		// when
+		results, err := compacter.CompactKeys(l, keyBeforeEqualSign)
+		// then
+		require.NoError(t, err)
+		assert.Zero(t, results.EntriesRemoved)
+		assert.Equal(t, []string{"a=1", "a=2"}, readAllData(t, l))
+	})
+
+	t.Run("should keep tombstone", func(t *testing.T) {
+		l := writeEntriesHourByHour(t, "a=1", "a=2", "a=")
+		// when
+		_, err := compacter.CompactKeys(l, keyBeforeEqualSign, compacter.Tombstone(emptyValue))
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a="}, readAllData(t, l))
+	})
+
+	t.Run("should drop old tombstones", func(t *testing.T) {
+		l := writeEntriesHourByHour(t, "a=1", "a=", "b=1")
+		// when
+		_, err := compacter.CompactKeys(l, keyBeforeEqualSign,
+			compacter.Tombstone(emptyValue),
+			compacter.DropTombstonesBefore(time2006),
+		)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b=1"}, readAllData(t, l))
+	})
+
+	t.Run("should return error for nil tombstone func", func(t *testing.T) {
+		l := log.New(tests.TempDir(t))
+		_, err := compacter.CompactKeys(l, keyBeforeEqualSign, compacter.Tombstone(nil))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+}
+
+var time2005 = tests.MustTime("2005-02-04T20:01:37Z")
+var time2006 = tests.MustTime("2006-01-02T15:04:05Z")
+
+// writeEntriesHourByHour writes entries, so that all of them are stored in sealed segments.
+func writeEntriesHourByHour(t *testing.T, entries ...string) *log.Log {
+	t.Helper()
+
+	l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentDuration(time.Minute))
+	entryTime := time2005
+
+	for _, entry := range entries {
+		require.NoError(t, writer.WriteWithTime(entryTime, []byte(entry)))
+		entryTime = entryTime.Add(time.Hour)
+	}
+
+	return l
+}
+
+func readAllData(t *testing.T, l *log.Log) []string {
+	t.Helper()
+
+	var data []string
+	for _, entry := range tests.ReadAll(t, l) {
+		data = append(data, string(entry.Data))
+	}
+
+	return data
+}
+
+func keyBeforeEqualSign(data []byte) (string, bool) {
+	key, _, found := strings.Cut(string(data), "=")
+
+	return key, found
+}
+
+func emptyValue(data []byte) bool {
+	return strings.HasSuffix(string(data), "=")
+}
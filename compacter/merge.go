@@ -0,0 +1,120 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package compacter
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elgopher/logstore/log"
+)
+
+type MergeLog interface {
+	Log
+	MergeSegments(first, last time.Time) error
+}
+
+// MergeSmallSegments merges adjacent sealed segments (all except the last one) into bigger segments,
+// no larger than maxSizeBytes. Entry times and order are preserved.
+func MergeSmallSegments(l MergeLog, maxSizeBytes int64) (Results, error) {
+	if l == nil {
+		return Results{}, fmt.Errorf("nil log: %w", log.ErrInvalidParameter)
+	}
+
+	segments, err := l.Segments()
+	if err != nil {
+		return Results{}, fmt.Errorf("listing segments failed: %w", err)
+	}
+
+	res := Results{}
+
+	for _, group := range segmentsToMerge(segments, maxSizeBytes) {
+		first := group[0].StartingAt
+		last := group[len(group)-1].StartingAt
+
+		if err = l.MergeSegments(first, last); err != nil {
+			return res, fmt.Errorf("merging segments failed: %w", err)
+		}
+
+		res.SegmentsMerged = append(res.SegmentsMerged, group...)
+
+		// merged segment is smaller when duplicated entries were dropped
+		var mergedSize int64
+
+		mergedSize, err = segmentSize(l, first)
+		if err != nil {
+			return res, err
+		}
+
+		res.BytesFreed += groupSize(group) - mergedSize
+	}
+
+	return res, nil
+}
+
+// segmentsToMerge returns groups of adjacent sealed segments. Each group has at least two segments.
+func segmentsToMerge(segments []log.Segment, maxSizeBytes int64) [][]log.Segment {
+	if len(segments) < 2 {
+		return nil
+	}
+
+	sealed := segments[:len(segments)-1]
+
+	var (
+		groups    [][]log.Segment
+		group     []log.Segment
+		groupSize int64
+	)
+
+	flush := func() {
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+
+		group = nil
+		groupSize = 0
+	}
+
+	for _, segment := range sealed {
+		if groupSize+segment.SizeBytes > maxSizeBytes {
+			flush()
+		}
+
+		if segment.SizeBytes > maxSizeBytes {
+			continue
+		}
+
+		group = append(group, segment)
+		groupSize += segment.SizeBytes
+	}
+
+	flush()
+
+	return groups
+}
+
+func groupSize(group []log.Segment) int64 {
+	var size int64
+
+	for _, segment := range group {
+		size += segment.SizeBytes
+	}
+
+	return size
+}
+
+func segmentSize(l Log, startingAt time.Time) (int64, error) {
+	segments, err := l.Segments()
+	if err != nil {
+		return 0, fmt.Errorf("listing segments failed: %w", err)
+	}
+
+	for _, segment := range segments {
+		if segment.StartingAt.Equal(startingAt) {
+			return segment.SizeBytes, nil
+		}
+	}
+
+	return 0, fmt.Errorf("merged segment starting at %s not found", startingAt)
+}
@@ -0,0 +1,80 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package compacter_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elgopher/logstore/compacter"
+	"github.com/elgopher/logstore/internal/tests"
+	"github.com/elgopher/logstore/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeSmallSegments(t *testing.T) {
+	t.Run("should return error for nil log", func(t *testing.T) {
+		_, err := compacter.MergeSmallSegments(nil, tests.OneMegabyte)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should merge adjacent segments up to max size", func(t *testing.T) {
+		l := writeMegabyteSegments(t, 5)
+		entriesBefore := tests.ReadAll(t, l)
+		segmentsBefore, err := l.Segments()
+		require.NoError(t, err)
+		// when
+		results, err := compacter.MergeSmallSegments(l, 2*tests.OneMegabyte+100)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, segmentsBefore[:4], results.SegmentsMerged)
+		segmentsAfter, err := l.Segments()
+		require.NoError(t, err)
+		require.Len(t, segmentsAfter, 4)
+		assert.Equal(t, segmentsBefore[0].StartingAt, segmentsAfter[0].StartingAt)
+		assert.Equal(t, segmentsBefore[2].StartingAt, segmentsAfter[1].StartingAt)
+		assert.Equal(t, segmentsBefore[4:], segmentsAfter[2:])
+		assert.Equal(t, entriesBefore, tests.ReadAll(t, l))
+	})
+
+	t.Run("should not merge segments larger than max size", func(t *testing.T) {
+		l := writeMegabyteSegments(t, 3)
+		// when
+		results, err := compacter.MergeSmallSegments(l, tests.OneMegabyte)
+		// then
+		require.NoError(t, err)
+		assert.Empty(t, results.SegmentsMerged)
+	})
+
+	t.Run("should not merge the active segment", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentSizeMB(1))
+		tests.WriteEntry(t, writer, tests.OneMegabyte)
+		tests.WriteEntry(t, writer, 1)
+		// when
+		results, err := compacter.MergeSmallSegments(l, 10*tests.OneMegabyte)
+		// then
+		require.NoError(t, err)
+		assert.Empty(t, results.SegmentsMerged)
+	})
+	t.Run("should return bytes freed by dropping duplicated entries", func(t *testing.T) {
+		l := writeMegabyteSegments(t, 3)
+		files, err := filepath.Glob(filepath.Join(l.Dir(), "*.segment"))
+		require.NoError(t, err)
+		require.Len(t, files, 4)
+		first, err := os.ReadFile(files[0])
+		require.NoError(t, err)
+		second, err := os.ReadFile(files[1])
+		require.NoError(t, err)
+		// simulate merge interrupted after the first segment was copied to the second one
+		require.NoError(t, os.WriteFile(files[1], append(first, second...), 0600))
+		// when
+		results, err := compacter.MergeSmallSegments(l, 10*tests.OneMegabyte)
+		// then
+		require.NoError(t, err)
+		assert.Len(t, results.SegmentsMerged, 3)
+		assert.Equal(t, int64(len(first)), results.BytesFreed)
+	})
+}
@@ -0,0 +1,110 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package compacter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/elgopher/logstore/log"
+)
+
+type Action string
+
+const (
+	ActionRemove  Action = "remove"
+	ActionArchive Action = "archive"
+	ActionMerge   Action = "merge"
+)
+
+type PlannedAction struct {
+	Action  Action
+	Segment log.Segment
+	Reason  string
+}
+
+type CompactionPlan struct {
+	Actions []PlannedAction
+	// BytesReclaimed is a number of bytes which would be freed from the log directory
+	BytesReclaimed int64
+}
+
+// Plan returns what Compacter created with given options would do, without touching any files.
+func Plan(l Log, options ...Option) (CompactionPlan, error) {
+	c, err := New(l, options...)
+	if err != nil {
+		return CompactionPlan{}, err
+	}
+
+	return c.Plan()
+}
+
+// Plan returns what the next compaction would do, without touching any files.
+func (c *Compacter) Plan() (CompactionPlan, error) {
+	settings := c.settings
+
+	policies := c.policies()
+	if err := validatePolicies(policies); err != nil {
+		return CompactionPlan{}, err
+	}
+
+	segments, err := c.log.Segments()
+	if err != nil {
+		return CompactionPlan{}, fmt.Errorf("listing segments failed: %w", err)
+	}
+
+	action := ActionRemove
+	if settings.archive != nil {
+		action = ActionArchive
+	}
+
+	plan := CompactionPlan{}
+
+	decisions, err := decide(segments, settings.now(), policies)
+	if err != nil {
+		return CompactionPlan{}, err
+	}
+
+	for _, d := range decisions {
+		plan.Actions = append(plan.Actions, PlannedAction{
+			Action:  action,
+			Segment: d.segment,
+			Reason:  "required by " + strings.Join(d.policies, ", "),
+		})
+		plan.BytesReclaimed += d.segment.SizeBytes
+	}
+
+	if settings.mergeMaxSizeBytes > 0 {
+		remaining := segments[len(decisions):]
+
+		for _, group := range segmentsToMerge(remaining, settings.mergeMaxSizeBytes) {
+			var groupSize int64
+			for _, segment := range group {
+				groupSize += segment.SizeBytes
+			}
+
+			reason := fmt.Sprintf("%d segments (%d bytes) merged into segment starting at %s",
+				len(group), groupSize, group[0].StartingAt)
+
+			for _, segment := range group {
+				plan.Actions = append(plan.Actions, PlannedAction{
+					Action:  ActionMerge,
+					Segment: segment,
+					Reason:  reason,
+				})
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+// DryRun makes Compacter only report what it would do. The plan is logged and available in RunStats.
+func DryRun() Option {
+	return func(s *Settings) error {
+		s.dryRun = true
+
+		return nil
+	}
+}
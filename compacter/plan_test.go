@@ -0,0 +1,142 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package compacter_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/elgopher/logstore/compacter"
+	"github.com/elgopher/logstore/internal/tests"
+	"github.com/elgopher/logstore/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan(t *testing.T) {
+	t.Run("should return error for nil log", func(t *testing.T) {
+		_, err := compacter.Plan(nil)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return empty plan when there is nothing to compact", func(t *testing.T) {
+		l := writeMegabyteSegments(t, 3)
+		// when
+		plan, err := compacter.Plan(l)
+		// then
+		require.NoError(t, err)
+		assert.Empty(t, plan.Actions)
+		assert.Zero(t, plan.BytesReclaimed)
+	})
+
+	t.Run("should plan removal without removing segments", func(t *testing.T) {
+		l := writeMegabyteSegments(t, 3)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		// when
+		plan, err := compacter.Plan(l, compacter.Policies(maxSegmentsPolicy(t, 2)))
+		// then
+		require.NoError(t, err)
+		require.Len(t, plan.Actions, 2)
+		assert.Equal(t, compacter.ActionRemove, plan.Actions[0].Action)
+		assert.Equal(t, segments[0], plan.Actions[0].Segment)
+		assert.Contains(t, plan.Actions[0].Reason, "max-segments=2")
+		assert.Equal(t, segments[1], plan.Actions[1].Segment)
+		assert.Equal(t, segments[0].SizeBytes+segments[1].SizeBytes, plan.BytesReclaimed)
+		segmentsAfter, err := l.Segments()
+		require.NoError(t, err)
+		assert.Equal(t, segments, segmentsAfter)
+	})
+
+	t.Run("should plan archiving", func(t *testing.T) {
+		l := writeMegabyteSegments(t, 2)
+		archive := log.New(tests.TempDir(t))
+		// when
+		plan, err := compacter.Plan(l, compacter.Retention(0), compacter.ArchiveTo(archive))
+		// then
+		require.NoError(t, err)
+		require.NotEmpty(t, plan.Actions)
+		assert.Equal(t, compacter.ActionArchive, plan.Actions[0].Action)
+		assert.Contains(t, plan.Actions[0].Reason, "max-age=0s")
+	})
+
+	t.Run("should plan merging of segments which are not removed", func(t *testing.T) {
+		l := writeMegabyteSegments(t, 4)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		// when
+		plan, err := compacter.Plan(l,
+			compacter.Policies(maxSegmentsPolicy(t, 4)),
+			compacter.MergeSegmentsUpTo(10*tests.OneMegabyte),
+		)
+		// then
+		require.NoError(t, err)
+		require.Len(t, plan.Actions, 4)
+		assert.Equal(t, compacter.ActionRemove, plan.Actions[0].Action)
+		assert.Equal(t, segments[0], plan.Actions[0].Segment)
+		for i, action := range plan.Actions[1:] {
+			assert.Equal(t, compacter.ActionMerge, action.Action)
+			assert.Equal(t, segments[i+1], action.Segment)
+		}
+		assert.Equal(t, segments[0].SizeBytes, plan.BytesReclaimed)
+	})
+}
+
+func TestDryRun(t *testing.T) {
+	t.Run("should only report the plan", func(t *testing.T) {
+		l := writeMegabyteSegments(t, 3)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		logs := &bytes.Buffer{}
+		c := newCompacterWaitingForever(t, l,
+			compacter.Retention(time.Nanosecond),
+			compacter.DryRun(),
+			compacter.Logger(slog.New(slog.NewTextHandler(logs, nil))),
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		async := tests.RunAsync(func() {
+			_ = c.Run(ctx)
+		})
+		// when
+		c.TriggerNow()
+		// then
+		assert.Eventually(t, func() bool {
+			return !c.LastRun().StartedAt.IsZero()
+		}, time.Second, time.Millisecond)
+		cancel()
+		async.WaitOrFailAfter(t, time.Second)
+		lastRun := c.LastRun()
+		assert.Len(t, lastRun.Plan.Actions, len(segments)-1)
+		assert.Empty(t, lastRun.Results.SegmentsRemoved)
+		segmentsAfter, err := l.Segments()
+		require.NoError(t, err)
+		assert.Equal(t, segments, segmentsAfter)
+		assert.Contains(t, logs.String(), "dry run")
+	})
+
+	t.Run("should notify observer", func(t *testing.T) {
+		l := writeMegabyteSegments(t, 3)
+		observer := &compactionObserver{stats: make(chan compacter.RunStats, 1)}
+		c := newCompacterWaitingForever(t, l,
+			compacter.Retention(time.Nanosecond),
+			compacter.DryRun(),
+			compacter.Observe(observer),
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		async := tests.RunAsync(func() {
+			_ = c.Run(ctx)
+		})
+		// when
+		c.TriggerNow()
+		// then
+		stats := <-observer.stats
+		assert.NotEmpty(t, stats.Plan.Actions)
+		assert.Empty(t, stats.Results.SegmentsRemoved)
+		cancel()
+		async.WaitOrFailAfter(t, time.Second)
+	})
+}
@@ -0,0 +1,231 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package compacter
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elgopher/logstore/log"
+)
+
+// Policy decides how many of the oldest segments must be removed.
+type Policy struct {
+	name        string
+	removeCount func(segments []log.Segment, now time.Time) (int, error)
+}
+
+// NewPolicy creates a custom policy. removeCount returns how many of the oldest segments must be removed.
+// Error returned by removeCount stops the compaction. Policy with nil removeCount is rejected like zero value Policy.
+func NewPolicy(name string, removeCount func(segments []log.Segment, now time.Time) (int, error)) Policy {
+	return Policy{
+		name:        name,
+		removeCount: removeCount,
+	}
+}
+
+func (p Policy) Name() string {
+	return p.name
+}
+
+// MaxAge requires removing segments which started before now-duration.
+func MaxAge(duration time.Duration) Policy {
+	return Policy{
+		name: fmt.Sprintf("max-age=%s", duration),
+		removeCount: func(segments []log.Segment, now time.Time) (int, error) {
+			olderThan := now.Add(-duration)
+
+			count := 0
+			for count < len(segments) && segments[count].StartingAt.Before(olderThan) {
+				count++
+			}
+
+			return count, nil
+		},
+	}
+}
+
+// MaxTotalSize requires removing the oldest segments until the total size of all segments is not greater than bytes.
+func MaxTotalSize(bytes int64) (Policy, error) {
+	if bytes < 0 {
+		return Policy{}, fmt.Errorf("negative max total size: %w", log.ErrInvalidParameter)
+	}
+
+	return Policy{
+		name: fmt.Sprintf("max-total-size=%d", bytes),
+		removeCount: func(segments []log.Segment, _ time.Time) (int, error) {
+			var total int64
+			for _, segment := range segments {
+				total += segment.SizeBytes
+			}
+
+			count := 0
+			for count < len(segments) && total > bytes {
+				total -= segments[count].SizeBytes
+				count++
+			}
+
+			return count, nil
+		},
+	}, nil
+}
+
+// MaxSegments requires removing the oldest segments until there are no more than n segments.
+func MaxSegments(n int) (Policy, error) {
+	if n < 0 {
+		return Policy{}, fmt.Errorf("negative max segments: %w", log.ErrInvalidParameter)
+	}
+
+	return Policy{
+		name: fmt.Sprintf("max-segments=%d", n),
+		removeCount: func(segments []log.Segment, _ time.Time) (int, error) {
+			if len(segments) <= n {
+				return 0, nil
+			}
+
+			return len(segments) - n, nil
+		},
+	}, nil
+}
+
+// RemoveSegments removes the oldest segments until every policy is met. The last (active) segment is never removed,
+// even if some policy is still not met.
+func RemoveSegments(l Log, now time.Time, policies ...Policy) (Results, error) {
+	if l == nil {
+		return Results{}, fmt.Errorf("nil log: %w", log.ErrInvalidParameter)
+	}
+
+	res := Results{}
+
+	err := applyPolicies(l, now, policies, &res, func(segment log.Segment) error {
+		if err := l.RemoveSegmentStartingAt(segment.StartingAt); err != nil {
+			return fmt.Errorf("removing segment failed: %w", err)
+		}
+
+		res.SegmentsRemoved = append(res.SegmentsRemoved, segment)
+
+		return nil
+	})
+
+	return res, err
+}
+
+type ArchiveLog interface {
+	Log
+	MoveSegmentStartingAt(t time.Time, dst *log.Log) error
+}
+
+// ArchiveSegments works like RemoveSegments, but instead of removing segments it moves them to the archive.
+// Archive is a regular log directory, therefore archived entries can be read using archive.OpenReader.
+func ArchiveSegments(l ArchiveLog, archive *log.Log, now time.Time, policies ...Policy) (Results, error) {
+	if l == nil {
+		return Results{}, fmt.Errorf("nil log: %w", log.ErrInvalidParameter)
+	}
+
+	if archive == nil {
+		return Results{}, fmt.Errorf("nil archive: %w", log.ErrInvalidParameter)
+	}
+
+	res := Results{}
+
+	err := applyPolicies(l, now, policies, &res, func(segment log.Segment) error {
+		if err := l.MoveSegmentStartingAt(segment.StartingAt, archive); err != nil {
+			return fmt.Errorf("archiving segment failed: %w", err)
+		}
+
+		res.SegmentsArchived = append(res.SegmentsArchived, segment)
+
+		return nil
+	})
+
+	return res, err
+}
+
+// applyPolicies executes action for the oldest segments until every policy is met.
+func applyPolicies(l Log, now time.Time, policies []Policy, res *Results, action func(log.Segment) error) error {
+	if err := validatePolicies(policies); err != nil {
+		return err
+	}
+
+	segments, err := l.Segments()
+	if err != nil {
+		return fmt.Errorf("listing segments failed: %w", err)
+	}
+
+	decisions, err := decide(segments, now, policies)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range decisions {
+		if err = action(d.segment); err != nil {
+			return err
+		}
+
+		res.BytesFreed += d.segment.SizeBytes
+
+		for _, policy := range d.policies {
+			res.addBytesFreedByPolicy(policy, d.segment.SizeBytes)
+		}
+	}
+
+	return nil
+}
+
+func validatePolicies(policies []Policy) error {
+	for _, policy := range policies {
+		if policy.removeCount == nil {
+			return fmt.Errorf("zero value policy: %w", log.ErrInvalidParameter)
+		}
+	}
+
+	return nil
+}
+
+type decision struct {
+	segment log.Segment
+	// names of policies requiring segment removal
+	policies []string
+}
+
+// decide returns the oldest segments which must be removed to meet every policy.
+func decide(segments []log.Segment, now time.Time, policies []Policy) ([]decision, error) {
+	if len(segments) < 2 {
+		return nil, nil
+	}
+
+	removeCounts := make([]int, len(policies))
+	maxRemoveCount := 0
+
+	for i, policy := range policies {
+		count, err := policy.removeCount(segments, now)
+		if err != nil {
+			return nil, fmt.Errorf("applying policy %s failed: %w", policy.name, err)
+		}
+
+		removeCounts[i] = count
+		if removeCounts[i] > maxRemoveCount {
+			maxRemoveCount = removeCounts[i]
+		}
+	}
+
+	if maxRemoveCount > len(segments)-1 {
+		// the last segment is the active one
+		maxRemoveCount = len(segments) - 1
+	}
+
+	decisions := make([]decision, maxRemoveCount)
+
+	for i, segment := range segments[:maxRemoveCount] {
+		decisions[i].segment = segment
+
+		for j, policy := range policies {
+			if i < removeCounts[j] {
+				decisions[i].policies = append(decisions[i].policies, policy.name)
+			}
+		}
+	}
+
+	return decisions, nil
+}
@@ -0,0 +1,229 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package compacter_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elgopher/logstore/compacter"
+	"github.com/elgopher/logstore/internal/tests"
+	"github.com/elgopher/logstore/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoveSegments(t *testing.T) {
+	t.Run("should return error for nil log", func(t *testing.T) {
+		_, err := compacter.RemoveSegments(nil, time.Now(), maxSegmentsPolicy(t, 1))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error for zero value policy", func(t *testing.T) {
+		l := log.New(tests.TempDir(t))
+		_, err := compacter.RemoveSegments(l, time.Now(), compacter.Policy{})
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error for negative max segments", func(t *testing.T) {
+		_, err := compacter.MaxSegments(-1)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error for negative max total size", func(t *testing.T) {
+		_, err := compacter.MaxTotalSize(-1)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should not remove segments when there are no policies", func(t *testing.T) {
+		l := writeMegabyteSegments(t, 3)
+		// when
+		results, err := compacter.RemoveSegments(l, time.Now())
+		// then
+		require.NoError(t, err)
+		assert.Empty(t, results.SegmentsRemoved)
+	})
+
+	t.Run("should remove oldest segments exceeding max segments", func(t *testing.T) {
+		l := writeMegabyteSegments(t, 5)
+		segmentsBefore, err := l.Segments()
+		require.NoError(t, err)
+		// when
+		results, err := compacter.RemoveSegments(l, time.Now(), maxSegmentsPolicy(t, 2))
+		// then
+		require.NoError(t, err)
+		segmentsAfter, err := l.Segments()
+		require.NoError(t, err)
+		assert.Equal(t, segmentsBefore[len(segmentsBefore)-2:], segmentsAfter)
+		assert.Equal(t, segmentsBefore[:len(segmentsBefore)-2], results.SegmentsRemoved)
+	})
+
+	t.Run("should remove oldest segments exceeding max total size", func(t *testing.T) {
+		l := writeMegabyteSegments(t, 5)
+		maxSize := 2*tests.OneMegabyte + 100
+		// when
+		results, err := compacter.RemoveSegments(l, time.Now(), maxTotalSizePolicy(t, maxSize))
+		// then
+		require.NoError(t, err)
+		assert.Len(t, results.SegmentsRemoved, 3)
+		assert.LessOrEqual(t, totalSize(t, l), maxSize)
+	})
+
+	t.Run("should remove segments older than max age", func(t *testing.T) {
+		l := writeMegabyteSegments(t, 3)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		now := segments[1].StartingAt.Add(time.Hour)
+		// when
+		results, err := compacter.RemoveSegments(l, now, compacter.MaxAge(time.Hour))
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, segments[:1], results.SegmentsRemoved)
+	})
+
+	t.Run("should meet every policy", func(t *testing.T) {
+		l := writeMegabyteSegments(t, 5)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		// when
+		results, err := compacter.RemoveSegments(l, time.Now(),
+			maxSegmentsPolicy(t, 4),
+			maxTotalSizePolicy(t, 3*tests.OneMegabyte),
+		)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, segments[:3], results.SegmentsRemoved)
+	})
+
+	t.Run("should never remove the active segment", func(t *testing.T) {
+		l := writeMegabyteSegments(t, 3)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		// when
+		results, err := compacter.RemoveSegments(l, time.Now(), maxSegmentsPolicy(t, 0))
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, segments[:len(segments)-1], results.SegmentsRemoved)
+		segmentsAfter, err := l.Segments()
+		require.NoError(t, err)
+		assert.Equal(t, segments[len(segments)-1:], segmentsAfter)
+	})
+
+	t.Run("should remove segments required by custom policy", func(t *testing.T) {
+		l := writeMegabyteSegments(t, 3)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		policy := compacter.NewPolicy("custom", func([]log.Segment, time.Time) (int, error) {
+			return 1, nil
+		})
+		// when
+		results, err := compacter.RemoveSegments(l, time.Now(), policy)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, segments[:1], results.SegmentsRemoved)
+	})
+
+	t.Run("should return error returned by custom policy", func(t *testing.T) {
+		l := writeMegabyteSegments(t, 3)
+		policy := compacter.NewPolicy("custom", func([]log.Segment, time.Time) (int, error) {
+			return 0, tests.ErrFixed
+		})
+		// when
+		results, err := compacter.RemoveSegments(l, time.Now(), policy)
+		// then
+		assert.ErrorIs(t, err, tests.ErrFixed)
+		assert.Empty(t, results.SegmentsRemoved)
+	})
+
+	t.Run("should return error for custom policy without function", func(t *testing.T) {
+		l := log.New(tests.TempDir(t))
+		_, err := compacter.RemoveSegments(l, time.Now(), compacter.NewPolicy("custom", nil))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should report bytes freed per policy", func(t *testing.T) {
+		l := writeMegabyteSegments(t, 5)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		maxSegments := maxSegmentsPolicy(t, len(segments)-1)
+		maxTotalSize := maxTotalSizePolicy(t, 4*tests.OneMegabyte)
+		// when
+		results, err := compacter.RemoveSegments(l, time.Now(), maxSegments, maxTotalSize)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, segments[0].SizeBytes+segments[1].SizeBytes, results.BytesFreed)
+		assert.Equal(t, segments[0].SizeBytes, results.BytesFreedByPolicy[maxSegments.Name()])
+		assert.Equal(t, results.BytesFreed, results.BytesFreedByPolicy[maxTotalSize.Name()])
+	})
+}
+
+func TestArchiveSegments(t *testing.T) {
+	t.Run("should return error for nil archive", func(t *testing.T) {
+		l := log.New(tests.TempDir(t))
+		_, err := compacter.ArchiveSegments(l, nil, time.Now(), maxSegmentsPolicy(t, 1))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should move oldest segments to the archive", func(t *testing.T) {
+		l := writeMegabyteSegments(t, 3)
+		segmentsBefore, err := l.Segments()
+		require.NoError(t, err)
+		entriesBefore := tests.ReadAll(t, l)
+		archive := log.New(tests.TempDir(t))
+		// when
+		results, err := compacter.ArchiveSegments(l, archive, time.Now(), maxSegmentsPolicy(t, 2))
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, segmentsBefore[:2], results.SegmentsArchived)
+		assert.Empty(t, results.SegmentsRemoved)
+		archivedSegments, err := archive.Segments()
+		require.NoError(t, err)
+		assert.Equal(t, segmentsBefore[:2], archivedSegments)
+		assert.Equal(t, entriesBefore[:2], tests.ReadAll(t, archive))
+		assert.Equal(t, entriesBefore[2:], tests.ReadAll(t, l))
+	})
+}
+
+func maxSegmentsPolicy(t *testing.T, n int) compacter.Policy {
+	t.Helper()
+
+	policy, err := compacter.MaxSegments(n)
+	require.NoError(t, err)
+
+	return policy
+}
+
+func maxTotalSizePolicy(t *testing.T, bytes int64) compacter.Policy {
+	t.Helper()
+
+	policy, err := compacter.MaxTotalSize(bytes)
+	require.NoError(t, err)
+
+	return policy
+}
+
+func writeMegabyteSegments(t *testing.T, count int) *log.Log {
+	t.Helper()
+
+	l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentSizeMB(1))
+	for i := 0; i < count; i++ {
+		tests.WriteEntry(t, writer, tests.OneMegabyte)
+	}
+
+	return l
+}
+
+func totalSize(t *testing.T, l *log.Log) int64 {
+	t.Helper()
+
+	segments, err := l.Segments()
+	require.NoError(t, err)
+
+	var total int64
+	for _, segment := range segments {
+		total += segment.SizeBytes
+	}
+
+	return total
+}
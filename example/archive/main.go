@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elgopher/logstore/compacter"
+	"github.com/elgopher/logstore/log"
+)
+
+// This example shows how to move old segments to the archive and read them later.
+func main() {
+	l := log.New("/tmp/logstore")
+	// archive is a regular log directory, it can be placed on another disk
+	archive := log.New("/tmp/logstore-archive")
+
+	results, err := compacter.ArchiveSegments(l, archive, time.Now(), compacter.MaxAge(time.Hour))
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("Segments archived: %d\n", len(results.SegmentsArchived))
+
+	// archived entries are read using the standard Reader
+	twoHoursAgo := time.Now().Add(-2 * time.Hour)
+
+	reader, err := archive.OpenReader(log.StartingFrom(twoHoursAgo))
+	if err != nil {
+		panic(err)
+	}
+
+	defer func() {
+		if err = reader.Close(); err != nil {
+			panic(err)
+		}
+	}()
+
+	for {
+		t, data, err := reader.Read()
+		if errors.Is(err, log.ErrEOL) {
+			return
+		}
+
+		if err != nil {
+			panic(err)
+		}
+
+		fmt.Printf("Archived entry read with t=%s,data=%s\n", t, data)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/elgopher/logstore/compacter"
+	"github.com/elgopher/logstore/log"
+	"github.com/elgopher/logstore/snapshot"
+)
+
+// This example shows how to restore state from the latest snapshot and entries written after it.
+func main() {
+	l := log.New("/tmp/logstore/snapshot")
+	snapshots, err := snapshot.New(l)
+	if err != nil {
+		panic(err)
+	}
+
+	writer, err := l.OpenWriter()
+	if err != nil {
+		panic(err)
+	}
+
+	defer func() {
+		if err = writer.Close(); err != nil {
+			panic(err)
+		}
+	}()
+
+	// Latest returns the newest snapshot and a reader returning entries written after the snapshot
+	snap, reader, err := snapshots.Latest()
+	if err != nil {
+		panic(err)
+	}
+
+	counter := 0
+
+	if len(snap.Data) > 0 {
+		counter, err = strconv.Atoi(string(snap.Data))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	for {
+		_, _, err = reader.Read()
+		if errors.Is(err, log.ErrEOL) {
+			break
+		}
+
+		if err != nil {
+			panic(err)
+		}
+
+		counter++
+	}
+
+	if err = reader.Close(); err != nil {
+		panic(err)
+	}
+
+	t, err := writer.Write([]byte("increment"))
+	if err != nil {
+		panic(err)
+	}
+
+	counter++
+
+	// save snapshot of the state built from all entries up to t
+	if err = snapshots.Save(t, []byte(strconv.Itoa(counter))); err != nil {
+		panic(err)
+	}
+
+	// remove segments which are no longer needed to restore the state
+	results, err := compacter.RemoveSegments(l, time.Now(), snapshots.Policy())
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("Counter=%d, segments removed: %d\n", counter, len(results.SegmentsRemoved))
+}
@@ -0,0 +1,394 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+// Package httpapi provides http.Handler for appending, reading and tailing a log over HTTP.
+//
+// Endpoints (relative to the path where the handler is mounted):
+//
+//	POST /entries                              appends request body as a new entry, responds with {"time": "..."}
+//	GET  /entries?from=&to=&format=ndjson|raw  returns entries from time range [from, to)
+//	GET  /tail?from=                           streams entries as Server-Sent Events
+//	GET  /segments                             lists segments
+//
+// Times are formatted using RFC 3339 with nanoseconds.
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elgopher/logstore/log"
+)
+
+const (
+	FormatNDJSON = "ndjson"
+	// FormatRaw is a sequence of entries, each encoded as:
+	//
+	//	time (int64 unix nanoseconds, little endian) | data length (uint32, little endian) | data
+	FormatRaw = "raw"
+)
+
+// Handler is a http.Handler exposing the log. Handler created without a Writer is read-only.
+type Handler struct {
+	log      *log.Log
+	settings *Settings
+
+	writerMutex sync.Mutex
+	writer      *log.Writer
+}
+
+// NewHandler creates a Handler. Writer can be nil - then appending entries is not allowed.
+// Writer must not be used by anyone else, because Handler synchronizes access to it.
+func NewHandler(l *log.Log, writer *log.Writer, options ...Option) (*Handler, error) {
+	if l == nil {
+		return nil, fmt.Errorf("nil log: %w", log.ErrInvalidParameter)
+	}
+
+	settings := &Settings{
+		maxEntrySizeBytes: 1024 * 1024,
+		pollInterval:      100 * time.Millisecond,
+		logger:            slog.Default(),
+	}
+
+	for _, applyOption := range options {
+		if applyOption == nil {
+			continue
+		}
+
+		if err := applyOption(settings); err != nil {
+			return nil, fmt.Errorf("error applying option: %w", err)
+		}
+	}
+
+	return &Handler{
+		log:      l,
+		writer:   writer,
+		settings: settings,
+	}, nil
+}
+
+type Option func(*Settings) error
+
+type Settings struct {
+	maxEntrySizeBytes int64
+	pollInterval      time.Duration
+	logger            *slog.Logger
+}
+
+// MaxEntrySize limits the size of the appended entry. Default is 1MB.
+func MaxEntrySize(bytes int64) Option {
+	return func(s *Settings) error {
+		if bytes <= 0 {
+			return fmt.Errorf("max entry size must be positive: %w", log.ErrInvalidParameter)
+		}
+
+		s.maxEntrySizeBytes = bytes
+
+		return nil
+	}
+}
+
+// PollInterval sets how often the tail endpoint checks for new entries.
+func PollInterval(d time.Duration) Option {
+	return func(s *Settings) error {
+		if d <= 0 {
+			return fmt.Errorf("poll interval must be positive: %w", log.ErrInvalidParameter)
+		}
+
+		s.pollInterval = d
+
+		return nil
+	}
+}
+
+func Logger(logger *slog.Logger) Option {
+	return func(s *Settings) error {
+		if logger == nil {
+			return fmt.Errorf("nil logger: %w", log.ErrInvalidParameter)
+		}
+
+		s.logger = logger
+
+		return nil
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/entries" && r.Method == http.MethodPost:
+		h.appendEntry(w, r)
+	case r.URL.Path == "/entries" && r.Method == http.MethodGet:
+		h.readEntries(w, r)
+	case r.URL.Path == "/tail" && r.Method == http.MethodGet:
+		h.tail(w, r)
+	case r.URL.Path == "/segments" && r.Method == http.MethodGet:
+		h.segments(w)
+	case r.URL.Path == "/entries" || r.URL.Path == "/tail" || r.URL.Path == "/segments":
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+type timeResponse struct {
+	Time time.Time `json:"time"`
+}
+
+func (h *Handler) appendEntry(w http.ResponseWriter, r *http.Request) {
+	if h.writer == nil {
+		http.Error(w, "log is read-only", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.settings.maxEntrySizeBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "entry too large", http.StatusRequestEntityTooLarge)
+
+			return
+		}
+
+		http.Error(w, "reading request body failed", http.StatusBadRequest)
+
+		return
+	}
+
+	h.writerMutex.Lock()
+	t, err := h.writer.Write(data)
+	h.writerMutex.Unlock()
+
+	if err != nil {
+		h.settings.logger.Error("writing entry failed", "err", err)
+		http.Error(w, "writing entry failed", http.StatusInternalServerError)
+
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, timeResponse{Time: t})
+}
+
+type entryResponse struct {
+	Time time.Time `json:"time"`
+	Data []byte    `json:"data"` // encoded as base64
+}
+
+func (h *Handler) readEntries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	from, err := parseTimeParam(query.Get("from"))
+	if err != nil {
+		http.Error(w, "invalid from parameter", http.StatusBadRequest)
+
+		return
+	}
+
+	to, err := parseTimeParam(query.Get("to"))
+	if err != nil {
+		http.Error(w, "invalid to parameter", http.StatusBadRequest)
+
+		return
+	}
+
+	format := query.Get("format")
+	if format == "" {
+		format = FormatNDJSON
+	}
+
+	var writeEntry func(io.Writer, time.Time, []byte) error
+
+	switch format {
+	case FormatNDJSON:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		writeEntry = writeNDJSONEntry
+	case FormatRaw:
+		w.Header().Set("Content-Type", "application/octet-stream")
+		writeEntry = writeRawEntry
+	default:
+		http.Error(w, "unsupported format", http.StatusBadRequest)
+
+		return
+	}
+
+	reader, err := h.log.OpenReader(log.StartingFrom(from))
+	if err != nil {
+		h.settings.logger.Error("opening log reader failed", "err", err)
+		http.Error(w, "opening log reader failed", http.StatusInternalServerError)
+
+		return
+	}
+	defer reader.Close() //nolint:errcheck
+
+	bufferedWriter := bufio.NewWriter(w)
+	defer bufferedWriter.Flush() //nolint:errcheck
+
+	for {
+		t, data, err := reader.Read()
+		if errors.Is(err, log.ErrEOL) {
+			return
+		}
+
+		if errors.Is(err, log.ErrSegmentCompacted) {
+			continue
+		}
+
+		if err != nil {
+			// status code was already sent
+			h.settings.logger.Error("reading entry failed", "err", err)
+
+			return
+		}
+
+		if !to.IsZero() && !t.Before(to) {
+			return
+		}
+
+		if err = writeEntry(bufferedWriter, t, data); err != nil {
+			return
+		}
+	}
+}
+
+func writeNDJSONEntry(w io.Writer, t time.Time, data []byte) error {
+	return json.NewEncoder(w).Encode(entryResponse{Time: t, Data: data})
+}
+
+func writeRawEntry(w io.Writer, t time.Time, data []byte) error {
+	header := make([]byte, 12)
+	binary.LittleEndian.PutUint64(header, uint64(t.UnixNano()))
+	binary.LittleEndian.PutUint32(header[8:], uint32(len(data)))
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	_, err := w.Write(data)
+
+	return err
+}
+
+// tail streams entries as Server-Sent Events. Event id is the entry time in unix nanoseconds, data is base64
+// encoded entry. Client can resume streaming using Last-Event-ID header.
+func (h *Handler) tail(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+
+		return
+	}
+
+	var options []log.OpenReaderOption
+
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		nanos, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid Last-Event-ID header", http.StatusBadRequest)
+
+			return
+		}
+
+		options = append(options, log.StartingFrom(time.Unix(0, nanos).Add(time.Nanosecond)))
+	} else if from := r.URL.Query().Get("from"); from != "" {
+		t, err := parseTimeParam(from)
+		if err != nil {
+			http.Error(w, "invalid from parameter", http.StatusBadRequest)
+
+			return
+		}
+
+		options = append(options, log.StartingFrom(t))
+	}
+
+	options = append(options, log.PollInterval(h.settings.pollInterval))
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	reader, err := h.log.OpenTailReader(ctx, options...)
+	if err != nil {
+		h.settings.logger.Error("opening log reader failed", "err", err)
+		http.Error(w, "opening log reader failed", http.StatusInternalServerError)
+
+		return
+	}
+	defer reader.Close() //nolint:errcheck
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		t, data, err := reader.Read()
+		if errors.Is(err, log.ErrSegmentCompacted) {
+			continue
+		}
+
+		if err != nil {
+			if ctx.Err() == nil {
+				h.settings.logger.Error("reading entry failed", "err", err)
+			}
+
+			return
+		}
+
+		_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", t.UnixNano(), base64.StdEncoding.EncodeToString(data))
+		if err != nil {
+			return
+		}
+
+		flusher.Flush()
+	}
+}
+
+type segmentResponse struct {
+	StartingAt time.Time `json:"startingAt"`
+	SizeBytes  int64     `json:"sizeBytes"`
+}
+
+func (h *Handler) segments(w http.ResponseWriter) {
+	segments, err := h.log.Segments()
+	if err != nil {
+		h.settings.logger.Error("listing segments failed", "err", err)
+		http.Error(w, "listing segments failed", http.StatusInternalServerError)
+
+		return
+	}
+
+	response := make([]segmentResponse, len(segments))
+	for i, segment := range segments {
+		response[i] = segmentResponse{
+			StartingAt: segment.StartingAt,
+			SizeBytes:  segment.SizeBytes,
+		}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func parseTimeParam(s string) (time.Time, error) {
+	if strings.TrimSpace(s) == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
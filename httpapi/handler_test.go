@@ -0,0 +1,269 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package httpapi_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elgopher/logstore/httpapi"
+	"github.com/elgopher/logstore/internal/tests"
+	"github.com/elgopher/logstore/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	time2005 = tests.MustTime("2005-02-04T20:01:37Z")
+	time2006 = tests.MustTime("2006-01-02T15:04:05Z")
+	time2007 = tests.MustTime("2007-01-02T15:04:05Z")
+)
+
+func TestNewHandler(t *testing.T) {
+	t.Run("should return error for nil log", func(t *testing.T) {
+		_, err := httpapi.NewHandler(nil, nil)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+}
+
+func TestHandler_AppendEntry(t *testing.T) {
+	t.Run("should append entry and return its time", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		handler := newHandler(t, l, writer)
+		// when
+		recorder := serve(handler, http.MethodPost, "/entries", "entry")
+		// then
+		require.Equal(t, http.StatusCreated, recorder.Code)
+		var response struct{ Time time.Time }
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		entries := tests.ReadAll(t, l)
+		require.Len(t, entries, 1)
+		assert.True(t, response.Time.Equal(entries[0].Time))
+		assert.Equal(t, []byte("entry"), entries[0].Data)
+	})
+
+	t.Run("should reject appending to read-only log", func(t *testing.T) {
+		handler := newHandler(t, log.New(tests.TempDir(t)), nil)
+		// when
+		recorder := serve(handler, http.MethodPost, "/entries", "entry")
+		// then
+		assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+	})
+
+	t.Run("should reject too large entry", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		handler, err := httpapi.NewHandler(l, writer, httpapi.MaxEntrySize(3))
+		require.NoError(t, err)
+		// when
+		recorder := serve(handler, http.MethodPost, "/entries", "entry")
+		// then
+		assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+	})
+}
+
+func TestHandler_ReadEntries(t *testing.T) {
+	t.Run("should return entries as NDJSON", func(t *testing.T) {
+		l := writeEntries(t)
+		handler := newHandler(t, l, nil)
+		// when
+		recorder := serve(handler, http.MethodGet, "/entries", "")
+		// then
+		require.Equal(t, http.StatusOK, recorder.Code)
+		lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+		require.Len(t, lines, 3)
+		var entry struct {
+			Time time.Time
+			Data []byte
+		}
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+		assert.True(t, time2005.Equal(entry.Time))
+		assert.Equal(t, []byte("1"), entry.Data)
+	})
+
+	t.Run("should return entries from given time range", func(t *testing.T) {
+		l := writeEntries(t)
+		handler := newHandler(t, l, nil)
+		target := "/entries?from=" + time2006.Format(time.RFC3339Nano) + "&to=" + time2007.Format(time.RFC3339Nano)
+		// when
+		recorder := serve(handler, http.MethodGet, target, "")
+		// then
+		require.Equal(t, http.StatusOK, recorder.Code)
+		lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+		require.Len(t, lines, 1)
+		assert.Contains(t, lines[0], base64.StdEncoding.EncodeToString([]byte("2")))
+	})
+
+	t.Run("should return entries in raw format", func(t *testing.T) {
+		l := writeEntries(t)
+		handler := newHandler(t, l, nil)
+		// when
+		recorder := serve(handler, http.MethodGet, "/entries?format=raw", "")
+		// then
+		require.Equal(t, http.StatusOK, recorder.Code)
+		body := recorder.Body.Bytes()
+		assert.Equal(t, time2005.UnixNano(), int64(binary.LittleEndian.Uint64(body)))
+		assert.Equal(t, uint32(1), binary.LittleEndian.Uint32(body[8:]))
+		assert.Equal(t, byte('1'), body[12])
+		assert.Len(t, body, 3*13)
+	})
+
+	t.Run("should reject invalid parameters", func(t *testing.T) {
+		handler := newHandler(t, log.New(tests.TempDir(t)), nil)
+		targets := []string{"/entries?from=abc", "/entries?to=abc", "/entries?format=xml"}
+		for _, target := range targets {
+			t.Run(target, func(t *testing.T) {
+				recorder := serve(handler, http.MethodGet, target, "")
+				assert.Equal(t, http.StatusBadRequest, recorder.Code)
+			})
+		}
+	})
+}
+
+func TestHandler_Tail(t *testing.T) {
+	t.Run("should stream existing and new entries as events", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		require.NoError(t, writer.WriteWithTime(time2005, []byte("1")))
+		server := startServer(t, l)
+		resp := getTail(t, server.URL+"/tail", "")
+		events := bufio.NewReader(resp.Body)
+		assertEvent(t, events, time2005, "1")
+		// when
+		require.NoError(t, writer.WriteWithTime(time2006, []byte("2")))
+		// then
+		assertEvent(t, events, time2006, "2")
+	})
+
+	t.Run("should resume from Last-Event-ID", func(t *testing.T) {
+		l := writeEntries(t)
+		server := startServer(t, l)
+		// when
+		resp := getTail(t, server.URL+"/tail", strconv.FormatInt(time2006.UnixNano(), 10))
+		// then
+		assertEvent(t, bufio.NewReader(resp.Body), time2007, "3")
+	})
+}
+
+func TestHandler_Segments(t *testing.T) {
+	t.Run("should list segments", func(t *testing.T) {
+		l := writeEntries(t)
+		handler := newHandler(t, l, nil)
+		// when
+		recorder := serve(handler, http.MethodGet, "/segments", "")
+		// then
+		require.Equal(t, http.StatusOK, recorder.Code)
+		var response []struct {
+			StartingAt time.Time
+			SizeBytes  int64
+		}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		require.Len(t, response, len(segments))
+		assert.True(t, segments[0].StartingAt.Equal(response[0].StartingAt))
+		assert.Equal(t, segments[0].SizeBytes, response[0].SizeBytes)
+	})
+}
+
+func TestHandler_ServeHTTP(t *testing.T) {
+	t.Run("should return 404 for unknown path", func(t *testing.T) {
+		handler := newHandler(t, log.New(tests.TempDir(t)), nil)
+		recorder := serve(handler, http.MethodGet, "/unknown", "")
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+
+	t.Run("should return 405 for unsupported method", func(t *testing.T) {
+		handler := newHandler(t, log.New(tests.TempDir(t)), nil)
+		recorder := serve(handler, http.MethodDelete, "/segments", "")
+		assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+	})
+}
+
+func newHandler(t *testing.T, l *log.Log, writer *log.Writer) *httpapi.Handler {
+	t.Helper()
+
+	handler, err := httpapi.NewHandler(l, writer, httpapi.PollInterval(time.Millisecond))
+	require.NoError(t, err)
+
+	return handler
+}
+
+func serve(handler http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(method, target, strings.NewReader(body)))
+
+	return recorder
+}
+
+func startServer(t *testing.T, l *log.Log) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(newHandler(t, l, nil))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func getTail(t *testing.T, url, lastEventID string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = resp.Body.Close()
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	return resp
+}
+
+func assertEvent(t *testing.T, events *bufio.Reader, expectedTime time.Time, expectedData string) {
+	t.Helper()
+
+	var event bytes.Buffer
+
+	for {
+		line, err := events.ReadString('\n')
+		require.NoError(t, err)
+
+		if line == "\n" {
+			break
+		}
+
+		event.WriteString(line)
+	}
+
+	expected := "id: " + strconv.FormatInt(expectedTime.UnixNano(), 10) + "\n" +
+		"data: " + base64.StdEncoding.EncodeToString([]byte(expectedData)) + "\n"
+	assert.Equal(t, expected, event.String())
+}
+
+// writeEntries writes 3 entries: at time2005, time2006 and time2007.
+func writeEntries(t *testing.T) *log.Log {
+	t.Helper()
+
+	l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentDuration(time.Minute))
+	require.NoError(t, writer.WriteWithTime(time2005, []byte("1")))
+	require.NoError(t, writer.WriteWithTime(time2006, []byte("2")))
+	require.NoError(t, writer.WriteWithTime(time2007, []byte("3")))
+	require.NoError(t, writer.Close())
+
+	return l
+}
@@ -0,0 +1,19 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+// Package fsutil contains file system helpers shared by logstore packages.
+package fsutil
+
+import "os"
+
+// SyncDir makes directory changes (such as removed or renamed files) durable. It is a best-effort operation,
+// because not all platforms support syncing directories.
+func SyncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+
+	_ = d.Sync()
+	_ = d.Close()
+}
@@ -5,53 +5,157 @@ package log
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"time"
 )
 
+// streamEntryMarker starts entries written to a stream. Plain entries start with time.MarshalBinary version,
+// which is never 0x80.
+const streamEntryMarker byte = 0x80
+
+const (
+	timeSize          = 15
+	lengthSize        = 4
+	streamLengthSize  = 1
+	streamVersionSize = 8
+)
+
+// logEntry is an entry stored in a segment file. Stream is empty for entries not written to a stream.
+//
+// Plain entry is encoded as: time (15 bytes), data length (uint32) and data.
+// Stream entry is encoded as: marker (0x80), time (15 bytes), stream length (uint8), stream, version (uint64),
+// data length (uint32) and data.
+type logEntry struct {
+	time    time.Time
+	data    []byte
+	stream  string
+	version uint64
+}
+
+func (e logEntry) size() int64 {
+	size := timeSize + lengthSize + int64(len(e.data))
+	if e.stream != "" {
+		size += 1 + streamLengthSize + int64(len(e.stream)) + streamVersionSize
+	}
+
+	return size
+}
+
 func decodeEntry(reader io.Reader) (time.Time, []byte, error) {
-	t := time.Time{}
+	e, err := decodeLogEntry(reader)
 
-	bytes := make([]byte, 15)
+	return e.time, e.data, err
+}
+
+func decodeLogEntry(reader io.Reader) (logEntry, error) {
+	return decodeLogEntryUpTo(reader, math.MaxInt64)
+}
 
-	_, err := io.ReadAtLeast(reader, bytes, 15)
+// decodeLogEntryUpTo works like decodeLogEntry, but does not allocate data when the entry would be longer than
+// maxSize bytes. Error wrapping io.ErrUnexpectedEOF is returned instead.
+func decodeLogEntryUpTo(reader io.Reader, maxSize int64) (logEntry, error) {
+	bytes := make([]byte, timeSize)
+
+	_, err := io.ReadAtLeast(reader, bytes, timeSize)
 	if err != nil {
-		return time.Time{}, nil, fmt.Errorf("reading entry time failed: %w", err)
+		return logEntry{}, fmt.Errorf("reading entry time failed: %w", err)
 	}
 
-	if err = t.UnmarshalBinary(bytes[:15]); err != nil {
-		return time.Time{}, nil, fmt.Errorf("unmarshaling entry time failed: %w", err)
+	streamEntry := bytes[0] == streamEntryMarker
+	if streamEntry {
+		// time starts after the marker, so one more byte must be read
+		copy(bytes, bytes[1:])
+
+		if _, err = io.ReadFull(reader, bytes[timeSize-1:]); err != nil {
+			return logEntry{}, fmt.Errorf("reading entry time failed: %w", unexpectedEOF(err))
+		}
+	}
+
+	e := logEntry{}
+
+	if err = e.time.UnmarshalBinary(bytes); err != nil {
+		return logEntry{}, fmt.Errorf("unmarshaling entry time failed: %w", err)
+	}
+
+	if streamEntry {
+		if e.stream, e.version, err = decodeStream(reader); err != nil {
+			return logEntry{}, err
+		}
 	}
 
 	var length uint32
 	if err = binary.Read(reader, binary.LittleEndian, &length); err != nil {
-		return time.Time{}, nil, fmt.Errorf("reading entry len failed: %w", err)
+		return logEntry{}, fmt.Errorf("reading entry len failed: %w", unexpectedEOF(err))
+	}
+
+	if e.size()+int64(length) > maxSize {
+		return logEntry{}, fmt.Errorf("entry data len %d exceeds remaining %d bytes: %w",
+			length, maxSize-e.size(), io.ErrUnexpectedEOF)
 	}
 
-	data := make([]byte, length)
-	if _, err = reader.Read(data); err != nil {
-		return time.Time{}, nil, fmt.Errorf("reading entry data failed: %w", err)
+	e.data = make([]byte, length)
+	if _, err = io.ReadFull(reader, e.data); err != nil {
+		return logEntry{}, fmt.Errorf("reading entry data failed: %w", unexpectedEOF(err))
 	}
 
-	return t, data, nil
+	return e, nil
 }
 
-func encodeEntry(writer io.Writer, t time.Time, entry []byte) error {
-	timeBinary, err := t.MarshalBinary()
+func decodeStream(reader io.Reader) (stream string, version uint64, err error) {
+	var streamLength [streamLengthSize]byte
+	if _, err = io.ReadFull(reader, streamLength[:]); err != nil {
+		return "", 0, fmt.Errorf("reading entry stream len failed: %w", unexpectedEOF(err))
+	}
+
+	streamBytes := make([]byte, streamLength[0])
+	if _, err = io.ReadFull(reader, streamBytes); err != nil {
+		return "", 0, fmt.Errorf("reading entry stream failed: %w", unexpectedEOF(err))
+	}
+
+	if err = binary.Read(reader, binary.LittleEndian, &version); err != nil {
+		return "", 0, fmt.Errorf("reading entry stream version failed: %w", unexpectedEOF(err))
+	}
+
+	return string(streamBytes), version, nil
+}
+
+// unexpectedEOF converts io.EOF to io.ErrUnexpectedEOF. Should be used when entry was read partially.
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+func encodeLogEntry(writer io.Writer, e logEntry) error {
+	timeBinary, err := e.time.MarshalBinary()
 	if err != nil {
 		return fmt.Errorf("marshaling entry time failed: %w", err)
 	}
 
-	if _, err = writer.Write(timeBinary); err != nil {
-		return fmt.Errorf("writing entry time failed: %w", err)
+	header := make([]byte, 0, e.size()-int64(len(e.data)))
+
+	if e.stream != "" {
+		header = append(header, streamEntryMarker)
+		header = append(header, timeBinary...)
+		header = append(header, byte(len(e.stream)))
+		header = append(header, e.stream...)
+		header = binary.LittleEndian.AppendUint64(header, e.version)
+	} else {
+		header = append(header, timeBinary...)
 	}
 
-	if err = binary.Write(writer, binary.LittleEndian, uint32(len(entry))); err != nil {
-		return fmt.Errorf("writing entry len failed: %w", err)
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(e.data)))
+
+	if _, err = writer.Write(header); err != nil {
+		return fmt.Errorf("writing entry header failed: %w", err)
 	}
 
-	if _, err = writer.Write(entry); err != nil {
+	if _, err = writer.Write(e.data); err != nil {
 		return fmt.Errorf("writing entry data failed: %w", err)
 	}
 
@@ -9,4 +9,19 @@ var (
 	ErrEOL              = errors.New("eol (end of log):  reading log finished")
 	ErrLocked           = errors.New("log is already locked for writing")
 	ErrInvalidParameter = errors.New("invalid parameter")
+	// ErrSegmentCompacted is returned by Reader when the next segment was removed (for example by compacter)
+	// after the Reader was opened. Entries from removed segment are lost, but the Reader can still be used -
+	// next Read will return entries from the following segment.
+	ErrSegmentCompacted = errors.New("segment was removed before it could be read")
+	// ErrMirrorQuorum is returned by Writer when entry was written to the log, but not to the required number
+	// of mirrors. The entry is durably stored in the log directory and will be read by Readers, so it must not
+	// be written again - retrying would create a duplicate.
+	ErrMirrorQuorum = errors.New("entry was not written to the required number of mirrors")
+	// ErrMirrorDiverged is returned when opening the Writer, if mirror contains segments newer than the last segment
+	// in the log directory. Such mirror is not resynchronized, because the log directory might be wrong or lost.
+	ErrMirrorDiverged = errors.New("mirror contains segments newer than the log")
+	// ErrSegmentCorrupt is returned when opening the Writer, if the last segment contains bytes which cannot be
+	// decoded and are not a torn tail. New entries appended to such segment would not be readable. Use Log.Repair
+	// to quarantine the segment.
+	ErrSegmentCorrupt = errors.New("segment is corrupt")
 )
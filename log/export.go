@@ -0,0 +1,252 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+type ExportFormat string
+
+const (
+	// FormatNDJSON is newline delimited JSON. Each line is an object with "time" (RFC 3339 with nanoseconds)
+	// and "data" (base64 encoded entry) fields. Stream entries have additional "stream" and "version" fields.
+	FormatNDJSON ExportFormat = "ndjson"
+	// FormatNDJSONInline is like FormatNDJSON, but entry is stored inline as JSON in the "json" field. All entries must
+	// be valid JSON. Entries are compacted, so whitespace is not preserved.
+	FormatNDJSONInline ExportFormat = "ndjson-inline"
+	// FormatBinary starts with a magic header followed by entries encoded the same way as in segment files:
+	// time (15 bytes, see time.Time.MarshalBinary), data length (uint32, little endian) and data. Stream entries
+	// are prefixed with 0x80 marker and have stream and version encoded after the time.
+	FormatBinary ExportFormat = "binary"
+)
+
+var binaryExportMagic = []byte("LOGSTORE\x00\x01")
+
+type exportedEntry struct {
+	Time    time.Time       `json:"time"`
+	Stream  string          `json:"stream,omitempty"`
+	Version uint64          `json:"version,omitempty"`
+	Data    []byte          `json:"data,omitempty"`
+	JSON    json.RawMessage `json:"json,omitempty"`
+}
+
+// Export writes all entries returned by reader to w. Reading finishes on ErrEOL. Entries from segments removed
+// during export are skipped. Stream IDs and versions are exported when reader implements StreamEntryReader.
+// Export returns the number of exported entries.
+func Export(reader Reader, w io.Writer, format ExportFormat) (int, error) {
+	if reader == nil {
+		return 0, fmt.Errorf("nil reader: %w", ErrInvalidParameter)
+	}
+
+	if w == nil {
+		return 0, fmt.Errorf("nil writer: %w", ErrInvalidParameter)
+	}
+
+	bufferedWriter := bufio.NewWriter(w)
+
+	var writeEntry func(e logEntry) error
+
+	switch format {
+	case FormatNDJSON:
+		encoder := json.NewEncoder(bufferedWriter)
+		writeEntry = func(e logEntry) error {
+			return encoder.Encode(exportedEntry{Time: e.time, Stream: e.stream, Version: e.version, Data: e.data})
+		}
+	case FormatNDJSONInline:
+		encoder := json.NewEncoder(bufferedWriter)
+		writeEntry = func(e logEntry) error {
+			if !json.Valid(e.data) {
+				return fmt.Errorf("entry %s is not a valid JSON", e.time.Format(time.RFC3339Nano))
+			}
+
+			return encoder.Encode(exportedEntry{Time: e.time, Stream: e.stream, Version: e.version, JSON: e.data})
+		}
+	case FormatBinary:
+		if _, err := bufferedWriter.Write(binaryExportMagic); err != nil {
+			return 0, err
+		}
+
+		writeEntry = func(e logEntry) error {
+			return encodeLogEntry(bufferedWriter, e)
+		}
+	default:
+		return 0, fmt.Errorf("unsupported format %q: %w", format, ErrInvalidParameter)
+	}
+
+	readEntry := func() (logEntry, error) {
+		t, data, err := reader.Read()
+
+		return logEntry{time: t, data: data}, err
+	}
+
+	if streamReader, ok := reader.(StreamEntryReader); ok {
+		readEntry = func() (logEntry, error) {
+			t, stream, version, data, err := streamReader.ReadStreamEntry()
+
+			return logEntry{time: t, stream: stream, version: version, data: data}, err
+		}
+	}
+
+	count := 0
+
+	for {
+		e, err := readEntry()
+		if errors.Is(err, ErrEOL) {
+			return count, bufferedWriter.Flush()
+		}
+
+		if errors.Is(err, ErrSegmentCompacted) {
+			continue
+		}
+
+		if err != nil {
+			return count, err
+		}
+
+		if err = writeEntry(e); err != nil {
+			return count, fmt.Errorf("exporting entry failed: %w", err)
+		}
+
+		count++
+	}
+}
+
+// ImportError is returned by Import when the input is invalid. Line is a line number for NDJSON input and
+// entry number for binary input, counting from 1.
+type ImportError struct {
+	Line int
+	Err  error
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e *ImportError) Unwrap() error {
+	return e.Err
+}
+
+// Import writes entries exported by Export to the writer, preserving their times, streams and versions. Format is
+// detected automatically.
+// Entries must be ordered by time and must be written after the last entry already stored in the log.
+// Import returns the number of imported entries.
+func Import(r io.Reader, writer *Writer) (int, error) {
+	if r == nil {
+		return 0, fmt.Errorf("nil reader: %w", ErrInvalidParameter)
+	}
+
+	if writer == nil {
+		return 0, fmt.Errorf("nil writer: %w", ErrInvalidParameter)
+	}
+
+	bufferedReader := bufio.NewReader(r)
+
+	header, err := bufferedReader.Peek(len(binaryExportMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+
+	readEntry := readNDJSONEntry
+
+	if bytes.Equal(header, binaryExportMagic) {
+		_, _ = bufferedReader.Discard(len(binaryExportMagic))
+		readEntry = readBinaryEntry
+	}
+
+	var (
+		count    int
+		lastTime time.Time
+	)
+
+	for line := 1; ; line++ {
+		e, err := readEntry(bufferedReader)
+		if errors.Is(err, io.EOF) {
+			return count, nil
+		}
+
+		if errors.Is(err, errEmptyLine) {
+			continue
+		}
+
+		if err != nil {
+			return count, &ImportError{Line: line, Err: err}
+		}
+
+		if count > 0 && !e.time.After(lastTime) {
+			return count, &ImportError{
+				Line: line,
+				Err: fmt.Errorf("entry time %s is not after previous entry time %s: %w",
+					e.time.Format(time.RFC3339Nano), lastTime.Format(time.RFC3339Nano), ErrInvalidParameter),
+			}
+		}
+
+		if err = writeImportedEntry(writer, e); err != nil {
+			return count, &ImportError{Line: line, Err: err}
+		}
+
+		lastTime = e.time
+		count++
+	}
+}
+
+func writeImportedEntry(writer *Writer, e logEntry) error {
+	if e.stream == "" {
+		return writer.WriteWithTime(e.time, e.data)
+	}
+
+	return writer.WriteToStreamWithTime(e.time, e.stream, e.version, e.data)
+}
+
+var errEmptyLine = errors.New("empty line")
+
+func readNDJSONEntry(r *bufio.Reader) (logEntry, error) {
+	line, err := r.ReadBytes('\n')
+	if errors.Is(err, io.EOF) && len(line) > 0 {
+		err = nil // last line without new line character
+	}
+
+	if err != nil {
+		return logEntry{}, err
+	}
+
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return logEntry{}, errEmptyLine
+	}
+
+	var entry exportedEntry
+	if err = json.Unmarshal(line, &entry); err != nil {
+		return logEntry{}, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	if entry.Time.IsZero() {
+		return logEntry{}, errors.New(`missing "time" field`)
+	}
+
+	if entry.Stream != "" && entry.Version == 0 {
+		return logEntry{}, errors.New(`missing "version" field`)
+	}
+
+	data := entry.Data
+	if entry.JSON != nil {
+		data = entry.JSON
+	}
+
+	if data == nil {
+		data = []byte{}
+	}
+
+	return logEntry{time: entry.Time, data: data, stream: entry.Stream, version: entry.Version}, nil
+}
+
+func readBinaryEntry(r *bufio.Reader) (logEntry, error) {
+	return decodeLogEntry(r)
+}
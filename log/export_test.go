@@ -0,0 +1,190 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package log_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elgopher/logstore/internal/tests"
+	"github.com/elgopher/logstore/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport(t *testing.T) {
+	t.Run("should return error for invalid parameters", func(t *testing.T) {
+		reader := tests.OpenLogReader(t)
+		_, err := log.Export(nil, &bytes.Buffer{}, log.FormatNDJSON)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+		_, err = log.Export(reader, nil, log.FormatNDJSON)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+		_, err = log.Export(reader, &bytes.Buffer{}, "xml")
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should export entries as NDJSON", func(t *testing.T) {
+		l := writeJSONEntries(t)
+		var output bytes.Buffer
+		// when
+		count, err := log.Export(tests.OpenReader(t, l), &output, log.FormatNDJSON)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+		expected := `{"time":"2005-02-04T20:01:37Z","data":"eyJhIjoxfQ=="}` + "\n" +
+			`{"time":"2006-01-02T15:04:05Z","data":"eyJhIjoyfQ=="}` + "\n"
+		assert.Equal(t, expected, output.String())
+	})
+
+	t.Run("should export entries as inline JSON", func(t *testing.T) {
+		l := writeJSONEntries(t)
+		var output bytes.Buffer
+		// when
+		_, err := log.Export(tests.OpenReader(t, l), &output, log.FormatNDJSONInline)
+		// then
+		require.NoError(t, err)
+		expected := `{"time":"2005-02-04T20:01:37Z","json":{"a":1}}` + "\n" +
+			`{"time":"2006-01-02T15:04:05Z","json":{"a":2}}` + "\n"
+		assert.Equal(t, expected, output.String())
+	})
+
+	t.Run("should return error when entry is not JSON and inline JSON format is used", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		require.NoError(t, writer.WriteWithTime(time2005, data1))
+		// when
+		_, err := log.Export(tests.OpenReader(t, l), &bytes.Buffer{}, log.FormatNDJSONInline)
+		// then
+		assert.Error(t, err)
+	})
+}
+
+func TestImport(t *testing.T) {
+	formats := []log.ExportFormat{log.FormatNDJSON, log.FormatNDJSONInline, log.FormatBinary}
+
+	for _, format := range formats {
+		t.Run(string(format)+" export should be imported", func(t *testing.T) {
+			src := writeJSONEntries(t)
+			var exported bytes.Buffer
+			_, err := log.Export(tests.OpenReader(t, src), &exported, format)
+			require.NoError(t, err)
+			dst, writer := tests.OpenLogWithWriter(t)
+			// when
+			count, err := log.Import(&exported, writer)
+			// then
+			require.NoError(t, err)
+			assert.Equal(t, 2, count)
+			assert.Equal(t, tests.ReadAll(t, src), tests.ReadAll(t, dst))
+		})
+	}
+
+	for _, format := range formats {
+		t.Run(string(format)+" export should preserve streams", func(t *testing.T) {
+			src, writer := tests.OpenLogWithWriter(t)
+			_, _, err := writer.WriteToStream("order-1", []byte(`{"a":1}`))
+			require.NoError(t, err)
+			_, err = writer.Write([]byte(`{"a":2}`))
+			require.NoError(t, err)
+			_, _, err = writer.WriteToStream("order-1", []byte(`{"a":3}`))
+			require.NoError(t, err)
+			var exported bytes.Buffer
+			_, err = log.Export(tests.OpenReader(t, src), &exported, format)
+			require.NoError(t, err)
+			dst, dstWriter := tests.OpenLogWithWriter(t)
+			// when
+			count, err := log.Import(&exported, dstWriter)
+			// then
+			require.NoError(t, err)
+			assert.Equal(t, 3, count)
+			assert.Equal(t, readStream(t, src, "order-1"), readStream(t, dst, "order-1"))
+			version, err := dstWriter.StreamVersion("order-1")
+			require.NoError(t, err)
+			assert.Equal(t, uint64(2), version)
+		})
+	}
+
+	t.Run("should return error for invalid parameters", func(t *testing.T) {
+		writer := tests.OpenLogWriter(t)
+		_, err := log.Import(nil, writer)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+		_, err = log.Import(strings.NewReader(""), nil)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should import empty input", func(t *testing.T) {
+		writer := tests.OpenLogWriter(t)
+		count, err := log.Import(strings.NewReader(""), writer)
+		require.NoError(t, err)
+		assert.Zero(t, count)
+	})
+
+	t.Run("should skip empty lines and accept last line without new line", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		input := `{"time":"2005-02-04T20:01:37Z","data":"ZGF0YTE="}` + "\n\n" +
+			`{"time":"2006-01-02T15:04:05Z","json":"x"}`
+		// when
+		count, err := log.Import(strings.NewReader(input), writer)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+		entries := tests.ReadAll(t, l)
+		assert.Equal(t, data1, entries[0].Data)
+		assert.Equal(t, []byte(`"x"`), entries[1].Data)
+	})
+
+	t.Run("should reject out of order entries with line number", func(t *testing.T) {
+		writer := tests.OpenLogWriter(t)
+		input := `{"time":"2006-01-02T15:04:05Z","data":""}` + "\n" +
+			`{"time":"2005-02-04T20:01:37Z","data":""}` + "\n"
+		// when
+		count, err := log.Import(strings.NewReader(input), writer)
+		// then
+		var importErr *log.ImportError
+		require.ErrorAs(t, err, &importErr)
+		assert.Equal(t, 2, importErr.Line)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("should reject entries written before the last entry in the log", func(t *testing.T) {
+		writer := tests.OpenLogWriter(t)
+		require.NoError(t, writer.WriteWithTime(time2006, data1))
+		input := `{"time":"2005-02-04T20:01:37Z","data":""}` + "\n"
+		// when
+		_, err := log.Import(strings.NewReader(input), writer)
+		// then
+		var importErr *log.ImportError
+		require.ErrorAs(t, err, &importErr)
+		assert.Equal(t, 1, importErr.Line)
+	})
+
+	t.Run("should reject invalid lines", func(t *testing.T) {
+		inputs := map[string]string{
+			"invalid JSON":    `{"time":`,
+			"missing time":    `{"data":""}`,
+			"missing version": `{"time":"2005-02-04T20:01:37Z","stream":"order-1","data":""}`,
+		}
+
+		for name, input := range inputs {
+			t.Run(name, func(t *testing.T) {
+				writer := tests.OpenLogWriter(t)
+				_, err := log.Import(strings.NewReader(input), writer)
+				var importErr *log.ImportError
+				require.ErrorAs(t, err, &importErr)
+				assert.Equal(t, 1, importErr.Line)
+			})
+		}
+	})
+}
+
+func writeJSONEntries(t *testing.T) *log.Log {
+	t.Helper()
+
+	l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentDuration(time.Minute))
+	require.NoError(t, writer.WriteWithTime(time2005, []byte(`{"a":1}`)))
+	require.NoError(t, writer.WriteWithTime(time2006, []byte(`{"a":2}`)))
+
+	return l
+}
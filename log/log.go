@@ -4,8 +4,10 @@
 package log
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"strings"
@@ -22,6 +24,10 @@ type Log struct {
 	dir string
 }
 
+func (l *Log) Dir() string {
+	return l.dir
+}
+
 func (l *Log) OpenWriter(options ...OpenWriterOption) (*Writer, error) {
 	return l.openWriter(options)
 }
@@ -32,6 +38,9 @@ type WriterSettings struct {
 	now                 func() time.Time
 	maxSegmentSizeBytes int64
 	maxSegmentDuration  time.Duration
+	mirrors             []string
+	mirrorQuorum        int
+	observer            WriterObserver
 }
 
 func NowFunc(f func() time.Time) OpenWriterOption {
@@ -58,6 +67,34 @@ func MaxSegmentDuration(duration time.Duration) OpenWriterOption {
 	}
 }
 
+// Mirrors makes the Writer write every entry also to given directories. Each mirror is an exact copy of the log
+// directory. Entries are synced to disk before Write returns. Lagging mirrors are resynchronized when the Writer
+// is opened. When the log directory is empty (for example lost), it is restored from the mirror. OpenWriter returns
+// ErrMirrorDiverged when the mirror has segments newer than the log directory. Segments removed from the log
+// directory by compaction are removed from mirrors when the Writer rolls over to a new segment.
+func Mirrors(dirs ...string) OpenWriterOption {
+	return func(s *WriterSettings) error {
+		s.mirrors = append(s.mirrors, dirs...)
+
+		return nil
+	}
+}
+
+// MirrorQuorum sets the number of mirrors which must store the entry, before it is acknowledged. By default,
+// all mirrors must store it. Failed mirrors are not written anymore, until the Writer is opened again. When quorum
+// is not reached, the entry is still written to the log and ErrMirrorQuorum is returned.
+func MirrorQuorum(n int) OpenWriterOption {
+	return func(s *WriterSettings) error {
+		if n < 0 {
+			return fmt.Errorf("negative mirror quorum: %w", ErrInvalidParameter)
+		}
+
+		s.mirrorQuorum = n
+
+		return nil
+	}
+}
+
 func (l *Log) OpenReader(options ...OpenReaderOption) (Reader, error) {
 	return l.openReader(options)
 }
@@ -66,6 +103,11 @@ type OpenReaderOption func(*ReaderSettings) error
 
 type ReaderSettings struct {
 	openOldestSegment func(dir string, segments []Segment) (*os.File, int, error)
+	seeking           bool
+	startingFrom      time.Time
+	stream            string
+	pollInterval      time.Duration
+	observer          ReaderObserver
 }
 
 func StartingFrom(t time.Time) OpenReaderOption {
@@ -73,6 +115,36 @@ func StartingFrom(t time.Time) OpenReaderOption {
 		s.openOldestSegment = func(dir string, segments []Segment) (*os.File, int, error) {
 			return openSegmentStartingAt(t, dir, segments)
 		}
+		s.seeking = true
+		s.startingFrom = t
+
+		return nil
+	}
+}
+
+// ForStream makes the Reader return only entries written to the stream using Writer.WriteToStream. Entries are
+// found using the per-segment stream index, so other entries are not read. Returned Reader implements StreamReader.
+func ForStream(stream string) OpenReaderOption {
+	return func(s *ReaderSettings) error {
+		if err := validateStream(stream); err != nil {
+			return err
+		}
+
+		s.stream = stream
+
+		return nil
+	}
+}
+
+// PollInterval sets how often the Reader opened by OpenTailReader checks for new entries. Default is 100ms.
+// OpenReader ignores this option.
+func PollInterval(d time.Duration) OpenReaderOption {
+	return func(s *ReaderSettings) error {
+		if d <= 0 {
+			return fmt.Errorf("poll interval must be positive: %w", ErrInvalidParameter)
+		}
+
+		s.pollInterval = d
 
 		return nil
 	}
@@ -94,8 +166,18 @@ func (l *Log) Segments() ([]Segment, error) {
 	for _, f := range files {
 		name := f.Name()
 		if !f.IsDir() && strings.HasSuffix(name, ".segment") {
+			info, err := f.Info()
+			if errors.Is(err, os.ErrNotExist) {
+				// segment was removed in the meantime
+				continue
+			}
+
+			if err != nil {
+				return nil, fmt.Errorf("reading file info failed: %w", err)
+			}
+
 			file := segmentFilename(name)
-			segment := Segment{StartingAt: file.StartedAt()}
+			segment := Segment{StartingAt: file.StartedAt(), SizeBytes: info.Size()}
 			segments = append(segments, segment)
 		}
 	}
@@ -119,45 +201,161 @@ func (l *Log) RemoveSegmentStartingAt(t time.Time) error {
 		return fmt.Errorf("removing file %s failed %w", segmentFilename, err)
 	}
 
-	return nil
+	return removeStreamIndex(l.dir, t)
 }
 
+// MoveSegmentStartingAt moves the segment file to another log directory (for example an archive). When the file
+// cannot be renamed (for example because destination is on another filesystem), it is copied and then removed.
+// The last (active) segment cannot be moved.
+func (l *Log) MoveSegmentStartingAt(t time.Time, dst *Log) error {
+	if dst == nil {
+		return fmt.Errorf("nil destination log: %w", ErrInvalidParameter)
+	}
+
+	segments, err := l.Segments()
+	if err != nil {
+		return fmt.Errorf("listing segments failed: %w", err)
+	}
+
+	if len(segments) > 0 && segments[len(segments)-1].StartingAt.Equal(t) {
+		return fmt.Errorf("cant move last segment: %w", ErrInvalidParameter)
+	}
+
+	if err = mkdirIfMissing(dst.dir); err != nil {
+		return err
+	}
+
+	return moveSegment(l.dir, dst.dir, t)
+}
+
+// MergeSegments merges all segments starting between first and last (inclusive) into one segment starting at first.
+// Merged file atomically replaces the first segment and then remaining segments are removed. Readers skip entries
+// which were already returned, therefore entries are never duplicated, even if the process crashes in the middle
+// of the operation. The last (active) segment cannot be merged.
+func (l *Log) MergeSegments(first, last time.Time) error {
+	segments, err := l.Segments()
+	if err != nil {
+		return fmt.Errorf("listing segments failed: %w", err)
+	}
+
+	if len(segments) > 0 && !segments[len(segments)-1].StartingAt.After(last) {
+		return fmt.Errorf("cant merge last segment: %w", ErrInvalidParameter)
+	}
+
+	var merged []Segment
+
+	for _, segment := range segments {
+		if !segment.StartingAt.Before(first) && !segment.StartingAt.After(last) {
+			merged = append(merged, segment)
+		}
+	}
+
+	if len(merged) < 2 || !merged[0].StartingAt.Equal(first) {
+		return fmt.Errorf("at least two segments, starting with the first one, must be merged: %w",
+			ErrInvalidParameter)
+	}
+
+	return mergeSegments(l.dir, merged)
+}
+
+// FilterSegmentStartingAt rewrites the segment keeping only entries for which keep returns true. Entries preserve
+// their original time. The rewritten segment file atomically replaces the original one. The last (active) segment
+// cannot be rewritten.
+func (l *Log) FilterSegmentStartingAt(t time.Time, keep func(t time.Time, data []byte) bool) (kept, removed int, err error) {
+	if keep == nil {
+		return 0, 0, fmt.Errorf("nil keep function: %w", ErrInvalidParameter)
+	}
+
+	segments, err := l.Segments()
+	if err != nil {
+		return 0, 0, fmt.Errorf("listing segments failed: %w", err)
+	}
+
+	if len(segments) > 0 && segments[len(segments)-1].StartingAt.Equal(t) {
+		return 0, 0, fmt.Errorf("cant rewrite last segment: %w", ErrInvalidParameter)
+	}
+
+	return filterSegment(l.dir, t, keep)
+}
+
+// TruncateAfter removes all entries written after t. It opens a Writer, therefore ErrLocked is returned
+// when the log is already locked for writing. Use Writer.TruncateAfter in such case.
+func (l *Log) TruncateAfter(t time.Time) error {
+	writer, err := l.OpenWriter()
+	if err != nil {
+		return err
+	}
+
+	if err = writer.TruncateAfter(t); err != nil {
+		_ = writer.Close()
+
+		return err
+	}
+
+	return writer.Close()
+}
+
+// LastEntry returns the last entry in the log. Only the last non-empty segment is read.
 func (l *Log) LastEntry() (time.Time, []byte, error) {
-	reader, err := l.OpenReader()
+	segments, err := l.Segments()
 	if err != nil {
 		return time.Time{}, nil, err
 	}
 
+	for i := len(segments) - 1; i >= 0; i-- {
+		e, found, err := lastSegmentEntry(l.dir, segments[i])
+		if errors.Is(err, os.ErrNotExist) {
+			// segment was removed after listing
+			continue
+		}
+
+		if err != nil {
+			return time.Time{}, nil, fmt.Errorf("error reading last entry time from segment file: %w", err)
+		}
+
+		if found {
+			return e.time, e.data, nil
+		}
+	}
+
+	return time.Time{}, nil, fmt.Errorf("log is empty: %w", ErrEOL)
+}
+
+func lastSegmentEntry(dir string, segment Segment) (logEntry, bool, error) {
+	f, err := openSegmentFileForRead(dir, segment)
+	if err != nil {
+		return logEntry{}, false, err
+	}
+
 	defer func() {
-		_ = reader.Close()
+		_ = f.Close()
 	}()
 
 	var (
-		lastTime   time.Time
-		lastData   []byte
+		reader     = bufio.NewReader(f)
+		last       logEntry
 		entryFound bool
 	)
 
 	for {
-		t, data, err := reader.Read()
-		if errors.Is(err, ErrEOL) {
-			if !entryFound {
-				return time.Time{}, nil, fmt.Errorf("log is empty: %w", ErrEOL)
-			}
-
-			return lastTime, lastData, nil
+		e, err := decodeLogEntry(reader)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			// torn tail is not fully written yet
+			return last, entryFound, nil
 		}
 
 		if err != nil {
-			return time.Time{}, nil, fmt.Errorf("error reading last entry time from segment file: %w", err)
+			return logEntry{}, false, err
 		}
 
-		lastTime = t
-		lastData = data
-		entryFound = true
+		if !entryFound || e.time.After(last.time) {
+			last = e
+			entryFound = true
+		}
 	}
 }
 
 type Segment struct {
 	StartingAt time.Time
+	SizeBytes  int64
 }
@@ -4,7 +4,9 @@
 package log_test
 
 import (
+	"os"
 	"path"
+	"runtime"
 	"testing"
 	"time"
 
@@ -99,6 +101,42 @@ func TestLog_OpenWriter(t *testing.T) {
 		// then
 		assert.ErrorIs(t, err, log.ErrLocked)
 	})
+
+	t.Run("should truncate torn tail of the last segment", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		require.NoError(t, writer.WriteWithTime(time2005, data1))
+		require.NoError(t, writer.Close())
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		appendToSegment(t, l, segments[0], []byte{1, 0, 0})
+		// when
+		writer, err = l.OpenWriter()
+		require.NoError(t, err)
+		defer tests.Close(t, writer)
+		// then
+		require.NoError(t, writer.WriteWithTime(time2006, data2))
+		expected := []tests.Entry{
+			{Time: time2005, Data: data1},
+			{Time: time2006, Data: data2},
+		}
+		assert.Equal(t, expected, tests.ReadAll(t, l))
+	})
+
+	t.Run("should return error when entry length in the last segment is corrupt", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		require.NoError(t, writer.WriteWithTime(time2005, data1))
+		require.NoError(t, writer.WriteWithTime(time2005.Add(time.Second), data2))
+		require.NoError(t, writer.Close())
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		require.Len(t, segments, 1)
+		corruptFirstEntryLength(t, l, segments[0])
+		// when
+		writer, err = l.OpenWriter()
+		defer tests.Close(t, writer)
+		// then
+		assert.ErrorIs(t, err, log.ErrSegmentCorrupt)
+	})
 }
 
 func TestLog_Segments(t *testing.T) {
@@ -221,6 +259,312 @@ func TestLog_LastEntry(t *testing.T) {
 		assert.Equal(t, data2, bytes)
 		assert.True(t, t2.Equal(actualTime))
 	})
+
+	t.Run("should return last entry when last segment is empty", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentDuration(time.Minute))
+		require.NoError(t, writer.WriteWithTime(time2005, data1))
+		require.NoError(t, writer.WriteWithTime(time2006, data2))
+		require.NoError(t, writer.Close())
+		emptySegment := log.Segment{StartingAt: time2006.Add(time.Hour)}
+		require.NoError(t, os.WriteFile(path.Join(l.Dir(), segmentFilename(emptySegment)), nil, 0600))
+		// when
+		actualTime, bytes, err := l.LastEntry()
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, data2, bytes)
+		assert.True(t, time2006.Equal(actualTime))
+	})
+}
+
+func TestLog_MoveSegmentStartingAt(t *testing.T) {
+	t.Run("should return error for nil destination", func(t *testing.T) {
+		l := log.New(tests.TempDir(t))
+		err := l.MoveSegmentStartingAt(time2005, nil)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should not be possible to move last segment", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		require.NoError(t, writer.WriteWithTime(time2005, data1))
+		archive := log.New(tests.TempDir(t))
+		// when
+		err := l.MoveSegmentStartingAt(time2005, archive)
+		// then
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should move segment to another log", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentDuration(time.Minute))
+		t2 := time2005.Add(time.Hour)
+		require.NoError(t, writer.WriteWithTime(time2005, data1))
+		require.NoError(t, writer.WriteWithTime(t2, data2))
+		archive := log.New(path.Join(tests.TempDir(t), "archive"))
+		// when
+		err := l.MoveSegmentStartingAt(time2005, archive)
+		// then
+		require.NoError(t, err)
+		assert.Empty(t, tests.ReadAll(t, l))
+		archived := tests.ReadAll(t, archive, log.StartingFrom(t2))
+		assert.Equal(t, []tests.Entry{{Time: t2, Data: data2}}, archived)
+	})
+}
+
+func TestLog_MergeSegments(t *testing.T) {
+	t.Run("should not be possible to merge last segment", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentSizeMB(1))
+		tests.WriteEntry(t, writer, tests.OneMegabyte)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		// when
+		err = l.MergeSegments(segments[0].StartingAt, segments[1].StartingAt)
+		// then
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error when less than two segments would be merged", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentSizeMB(1))
+		tests.WriteEntry(t, writer, tests.OneMegabyte)
+		tests.WriteEntry(t, writer, tests.OneMegabyte)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		// when
+		err = l.MergeSegments(segments[0].StartingAt, segments[0].StartingAt)
+		// then
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should merge segments", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentSizeMB(1))
+		for i := 0; i < 3; i++ {
+			tests.WriteEntry(t, writer, tests.OneMegabyte)
+		}
+		entriesBefore := tests.ReadAll(t, l)
+		segmentsBefore, err := l.Segments()
+		require.NoError(t, err)
+		// when
+		err = l.MergeSegments(segmentsBefore[0].StartingAt, segmentsBefore[2].StartingAt)
+		// then
+		require.NoError(t, err)
+		segmentsAfter, err := l.Segments()
+		require.NoError(t, err)
+		require.Len(t, segmentsAfter, 2)
+		assert.Equal(t, segmentsBefore[0].StartingAt, segmentsAfter[0].StartingAt)
+		assert.Equal(t, segmentsBefore[3], segmentsAfter[1])
+		assert.Equal(t, entriesBefore, tests.ReadAll(t, l))
+	})
+
+	t.Run("should not break reader reading merged segment", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("file opened by reader cannot be replaced on Windows")
+		}
+
+		l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentSizeMB(1))
+		for i := 0; i < 3; i++ {
+			tests.WriteEntry(t, writer, tests.OneMegabyte)
+		}
+		entriesBefore := tests.ReadAll(t, l)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		reader := tests.OpenReader(t, l)
+		firstTime, _, err := reader.Read()
+		require.NoError(t, err)
+		// when
+		err = l.MergeSegments(segments[0].StartingAt, segments[2].StartingAt)
+		// then
+		require.NoError(t, err)
+		var times []time.Time
+		for i := 1; i < len(entriesBefore); i++ {
+			entryTime, _, err := reader.Read()
+			require.NoError(t, err)
+			times = append(times, entryTime)
+		}
+		_, _, err = reader.Read()
+		assert.ErrorIs(t, err, log.ErrEOL)
+		assert.Equal(t, entriesBefore[0].Time, firstTime)
+		assert.Equal(t, entriesBefore[1].Time, times[0])
+		assert.Equal(t, entriesBefore[2].Time, times[1])
+	})
+
+	t.Run("should not break reader reading segment in the middle of merged segments", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("file opened by reader cannot be replaced on Windows")
+		}
+
+		l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentSizeMB(1))
+		for i := 0; i < 4; i++ {
+			tests.WriteEntry(t, writer, tests.OneMegabyte)
+		}
+		entriesBefore := tests.ReadAll(t, l)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		reader := tests.OpenReader(t, l)
+		for i := 0; i < 2; i++ {
+			_, _, err = reader.Read()
+			require.NoError(t, err)
+		}
+		// when
+		err = l.MergeSegments(segments[0].StartingAt, segments[2].StartingAt)
+		// then
+		require.NoError(t, err)
+		for i := 2; i < len(entriesBefore); i++ {
+			entryTime, _, err := reader.Read()
+			require.NoError(t, err)
+			assert.Equal(t, entriesBefore[i].Time, entryTime)
+		}
+	})
+
+	t.Run("should not duplicate entries when merge was interrupted", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentSizeMB(1))
+		for i := 0; i < 2; i++ {
+			tests.WriteEntry(t, writer, tests.OneMegabyte)
+		}
+		entriesBefore := tests.ReadAll(t, l)
+		simulateInterruptedMerge(t, l.Dir())
+		// when
+		entriesAfter := tests.ReadAll(t, l)
+		// then
+		assert.Equal(t, entriesBefore, entriesAfter)
+		// and when
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		err = l.MergeSegments(segments[0].StartingAt, segments[1].StartingAt)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, entriesBefore, tests.ReadAll(t, l))
+	})
+}
+
+// simulateInterruptedMerge appends second segment to the first one without removing the second one.
+func simulateInterruptedMerge(t *testing.T, dir string) {
+	t.Helper()
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	var segmentFiles []string
+
+	for _, f := range files {
+		if path.Ext(f.Name()) == ".segment" {
+			segmentFiles = append(segmentFiles, path.Join(dir, f.Name()))
+		}
+	}
+
+	second, err := os.ReadFile(segmentFiles[1])
+	require.NoError(t, err)
+
+	first, err := os.OpenFile(segmentFiles[0], os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+
+	_, err = first.Write(second)
+	require.NoError(t, err)
+	require.NoError(t, first.Close())
+}
+
+func TestLog_FilterSegmentStartingAt(t *testing.T) {
+	t.Run("should return error for nil keep function", func(t *testing.T) {
+		l := log.New(tests.TempDir(t))
+		_, _, err := l.FilterSegmentStartingAt(time2005, nil)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should not be possible to rewrite last segment", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		require.NoError(t, writer.WriteWithTime(time2005, data1))
+		// when
+		_, _, err := l.FilterSegmentStartingAt(time2005, keepNothing)
+		// then
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should keep only selected entries", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentDuration(time.Minute))
+		t1 := time2005
+		t2 := t1.Add(time.Second)
+		t3 := t1.Add(time.Hour)
+		t4 := t3.Add(time.Hour)
+		require.NoError(t, writer.WriteWithTime(t1, data1))
+		require.NoError(t, writer.WriteWithTime(t2, data2))
+		require.NoError(t, writer.WriteWithTime(t3, data1))
+		require.NoError(t, writer.WriteWithTime(t4, data1))
+		// when
+		kept, removed, err := l.FilterSegmentStartingAt(t1, func(t time.Time, data []byte) bool {
+			return t.Equal(t2)
+		})
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, kept)
+		assert.Equal(t, 2, removed)
+		entries := tests.ReadAll(t, l)
+		assert.Equal(t,
+			[]tests.Entry{
+				{Time: t2, Data: data2},
+				{Time: t4, Data: data1},
+			},
+			entries)
+	})
+
+	t.Run("should return ErrSegmentCompacted when read segment was rewritten", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("file opened by reader cannot be replaced on Windows")
+		}
+
+		l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentDuration(time.Minute))
+		t1 := time2005
+		t2 := t1.Add(time.Hour)
+		t3 := t2.Add(time.Hour)
+		t4 := t3.Add(time.Hour)
+		for _, entryTime := range []time.Time{t1, t2, t3, t4} {
+			require.NoError(t, writer.WriteWithTime(entryTime, data1))
+		}
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		require.Len(t, segments, 4)
+		reader := tests.OpenReader(t, l)
+		for i := 0; i < 2; i++ {
+			_, _, err = reader.Read()
+			require.NoError(t, err)
+		}
+		_, _, err = l.FilterSegmentStartingAt(segments[0].StartingAt, func(t time.Time, data []byte) bool {
+			return t.Equal(t1)
+		})
+		require.NoError(t, err)
+		require.NoError(t, l.RemoveSegmentStartingAt(segments[1].StartingAt))
+		// when
+		_, _, err = reader.Read()
+		// then
+		require.ErrorIs(t, err, log.ErrSegmentCompacted)
+		// and
+		entryTime, _, err := reader.Read()
+		require.NoError(t, err)
+		assert.Equal(t, t4, entryTime)
+	})
+}
+
+func keepNothing(time.Time, []byte) bool {
+	return false
+}
+
+func TestLog_TruncateAfter(t *testing.T) {
+	t.Run("should return error when log is locked for writing", func(t *testing.T) {
+		l, _ := tests.OpenLogWithWriter(t)
+		// when
+		err := l.TruncateAfter(time2005)
+		// then
+		assert.ErrorIs(t, err, log.ErrLocked)
+	})
+
+	t.Run("should remove entries written after given time", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		require.NoError(t, writer.WriteWithTime(time2005, data1))
+		require.NoError(t, writer.WriteWithTime(time2006, data2))
+		require.NoError(t, writer.Close())
+		// when
+		err := l.TruncateAfter(time2005)
+		// then
+		require.NoError(t, err)
+		entries := tests.ReadAll(t, l)
+		assert.Equal(t, []tests.Entry{{Time: time2005, Data: data1}}, entries)
+	})
 }
 
 func fixedNow(t time.Time) func() time.Time {
@@ -0,0 +1,261 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package log
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/elgopher/logstore/internal/fsutil"
+	"github.com/gofrs/flock"
+)
+
+// mirror is a secondary log directory containing an exact copy of segment files.
+type mirror struct {
+	dir            string
+	lock           *flock.Flock
+	currentSegment *segmentWriter
+	// failed mirror is no longer written. It will be resynchronized once the Writer is opened again.
+	failed bool
+}
+
+func openMirrors(primaryDir string, dirs []string) ([]*mirror, error) {
+	var mirrors []*mirror
+
+	for _, dir := range dirs {
+		m, err := openMirror(primaryDir, dir)
+		if err != nil {
+			closeMirrors(mirrors)
+
+			return nil, err
+		}
+
+		mirrors = append(mirrors, m)
+	}
+
+	return mirrors, nil
+}
+
+func openMirror(primaryDir, dir string) (*mirror, error) {
+	if err := mkdirIfMissing(dir); err != nil {
+		return nil, err
+	}
+
+	lock, err := tryLock(dir)
+	if err != nil {
+		return nil, fmt.Errorf("locking mirror %s failed: %w", dir, err)
+	}
+
+	if err = resyncMirror(primaryDir, dir); err != nil {
+		_ = lock.Unlock()
+
+		return nil, fmt.Errorf("resyncing mirror %s failed: %w", dir, err)
+	}
+
+	currentSegment, err := New(dir).openLastUsedSegmentWriter()
+	if err != nil {
+		_ = lock.Unlock()
+
+		return nil, err
+	}
+
+	return &mirror{
+		dir:            dir,
+		lock:           lock,
+		currentSegment: currentSegment,
+	}, nil
+}
+
+// resyncMirror makes mirror segments the same as primary ones. Segments with different sizes are copied
+// (together with their stream indexes) from the primary directory, segments missing in the primary directory
+// are removed. Empty primary directory is restored from the mirror instead. ErrMirrorDiverged is returned when
+// the mirror has segments newer than the last primary segment.
+func resyncMirror(primaryDir, mirrorDir string) error {
+	primarySegments, err := New(primaryDir).Segments()
+	if err != nil {
+		return fmt.Errorf("listing primary segments failed: %w", err)
+	}
+
+	mirrorSegments, err := New(mirrorDir).Segments()
+	if err != nil {
+		return fmt.Errorf("listing mirror segments failed: %w", err)
+	}
+
+	if len(mirrorSegments) > 0 {
+		// mirror might be the only copy of the log, so it must not be overwritten by the (possibly lost) primary
+		if len(primarySegments) == 0 {
+			return copySegments(mirrorDir, primaryDir, mirrorSegments)
+		}
+
+		lastMirrorSegment := mirrorSegments[len(mirrorSegments)-1]
+		if lastMirrorSegment.StartingAt.After(primarySegments[len(primarySegments)-1].StartingAt) {
+			return fmt.Errorf("mirror segment starting at %s is newer than the last segment: %w",
+				lastMirrorSegment.StartingAt, ErrMirrorDiverged)
+		}
+	}
+
+	primarySizes := map[time.Time]int64{}
+	for _, segment := range primarySegments {
+		primarySizes[segment.StartingAt] = segment.SizeBytes
+	}
+
+	mirrorSizes := map[time.Time]int64{}
+
+	for _, segment := range mirrorSegments {
+		if _, ok := primarySizes[segment.StartingAt]; !ok {
+			filename := path.Join(mirrorDir, segmentFilenameStartingAt(segment.StartingAt))
+			if err = os.Remove(filename); err != nil {
+				return fmt.Errorf("removing file %s failed: %w", filename, err)
+			}
+
+			if err = removeStreamIndex(mirrorDir, segment.StartingAt); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		mirrorSizes[segment.StartingAt] = segment.SizeBytes
+	}
+
+	for _, segment := range primarySegments {
+		mirrorSize, ok := mirrorSizes[segment.StartingAt]
+		if ok && mirrorSize == segment.SizeBytes {
+			continue
+		}
+
+		name := segmentFilenameStartingAt(segment.StartingAt)
+		if err = copySegmentFile(path.Join(primaryDir, name), path.Join(mirrorDir, name)); err != nil {
+			return err
+		}
+
+		if err = copyStreamIndex(primaryDir, mirrorDir, segment.StartingAt); err != nil {
+			return err
+		}
+	}
+
+	fsutil.SyncDir(mirrorDir)
+
+	return nil
+}
+
+// copySegments copies segments together with their stream indexes. It is used to restore the lost log directory.
+func copySegments(srcDir, dstDir string, segments []Segment) error {
+	for _, segment := range segments {
+		name := segmentFilenameStartingAt(segment.StartingAt)
+		if err := copySegmentFile(path.Join(srcDir, name), path.Join(dstDir, name)); err != nil {
+			return err
+		}
+
+		if err := copyStreamIndex(srcDir, dstDir, segment.StartingAt); err != nil {
+			return err
+		}
+	}
+
+	fsutil.SyncDir(dstDir)
+
+	return nil
+}
+
+func (m *mirror) write(e logEntry) error {
+	if m.currentSegment == nil {
+		var err error
+
+		m.currentSegment, err = openSegmentWriter(m.dir, e.time)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := m.currentSegment.writeEntry(e); err != nil {
+		return err
+	}
+
+	if err := m.currentSegment.file.Sync(); err != nil {
+		return fmt.Errorf("syncing mirror segment failed: %w", err)
+	}
+
+	return nil
+}
+
+func (m *mirror) rollOver(start time.Time) error {
+	m.currentSegment.sealStreamIndex()
+
+	if err := m.currentSegment.close(); err != nil {
+		return fmt.Errorf("error closing mirror segment file: %w", err)
+	}
+
+	m.currentSegment = nil
+
+	segmentFile, err := openFileForAppending(path.Join(m.dir, segmentFilenameStartingAt(start)))
+	if err != nil {
+		return err
+	}
+
+	m.currentSegment = &segmentWriter{
+		file:      segmentFile,
+		startTime: start,
+	}
+
+	return nil
+}
+
+// removeSegmentsBefore removes mirror segments starting before t. It is used to remove segments compacted
+// in the log directory.
+func (m *mirror) removeSegmentsBefore(t time.Time) error {
+	l := New(m.dir)
+
+	segments, err := l.Segments()
+	if err != nil {
+		return fmt.Errorf("listing mirror segments failed: %w", err)
+	}
+
+	for _, segment := range segments {
+		if !segment.StartingAt.Before(t) {
+			break
+		}
+
+		if err = l.RemoveSegmentStartingAt(segment.StartingAt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *mirror) truncateAfter(t time.Time) error {
+	if err := m.currentSegment.close(); err != nil {
+		return fmt.Errorf("closing mirror segment failed: %w", err)
+	}
+
+	m.currentSegment = nil
+
+	if err := truncateSegmentsAfter(m.dir, t); err != nil {
+		return err
+	}
+
+	var err error
+
+	m.currentSegment, err = New(m.dir).openLastUsedSegmentWriter()
+
+	return err
+}
+
+func (m *mirror) close() error {
+	segmentErr := m.currentSegment.close()
+
+	if err := m.lock.Unlock(); err != nil {
+		return fmt.Errorf("error unlocking the mirror lock: %w", err)
+	}
+
+	return segmentErr
+}
+
+func closeMirrors(mirrors []*mirror) {
+	for _, m := range mirrors {
+		_ = m.close()
+	}
+}
@@ -0,0 +1,79 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package log
+
+import (
+	"fmt"
+	"time"
+)
+
+// WriterObserver receives events from the Writer. It can be used to collect metrics. Methods are called
+// synchronously, so they should return quickly.
+type WriterObserver interface {
+	// EntryWritten is called after entry was written. Latency includes writing to mirrors.
+	EntryWritten(dataBytes int, latency time.Duration)
+	// Synced is called after segment file was synced to disk.
+	Synced(latency time.Duration)
+	// RolledOver is called after the Writer started a new segment.
+	RolledOver()
+	// SegmentsChanged is called when the Writer is opened and after each roll over.
+	SegmentsChanged(count int, totalBytes int64)
+}
+
+// ReaderObserver receives events from the Reader. It can be used to collect metrics. Methods are called
+// synchronously, so they should return quickly.
+type ReaderObserver interface {
+	EntryRead(dataBytes int)
+	// Seeked is called after the Reader opened with StartingFrom found the first entry.
+	Seeked(latency time.Duration)
+}
+
+// ObserveWriter registers an observer receiving Writer events.
+func ObserveWriter(observer WriterObserver) OpenWriterOption {
+	return func(s *WriterSettings) error {
+		if observer == nil {
+			return fmt.Errorf("nil observer: %w", ErrInvalidParameter)
+		}
+
+		s.observer = observer
+
+		return nil
+	}
+}
+
+// ObserveReader registers an observer receiving Reader events.
+func ObserveReader(observer ReaderObserver) OpenReaderOption {
+	return func(s *ReaderSettings) error {
+		if observer == nil {
+			return fmt.Errorf("nil observer: %w", ErrInvalidParameter)
+		}
+
+		s.observer = observer
+
+		return nil
+	}
+}
+
+type nopObserver struct{}
+
+func (nopObserver) EntryWritten(int, time.Duration) {}
+func (nopObserver) Synced(time.Duration)            {}
+func (nopObserver) RolledOver()                     {}
+func (nopObserver) SegmentsChanged(int, int64)      {}
+func (nopObserver) EntryRead(int)                   {}
+func (nopObserver) Seeked(time.Duration)            {}
+
+func (l *Log) reportSegments(observer WriterObserver) {
+	segments, err := l.Segments()
+	if err != nil {
+		return
+	}
+
+	var totalBytes int64
+	for _, segment := range segments {
+		totalBytes += segment.SizeBytes
+	}
+
+	observer.SegmentsChanged(len(segments), totalBytes)
+}
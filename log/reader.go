@@ -7,14 +7,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path"
 	"time"
 )
 
-func (l *Log) openReader(options []OpenReaderOption) (Reader, error) {
+func (l *Log) openReader(options []OpenReaderOption) (StreamEntryReader, error) {
 	settings := &ReaderSettings{
 		openOldestSegment: openOldestSegmentAtTheBegging,
+		observer:          nopObserver{},
 	}
 
 	for _, applyOption := range options {
@@ -27,26 +29,52 @@ func (l *Log) openReader(options []OpenReaderOption) (Reader, error) {
 		}
 	}
 
-	segments, err := l.Segments()
-	if err != nil {
-		return nil, err
+	if settings.stream != "" {
+		return l.openStreamReader(settings)
 	}
 
-	if len(segments) == 0 {
-		return &emptyLogReader{}, nil
-	}
+	for {
+		segments, err := l.Segments()
+		if err != nil {
+			return nil, err
+		}
 
-	segmentFile, segmentIndex, err := settings.openOldestSegment(l.dir, segments)
-	if err != nil {
-		return nil, err
-	}
+		if len(segments) == 0 {
+			return &emptyLogReader{}, nil
+		}
+
+		seekStarted := time.Now()
+
+		segmentFile, segmentIndex, err := settings.openOldestSegment(l.dir, segments)
+		if errors.Is(err, os.ErrNotExist) {
+			// segment was removed after listing, so segments must be listed again
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if settings.seeking {
+			settings.observer.Seeked(time.Since(seekStarted))
+		}
+
+		offset, err := segmentFile.Seek(0, io.SeekCurrent)
+		if err != nil {
+			_ = segmentFile.Close()
+
+			return nil, fmt.Errorf("getting file position failed: %w", err)
+		}
 
-	return &segmentsReader{
-		segmentFile:    segmentFile,
-		segments:       segments,
-		currentSegment: segmentIndex,
-		dir:            l.dir,
-	}, nil
+		return &segmentsReader{
+			segmentFile:    segmentFile,
+			offset:         offset,
+			segments:       segments,
+			currentSegment: segmentIndex,
+			dir:            l.dir,
+			observer:       settings.observer,
+		}, nil
+	}
 }
 
 func openOldestSegmentAtTheBegging(dir string, segments []Segment) (*os.File, int, error) {
@@ -97,6 +125,10 @@ func (r *emptyLogReader) Read() (time.Time, []byte, error) {
 	return time.Time{}, nil, ErrEOL
 }
 
+func (r *emptyLogReader) ReadStreamEntry() (time.Time, string, uint64, []byte, error) {
+	return time.Time{}, "", 0, nil, ErrEOL
+}
+
 func (r *emptyLogReader) Close() error {
 	return nil
 }
@@ -112,30 +144,259 @@ func openSegmentFileForRead(dir string, segment Segment) (*os.File, error) {
 
 type segmentsReader struct {
 	segmentFile    *os.File
+	offset         int64
 	segments       []Segment
 	currentSegment int
 	dir            string
+	lastTime       time.Time
+	observer       ReaderObserver
 }
 
 func (r *segmentsReader) Read() (time.Time, []byte, error) {
-	t, data, err := decodeEntry(r.segmentFile)
-	if errors.Is(err, io.EOF) {
-		r.currentSegment++
-		if r.currentSegment >= len(r.segments) {
-			return time.Time{}, nil, ErrEOL
+	e, err := r.read()
+
+	return e.time, e.data, err
+}
+
+func (r *segmentsReader) ReadStreamEntry() (time.Time, string, uint64, []byte, error) {
+	e, err := r.read()
+
+	return e.time, e.stream, e.version, e.data, err
+}
+
+func (r *segmentsReader) read() (logEntry, error) {
+	for {
+		e, err := decodeLogEntry(r.segmentFile)
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			// entry is not fully written yet (or segment has a torn tail)
+			if _, err = r.segmentFile.Seek(r.offset, io.SeekStart); err != nil {
+				return logEntry{}, fmt.Errorf("seeking to entry starting position failed: %w", err)
+			}
+
+			return r.readNextSegment()
 		}
 
-		_ = r.segmentFile.Close()
+		if errors.Is(err, io.EOF) {
+			return r.readNextSegment()
+		}
 
-		r.segmentFile, err = openSegmentFileForRead(r.dir, r.segments[r.currentSegment])
 		if err != nil {
-			return time.Time{}, nil, err
+			return logEntry{}, err
 		}
 
-		return r.Read()
+		r.offset += e.size()
+
+		if !e.time.After(r.lastTime) {
+			// entry was already returned. Segments might contain duplicates when merging was interrupted.
+			continue
+		}
+
+		r.lastTime = e.time
+		r.observer.EntryRead(len(e.data))
+
+		return e, nil
+	}
+}
+
+func (r *segmentsReader) readNextSegment() (logEntry, error) {
+	next := r.currentSegment + 1
+	if next >= len(r.segments) {
+		return logEntry{}, ErrEOL
+	}
+
+	segment := r.segments[next]
+
+	f, err := openSegmentFileForRead(r.dir, segment)
+	if errors.Is(err, os.ErrNotExist) {
+		return r.readMissingSegment(next)
+	}
+
+	if err != nil {
+		return logEntry{}, err
+	}
+
+	_ = r.segmentFile.Close()
+
+	r.segmentFile = f
+	r.offset = 0
+	r.currentSegment = next
+
+	return r.read()
+}
+
+func (r *segmentsReader) refreshSegments() (bool, error) {
+	segments, index, err := relistSegments(r.dir, r.segments[r.currentSegment])
+	if err != nil || index == -1 {
+		return false, err
+	}
+
+	r.segments = segments
+	r.currentSegment = index
+
+	return true, nil
+}
+
+// relistSegments lists segments again and returns the index of the current segment in the new list, or -1 when
+// the current segment was removed.
+func relistSegments(dir string, current Segment) ([]Segment, int, error) {
+	segments, err := New(dir).Segments()
+	if err != nil {
+		return nil, -1, err
+	}
+
+	for i, segment := range segments {
+		if segment.StartingAt.Equal(current.StartingAt) {
+			return segments, i, nil
+		}
+	}
+
+	return segments, -1, nil
+}
+
+// readMissingSegment is called when the next segment was not found, because it was removed or merged.
+func (r *segmentsReader) readMissingSegment(next int) (logEntry, error) {
+	missing := r.segments[next]
+
+	segments, index, continuation, err := locateMissingSegment(r.dir, r.segments[r.currentSegment], r.segmentFile, missing)
+	if err != nil {
+		return logEntry{}, err
 	}
 
-	return t, data, nil
+	if index == -1 {
+		// current (fully read) segment file is kept open, so next Read will skip to the following segment
+		r.currentSegment = next
+
+		return logEntry{}, fmt.Errorf("segment starting at %s not found: %w", missing.StartingAt, ErrSegmentCompacted)
+	}
+
+	if err = r.reopenSegment(segments, index); err != nil {
+		return logEntry{}, err
+	}
+
+	if !continuation {
+		return logEntry{}, fmt.Errorf("segment starting at %s was rewritten: %w",
+			segments[index].StartingAt, ErrSegmentCompacted)
+	}
+
+	return r.read()
+}
+
+// locateMissingSegment is called by readers when the next segment was not found. It returns the index of segment
+// containing entries following the current segment, or -1 when the next segment was removed. Continuation is false
+// when the segment was rewritten and some of its entries might have been removed.
+//
+// Segments are merged into the first segment of the group, so the merged segment starts with the same entry
+// and is not smaller than the original one.
+func locateMissingSegment(dir string, current Segment, openFile *os.File,
+	missing Segment) (segments []Segment, index int, continuation bool, err error) {
+	segments, err = New(dir).Segments()
+	if err != nil {
+		return nil, -1, false, err
+	}
+
+	index = -1
+
+	for i, segment := range segments {
+		if segment.StartingAt.After(missing.StartingAt) {
+			break
+		}
+
+		index = i
+	}
+
+	if index == -1 {
+		return segments, -1, false, nil
+	}
+
+	if !segments[index].StartingAt.Equal(current.StartingAt) {
+		// current segment was merged into an earlier segment
+		return segments, index, true, nil
+	}
+
+	fileInfo, err := os.Stat(path.Join(dir, segmentFilenameStartingAt(current.StartingAt)))
+	if errors.Is(err, os.ErrNotExist) {
+		return segments, -1, false, nil
+	}
+
+	if err != nil {
+		return nil, -1, false, fmt.Errorf("getting segment file info failed: %w", err)
+	}
+
+	openFileInfo, err := openFile.Stat()
+	if err != nil {
+		return nil, -1, false, fmt.Errorf("getting segment file info failed: %w", err)
+	}
+
+	if os.SameFile(fileInfo, openFileInfo) {
+		// current segment is not replaced, so the next one was removed
+		return segments, -1, false, nil
+	}
+
+	if fileInfo.Size() < openFileInfo.Size() {
+		return segments, index, false, nil
+	}
+
+	continuation, err = sameFirstEntryTime(path.Join(dir, segmentFilenameStartingAt(current.StartingAt)), openFile)
+
+	return segments, index, continuation, err
+}
+
+func sameFirstEntryTime(filename string, openFile *os.File) (bool, error) {
+	f, err := os.Open(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("opening segment file failed: %w", err)
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	// segment without entries is never a continuation
+	t, _, err := decodeEntry(f)
+	if err != nil {
+		return false, nil
+	}
+
+	openFileTime, _, err := decodeEntry(io.NewSectionReader(openFile, 0, math.MaxInt64))
+	if err != nil {
+		return false, nil
+	}
+
+	return t.Equal(openFileTime), nil
+}
+
+// reopenSegment opens the segment and skips entries which were already returned.
+func (r *segmentsReader) reopenSegment(segments []Segment, index int) error {
+	f, err := openSegmentFileForRead(r.dir, segments[index])
+	if err != nil {
+		return err
+	}
+
+	pos, err := findClosestEntryPosition(r.lastTime.Add(time.Nanosecond), f)
+	if err != nil {
+		_ = f.Close()
+
+		return err
+	}
+
+	if _, err = f.Seek(pos, io.SeekStart); err != nil {
+		_ = f.Close()
+
+		return fmt.Errorf("seeking to entry starting position failed: %w", err)
+	}
+
+	_ = r.segmentFile.Close()
+
+	r.segmentFile = f
+	r.offset = pos
+	r.segments = segments
+	r.currentSegment = index
+
+	return nil
 }
 
 func (r *segmentsReader) Close() error {
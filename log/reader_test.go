@@ -111,4 +111,49 @@ func TestReader_Read(t *testing.T) {
 			assert.Equal(t, data2, actual[0].Data)
 		})
 	})
+
+	t.Run("should return ErrSegmentCompacted when next segment was removed during reading", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentSizeMB(1))
+		t1 := tests.WriteEntry(t, writer, tests.OneMegabyte)
+		tests.WriteEntry(t, writer, tests.OneMegabyte)
+		reader := tests.OpenReader(t, l)
+		firstTime, _, err := reader.Read()
+		require.NoError(t, err)
+		require.True(t, t1.Equal(firstTime))
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		require.NoError(t, l.RemoveSegmentStartingAt(segments[1].StartingAt))
+		// when
+		_, data, err := reader.Read()
+		// then
+		assert.ErrorIs(t, err, log.ErrSegmentCompacted)
+		assert.Nil(t, data)
+	})
+
+	t.Run("should continue reading following segment after ErrSegmentCompacted", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentSizeMB(1))
+		tests.WriteEntry(t, writer, tests.OneMegabyte)
+		tests.WriteEntry(t, writer, tests.OneMegabyte)
+		t3 := tests.WriteEntry(t, writer, tests.OneMegabyte)
+		reader := tests.OpenReader(t, l)
+		_, _, err := reader.Read()
+		require.NoError(t, err)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		require.NoError(t, l.RemoveSegmentStartingAt(segments[1].StartingAt))
+		_, _, err = reader.Read()
+		require.ErrorIs(t, err, log.ErrSegmentCompacted)
+		// when
+		actualTime, _, err := reader.Read()
+		// then
+		require.NoError(t, err)
+		assert.True(t, t3.Equal(actualTime))
+	})
+}
+
+func TestObserveReader(t *testing.T) {
+	t.Run("should return error for nil observer", func(t *testing.T) {
+		_, err := log.New(tests.TempDir(t)).OpenReader(log.ObserveReader(nil))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
 }
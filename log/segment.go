@@ -4,11 +4,16 @@
 package log
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"strings"
 	"time"
+
+	"github.com/elgopher/logstore/internal/fsutil"
 )
 
 const (
@@ -37,6 +42,11 @@ type segmentWriter struct {
 	file      *os.File
 	sizeBytes int64
 	startTime time.Time
+	// streamIndex is opened when the first stream entry is written
+	streamIndex *os.File
+	// streamIndexBroken is set when writing the stream index failed. Such index is removed and not written anymore,
+	// so readers scan the segment instead.
+	streamIndexBroken bool
 }
 
 func (l *Log) openLastUsedSegmentWriter() (*segmentWriter, error) {
@@ -51,6 +61,18 @@ func (l *Log) openLastUsedSegmentWriter() (*segmentWriter, error) {
 
 	lastSegment := segments[len(segments)-1]
 
+	if err = repairMissingStreamIndexes(l.dir, segments[:len(segments)-1]); err != nil {
+		return nil, err
+	}
+
+	if err = truncateTornTail(l.dir, lastSegment); err != nil {
+		return nil, err
+	}
+
+	if err = repairStreamIndex(l.dir, lastSegment.StartingAt); err != nil {
+		return nil, err
+	}
+
 	return openSegmentWriter(l.dir, lastSegment.StartingAt)
 }
 
@@ -89,6 +111,58 @@ func (l *segmentWriter) Write(b []byte) (int, error) {
 	return n, nil
 }
 
+// writeEntry writes the entry and adds stream entries to the stream index. Failure to write the index is not
+// reported, because the entry is already in the segment and readers can still find it by scanning the segment.
+func (l *segmentWriter) writeEntry(e logEntry) error {
+	offset := l.sizeBytes
+
+	if err := encodeLogEntry(l, e); err != nil {
+		return err
+	}
+
+	if e.stream == "" || l.streamIndexBroken {
+		return nil
+	}
+
+	if err := l.writeStreamIndex(streamIndexRecord{stream: e.stream, offset: offset, version: e.version}); err != nil {
+		l.streamIndexBroken = true
+		_ = l.streamIndex.Close()
+		_ = removeStreamIndex(path.Dir(l.file.Name()), l.startTime)
+	}
+
+	return nil
+}
+
+func (l *segmentWriter) writeStreamIndex(record streamIndexRecord) error {
+	if l.streamIndex == nil {
+		f, err := os.OpenFile(streamIndexFilename(l.file.Name()), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0664)
+		if err != nil {
+			return fmt.Errorf("error opening stream index file for write: %w", err)
+		}
+
+		l.streamIndex = f
+	}
+
+	if _, err := l.streamIndex.Write(appendStreamIndexRecord(nil, record)); err != nil {
+		return fmt.Errorf("writing to stream index failed: %w", err)
+	}
+
+	return nil
+}
+
+// sealStreamIndex creates empty stream index when no stream entries were written to the segment, so every sealed
+// segment has an index. Segment without index is scanned by readers, until the Writer is opened again.
+func (l *segmentWriter) sealStreamIndex() {
+	if l == nil || l.streamIndex != nil || l.streamIndexBroken {
+		return
+	}
+
+	f, err := os.OpenFile(streamIndexFilename(l.file.Name()), os.O_WRONLY|os.O_CREATE, 0664)
+	if err == nil {
+		_ = f.Close()
+	}
+}
+
 func (l *segmentWriter) maxSizeExceeded(maxSize int64) bool {
 	return l.sizeBytes > maxSize
 }
@@ -102,9 +176,392 @@ func (l *segmentWriter) close() error {
 		return nil
 	}
 
+	if l.streamIndex != nil && !l.streamIndexBroken {
+		if err := l.streamIndex.Close(); err != nil {
+			_ = l.file.Close()
+
+			return fmt.Errorf("closing stream index file failed: %w", err)
+		}
+	}
+
 	if err := l.file.Close(); err != nil {
 		return fmt.Errorf("closing segment file failed: %w", err)
 	}
 
 	return nil
 }
+
+// truncateSegmentsAfter removes segments starting from the newest one. This way the log is always valid,
+// even when the process crashes in the middle of the operation.
+func truncateSegmentsAfter(dir string, t time.Time) error {
+	segments, err := New(dir).Segments()
+	if err != nil {
+		return fmt.Errorf("listing segments failed: %w", err)
+	}
+
+	for i := len(segments) - 1; i >= 0; i-- {
+		segment := segments[i]
+		filename := path.Join(dir, segmentFilenameStartingAt(segment.StartingAt))
+
+		var size int64
+
+		if !segment.StartingAt.After(t) {
+			size, err = truncateSegmentFileAfter(filename, t)
+			if err != nil {
+				return err
+			}
+		}
+
+		if size > 0 {
+			break
+		}
+
+		if err = removeStreamIndex(dir, segment.StartingAt); err != nil {
+			return err
+		}
+
+		if err = os.Remove(filename); err != nil {
+			return fmt.Errorf("removing file %s failed: %w", filename, err)
+		}
+	}
+
+	fsutil.SyncDir(dir)
+
+	return nil
+}
+
+func truncateSegmentFileAfter(filename string, t time.Time) (int64, error) {
+	f, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		return 0, fmt.Errorf("error opening segment file %s for truncation: %w", filename, err)
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	pos, err := findClosestEntryPosition(t.Add(time.Nanosecond), f)
+	if err != nil {
+		return 0, err
+	}
+
+	if pos == 0 {
+		return 0, nil
+	}
+
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, fmt.Errorf("getting file size failed: %w", err)
+	}
+
+	if pos == end {
+		return pos, nil
+	}
+
+	if err = truncateAndSync(f, pos); err != nil {
+		return 0, err
+	}
+
+	return pos, nil
+}
+
+// truncateFile truncates the file to size bytes. Truncation is durable once the function returns.
+// truncateTornTail removes the entry written partially before the crash, so new entries are not appended after bytes
+// which cannot be decoded. ErrSegmentCorrupt is returned for other problems, because truncating the segment would
+// remove valid entries.
+func truncateTornTail(dir string, segment Segment) error {
+	file, err := openSegmentFileForRead(dir, segment)
+	if err != nil {
+		return err
+	}
+
+	problem, err := scanSegment(file, segment, func(int64, logEntry) {})
+	_ = file.Close()
+
+	if err != nil || problem == nil {
+		return err
+	}
+
+	if problem.Kind != ProblemTornTail {
+		return fmt.Errorf("%s: %w", problem, ErrSegmentCorrupt)
+	}
+
+	return truncateFile(path.Join(dir, segmentFilenameStartingAt(segment.StartingAt)), problem.Offset)
+}
+
+func truncateFile(filename string, size int64) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("opening file %s failed: %w", filename, err)
+	}
+
+	if err = truncateAndSync(f, size); err != nil {
+		_ = f.Close()
+
+		return err
+	}
+
+	return f.Close()
+}
+
+func truncateAndSync(f *os.File, size int64) error {
+	if err := f.Truncate(size); err != nil {
+		return fmt.Errorf("truncating file %s failed: %w", f.Name(), err)
+	}
+
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("syncing file %s failed: %w", f.Name(), err)
+	}
+
+	return nil
+}
+
+const tmpFilenameExtension = ".tmp"
+
+func filterSegment(dir string, t time.Time, keep func(t time.Time, data []byte) bool) (kept, removed int, err error) {
+	filename := path.Join(dir, segmentFilenameStartingAt(t))
+
+	src, err := os.Open(filename)
+	if err != nil {
+		return 0, 0, fmt.Errorf("opening segment file failed: %w", err)
+	}
+
+	defer func() {
+		_ = src.Close()
+	}()
+
+	tmpFilename := filename + tmpFilenameExtension
+
+	dst, err := os.OpenFile(tmpFilename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error opening temporary segment file %s for write: %w", tmpFilename, err)
+	}
+
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(tmpFilename)
+	}()
+
+	reader := bufio.NewReader(src)
+	writer := bufio.NewWriter(dst)
+	indexingWriter := &indexingWriter{writer: writer}
+
+	for {
+		e, err := decodeLogEntry(reader)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if !keep(e.time, e.data) {
+			removed++
+
+			continue
+		}
+
+		if err = indexingWriter.write(e); err != nil {
+			return 0, 0, err
+		}
+
+		kept++
+	}
+
+	if removed == 0 {
+		return kept, 0, nil
+	}
+
+	if err = writer.Flush(); err != nil {
+		return 0, 0, fmt.Errorf("writing temporary segment file failed: %w", err)
+	}
+
+	// stale index must not be used with the rewritten segment
+	if err = removeStreamIndex(dir, t); err != nil {
+		return 0, 0, err
+	}
+
+	if err = replaceFile(dst, filename); err != nil {
+		return 0, 0, err
+	}
+
+	if err = writeStreamIndex(dir, t, indexingWriter.records); err != nil {
+		return 0, 0, err
+	}
+
+	fsutil.SyncDir(dir)
+
+	return kept, removed, nil
+}
+
+// replaceFile syncs and closes the temporary file and then atomically renames it to filename.
+func replaceFile(tmp *os.File, filename string) error {
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("syncing file %s failed: %w", tmp.Name(), err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing file %s failed: %w", tmp.Name(), err)
+	}
+
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return fmt.Errorf("renaming file %s to %s failed: %w", tmp.Name(), filename, err)
+	}
+
+	return nil
+}
+
+func moveSegment(srcDir, dstDir string, t time.Time) error {
+	name := segmentFilenameStartingAt(t)
+	src := path.Join(srcDir, name)
+	dst := path.Join(dstDir, name)
+
+	if err := os.Rename(src, dst); err != nil {
+		if err = copySegmentFile(src, dst); err != nil {
+			return err
+		}
+
+		fsutil.SyncDir(dstDir)
+
+		if err = os.Remove(src); err != nil {
+			return fmt.Errorf("removing file %s failed %w", src, err)
+		}
+	}
+
+	if err := moveStreamIndex(srcDir, dstDir, t); err != nil {
+		return err
+	}
+
+	fsutil.SyncDir(dstDir)
+	fsutil.SyncDir(srcDir)
+
+	return nil
+}
+
+func copySegmentFile(src, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("opening segment file failed: %w", err)
+	}
+
+	defer func() {
+		_ = srcFile.Close()
+	}()
+
+	tmpFilename := dst + tmpFilenameExtension
+
+	tmp, err := os.OpenFile(tmpFilename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
+	if err != nil {
+		return fmt.Errorf("error opening temporary segment file %s for write: %w", tmpFilename, err)
+	}
+
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmpFilename)
+	}()
+
+	if _, err = io.Copy(tmp, srcFile); err != nil {
+		return fmt.Errorf("copying segment file %s failed: %w", src, err)
+	}
+
+	return replaceFile(tmp, dst)
+}
+
+func mergeSegments(dir string, segments []Segment) error {
+	filename := path.Join(dir, segmentFilenameStartingAt(segments[0].StartingAt))
+	tmpFilename := filename + tmpFilenameExtension
+
+	tmp, err := os.OpenFile(tmpFilename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
+	if err != nil {
+		return fmt.Errorf("error opening temporary segment file %s for write: %w", tmpFilename, err)
+	}
+
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmpFilename)
+	}()
+
+	writer := bufio.NewWriter(tmp)
+	indexingWriter := &indexingWriter{writer: writer}
+	lastTime := time.Time{}
+
+	for _, segment := range segments {
+		filename := path.Join(dir, segmentFilenameStartingAt(segment.StartingAt))
+
+		lastTime, err = copyEntriesAfter(lastTime, filename, indexingWriter)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = writer.Flush(); err != nil {
+		return fmt.Errorf("writing temporary segment file failed: %w", err)
+	}
+
+	// stale index must not be used with the merged segment
+	if err = removeStreamIndex(dir, segments[0].StartingAt); err != nil {
+		return err
+	}
+
+	if err = replaceFile(tmp, filename); err != nil {
+		return err
+	}
+
+	if err = writeStreamIndex(dir, segments[0].StartingAt, indexingWriter.records); err != nil {
+		return err
+	}
+
+	fsutil.SyncDir(dir)
+
+	for _, segment := range segments[1:] {
+		if err = removeStreamIndex(dir, segment.StartingAt); err != nil {
+			return err
+		}
+
+		segmentFile := path.Join(dir, segmentFilenameStartingAt(segment.StartingAt))
+		if err = os.Remove(segmentFile); err != nil {
+			return fmt.Errorf("removing file %s failed: %w", segmentFile, err)
+		}
+	}
+
+	fsutil.SyncDir(dir)
+
+	return nil
+}
+
+// copyEntriesAfter copies entries newer than t. Older entries are duplicates left by interrupted merge.
+func copyEntriesAfter(t time.Time, filename string, writer *indexingWriter) (lastTime time.Time, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return t, fmt.Errorf("opening segment file failed: %w", err)
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	reader := bufio.NewReader(f)
+	lastTime = t
+
+	for {
+		e, err := decodeLogEntry(reader)
+		if errors.Is(err, io.EOF) {
+			return lastTime, nil
+		}
+
+		if err != nil {
+			return t, err
+		}
+
+		if !e.time.After(lastTime) {
+			continue
+		}
+
+		if err = writer.write(e); err != nil {
+			return t, err
+		}
+
+		lastTime = e.time
+	}
+}
@@ -0,0 +1,685 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package log
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Each segment has a stream index file next to it. The index is an append-only list of records: stream length
+// (uint8), stream, entry offset (uint64) and entry version (uint64). Index is written for every sealed segment
+// (empty when the segment has no stream entries), therefore it is authoritative - segments are scanned only when
+// the index is missing (for example in logs written by older versions) or stale. Writer repairs missing indexes
+// when opened. The tail of the last segment might not be indexed yet, because the Writer could crash before
+// indexing the entry, so it is always scanned.
+const streamIndexFilenameExtension = ".streams"
+
+const streamIndexRecordFixedSize = streamLengthSize + 8 + streamVersionSize
+
+func streamIndexFilenameStartingAt(t time.Time) string {
+	return streamIndexFilename(segmentFilenameStartingAt(t))
+}
+
+func streamIndexFilename(segmentFile string) string {
+	return strings.TrimSuffix(segmentFile, segmentFilenameExtension) + streamIndexFilenameExtension
+}
+
+func validateStream(stream string) error {
+	if stream == "" {
+		return fmt.Errorf("empty stream: %w", ErrInvalidParameter)
+	}
+
+	if len(stream) > math.MaxUint8 {
+		return fmt.Errorf("stream is longer than 255 bytes: %w", ErrInvalidParameter)
+	}
+
+	return nil
+}
+
+type streamIndexRecord struct {
+	stream  string
+	offset  int64
+	version uint64
+}
+
+func appendStreamIndexRecord(out []byte, record streamIndexRecord) []byte {
+	out = append(out, byte(len(record.stream)))
+	out = append(out, record.stream...)
+	out = binary.LittleEndian.AppendUint64(out, uint64(record.offset))
+
+	return binary.LittleEndian.AppendUint64(out, record.version)
+}
+
+// parseStreamIndex returns records of the stream (or all records when stream is empty). Torn record at the end
+// of the index is ignored and complete is false in such case.
+func parseStreamIndex(data []byte, stream string) (records []streamIndexRecord, complete bool) {
+	for len(data) > 0 {
+		recordSize := streamIndexRecordFixedSize + int(data[0])
+		if len(data) < recordSize {
+			return records, false
+		}
+
+		recordStream := data[streamLengthSize : streamLengthSize+int(data[0])]
+		if stream == "" || string(recordStream) == stream {
+			fixed := data[streamLengthSize+len(recordStream):]
+			records = append(records, streamIndexRecord{
+				stream:  string(recordStream),
+				offset:  int64(binary.LittleEndian.Uint64(fixed)),
+				version: binary.LittleEndian.Uint64(fixed[8:]),
+			})
+		}
+
+		data = data[recordSize:]
+	}
+
+	return records, true
+}
+
+// readStreamIndex returns indexed entries of the stream. exists is false when segment has no index.
+func readStreamIndex(dir string, t time.Time, stream string) (records []streamIndexRecord, exists bool, err error) {
+	data, err := os.ReadFile(path.Join(dir, streamIndexFilenameStartingAt(t)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, fmt.Errorf("reading stream index failed: %w", err)
+	}
+
+	records, _ = parseStreamIndex(data, stream)
+
+	return records, true, nil
+}
+
+// writeStreamIndex atomically replaces the stream index of the segment.
+func writeStreamIndex(dir string, t time.Time, records []streamIndexRecord) error {
+	filename := path.Join(dir, streamIndexFilenameStartingAt(t))
+
+	data := []byte{}
+	for _, record := range records {
+		data = appendStreamIndexRecord(data, record)
+	}
+
+	tmpFilename := filename + tmpFilenameExtension
+
+	tmp, err := os.OpenFile(tmpFilename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
+	if err != nil {
+		return fmt.Errorf("error opening temporary stream index file %s for write: %w", tmpFilename, err)
+	}
+
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmpFilename)
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return fmt.Errorf("writing temporary stream index file failed: %w", err)
+	}
+
+	return replaceFile(tmp, filename)
+}
+
+func removeStreamIndex(dir string, t time.Time) error {
+	filename := path.Join(dir, streamIndexFilenameStartingAt(t))
+	if err := os.Remove(filename); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing file %s failed: %w", filename, err)
+	}
+
+	return nil
+}
+
+// moveStreamIndex moves the stream index together with the moved segment.
+func moveStreamIndex(srcDir, dstDir string, t time.Time) error {
+	name := streamIndexFilenameStartingAt(t)
+	src := path.Join(srcDir, name)
+
+	if _, err := os.Stat(src); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err := os.Rename(src, path.Join(dstDir, name)); err == nil {
+		return nil
+	}
+
+	if err := copySegmentFile(src, path.Join(dstDir, name)); err != nil {
+		return err
+	}
+
+	return removeStreamIndex(srcDir, t)
+}
+
+// copyStreamIndex makes the stream index in dstDir the same as in srcDir.
+func copyStreamIndex(srcDir, dstDir string, t time.Time) error {
+	name := streamIndexFilenameStartingAt(t)
+	src := path.Join(srcDir, name)
+
+	if _, err := os.Stat(src); errors.Is(err, os.ErrNotExist) {
+		return removeStreamIndex(dstDir, t)
+	}
+
+	return copySegmentFile(src, path.Join(dstDir, name))
+}
+
+// repairStreamIndex creates missing stream index or adds missing records to it. Records can be missing when
+// the process crashed after writing the entry, but before writing the index. Only entries after the last indexed
+// one are scanned, unless the index is stale (for example because the segment was truncated) - then the whole
+// index is rebuilt.
+func repairStreamIndex(dir string, t time.Time) error {
+	data, err := os.ReadFile(path.Join(dir, streamIndexFilenameStartingAt(t)))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("reading stream index failed: %w", err)
+	}
+
+	changed := errors.Is(err, os.ErrNotExist)
+	records, complete := parseStreamIndex(data, "")
+	changed = changed || !complete
+
+	file, err := os.Open(path.Join(dir, segmentFilenameStartingAt(t)))
+	if err != nil {
+		return fmt.Errorf("opening segment file failed: %w", err)
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var unindexed []streamIndexRecord
+
+	stale, err := scanUnindexedEntries(file, records, func(offset int64, e logEntry) {
+		unindexed = append(unindexed, streamIndexRecord{stream: e.stream, offset: offset, version: e.version})
+	})
+	if err != nil {
+		return err
+	}
+
+	if stale {
+		records = nil
+		changed = true
+	}
+
+	if !changed && len(unindexed) == 0 {
+		return nil
+	}
+
+	return writeStreamIndex(dir, t, append(records, unindexed...))
+}
+
+// repairMissingStreamIndexes creates stream indexes for segments which do not have one.
+func repairMissingStreamIndexes(dir string, segments []Segment) error {
+	for _, segment := range segments {
+		_, err := os.Stat(path.Join(dir, streamIndexFilenameStartingAt(segment.StartingAt)))
+		if err == nil {
+			continue
+		}
+
+		if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("stat failed for stream index: %w", err)
+		}
+
+		if err = repairStreamIndex(dir, segment.StartingAt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scanUnindexedEntries calls f for each stream entry written after the last indexed entry. When the last record
+// does not match the segment, the index is stale and all stream entries are scanned. Partially written entry at
+// the end of the segment is ignored.
+func scanUnindexedEntries(file io.ReadSeeker, records []streamIndexRecord, f func(offset int64, e logEntry)) (
+	stale bool, err error,
+) {
+	var offset int64
+
+	if len(records) > 0 {
+		end, valid := indexedEntryEnd(file, records[len(records)-1])
+		if valid {
+			offset = end
+		} else {
+			stale = true
+		}
+	}
+
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		return false, fmt.Errorf("seeking to entry starting position failed: %w", err)
+	}
+
+	reader := bufio.NewReader(file)
+
+	for {
+		e, err := decodeLogEntry(reader)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return stale, nil
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		if e.stream != "" {
+			f(offset, e)
+		}
+
+		offset += e.size()
+	}
+}
+
+// indexedEntryEnd returns the offset after the indexed entry. valid is false when the entry does not match
+// the index record.
+func indexedEntryEnd(file io.ReadSeeker, record streamIndexRecord) (end int64, valid bool) {
+	if _, err := file.Seek(record.offset, io.SeekStart); err != nil {
+		return 0, false
+	}
+
+	e, err := decodeLogEntry(file)
+	if err != nil || e.stream != record.stream || e.version != record.version {
+		return 0, false
+	}
+
+	return record.offset + e.size(), true
+}
+
+// indexingWriter encodes entries and collects stream index records for them. It is used when segment file
+// is rewritten.
+type indexingWriter struct {
+	writer  io.Writer
+	offset  int64
+	records []streamIndexRecord
+}
+
+func (w *indexingWriter) write(e logEntry) error {
+	if err := encodeLogEntry(w.writer, e); err != nil {
+		return err
+	}
+
+	if e.stream != "" {
+		w.records = append(w.records, streamIndexRecord{stream: e.stream, offset: w.offset, version: e.version})
+	}
+
+	w.offset += e.size()
+
+	return nil
+}
+
+// StreamReader is returned by OpenReader when ForStream option was used.
+type StreamReader interface {
+	StreamEntryReader
+	// ReadVersion works like Read, but additionally returns the version of the entry in the stream.
+	ReadVersion() (time.Time, uint64, []byte, error)
+}
+
+// StreamEntryReader is implemented by all Readers returned by OpenReader and OpenTailReader. It can be used
+// to copy entries to another log without losing their streams (see Writer.WriteToStreamWithTime).
+type StreamEntryReader interface {
+	Reader
+	// ReadStreamEntry works like Read, but additionally returns the stream and version of the entry. Stream is empty
+	// for entries not written to a stream.
+	ReadStreamEntry() (t time.Time, stream string, version uint64, data []byte, err error)
+}
+
+func (l *Log) openStreamReader(settings *ReaderSettings) (StreamEntryReader, error) {
+	for {
+		segments, err := l.Segments()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(segments) == 0 {
+			return &emptyLogReader{}, nil
+		}
+
+		r, err := l.openStreamReaderAt(settings, segments)
+		if errors.Is(err, os.ErrNotExist) {
+			// segment was removed after listing, so segments must be listed again
+			continue
+		}
+
+		return r, err
+	}
+}
+
+func (l *Log) openStreamReaderAt(settings *ReaderSettings, segments []Segment) (StreamEntryReader, error) {
+	r := &streamReader{
+		dir:            l.dir,
+		stream:         settings.stream,
+		from:           settings.startingFrom,
+		segments:       segments,
+		observer:       settings.observer,
+		currentSegment: -1,
+	}
+
+	first := 0
+
+	for i, segment := range segments {
+		if segment.StartingAt.After(settings.startingFrom) {
+			break
+		}
+
+		first = i
+	}
+
+	if err := r.openSegment(first); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// streamReader reads entries of one stream. Segments with the stream index are read using the index,
+// segments without it are scanned. The tail of the last segment is always scanned, because it might not be
+// indexed yet.
+type streamReader struct {
+	dir            string
+	stream         string
+	from           time.Time
+	segments       []Segment
+	currentSegment int
+	segmentFile    *os.File
+	reader         *bufio.Reader
+	offset         int64
+	records        []streamIndexRecord
+	scanning       bool
+	lastTime       time.Time
+	observer       ReaderObserver
+}
+
+func (r *streamReader) Read() (time.Time, []byte, error) {
+	e, err := r.read()
+
+	return e.time, e.data, err
+}
+
+func (r *streamReader) ReadVersion() (time.Time, uint64, []byte, error) {
+	e, err := r.read()
+
+	return e.time, e.version, e.data, err
+}
+
+func (r *streamReader) ReadStreamEntry() (time.Time, string, uint64, []byte, error) {
+	e, err := r.read()
+
+	return e.time, e.stream, e.version, e.data, err
+}
+
+func (r *streamReader) read() (logEntry, error) {
+	for {
+		e, err := r.next()
+		if err != nil {
+			return logEntry{}, err
+		}
+
+		if e.stream != r.stream || !e.time.After(r.lastTime) || e.time.Before(r.from) {
+			continue
+		}
+
+		r.lastTime = e.time
+		r.observer.EntryRead(len(e.data))
+
+		return e, nil
+	}
+}
+
+// next returns the next indexed entry or the next scanned entry (which may belong to other stream).
+func (r *streamReader) next() (logEntry, error) {
+	for {
+		if r.scanning {
+			return r.scan()
+		}
+
+		if len(r.records) == 0 {
+			if r.currentSegment == len(r.segments)-1 {
+				r.scanning = true
+
+				continue
+			}
+
+			if err := r.openNextSegment(); err != nil {
+				return logEntry{}, err
+			}
+
+			continue
+		}
+
+		record := r.records[0]
+		r.records = r.records[1:]
+
+		if _, err := r.segmentFile.Seek(record.offset, io.SeekStart); err != nil {
+			return logEntry{}, fmt.Errorf("seeking to entry starting position failed: %w", err)
+		}
+
+		r.reader.Reset(r.segmentFile)
+
+		e, err := decodeLogEntry(r.reader)
+		if err != nil || e.stream != record.stream || e.version != record.version {
+			// index is stale, so the whole segment must be scanned
+			if err = r.startScanning(0); err != nil {
+				return logEntry{}, err
+			}
+
+			continue
+		}
+
+		r.offset = record.offset + e.size()
+
+		return e, nil
+	}
+}
+
+func (r *streamReader) scan() (logEntry, error) {
+	e, err := decodeLogEntry(r.reader)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		// entry might not be fully written yet, so it will be read again by the next Read
+		if err = r.startScanning(r.offset); err != nil {
+			return logEntry{}, err
+		}
+
+		if err = r.openNextSegment(); err != nil {
+			return logEntry{}, err
+		}
+
+		return r.next()
+	}
+
+	if err != nil {
+		return logEntry{}, err
+	}
+
+	r.offset += e.size()
+
+	return e, nil
+}
+
+func (r *streamReader) startScanning(offset int64) error {
+	if _, err := r.segmentFile.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("seeking to entry starting position failed: %w", err)
+	}
+
+	r.reader.Reset(r.segmentFile)
+	r.offset = offset
+	r.records = nil
+	r.scanning = true
+
+	return nil
+}
+
+func (r *streamReader) openNextSegment() error {
+	next := r.currentSegment + 1
+	if next >= len(r.segments) {
+		return ErrEOL
+	}
+
+	segment := r.segments[next]
+
+	err := r.openSegment(next)
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	segments, index, continuation, err := locateMissingSegment(r.dir, r.segments[r.currentSegment], r.segmentFile,
+		segment)
+	if err != nil {
+		return err
+	}
+
+	if index == -1 {
+		// current (fully read) segment file is kept open, so next Read will skip to the following segment
+		r.currentSegment = next
+		r.records = nil
+		r.scanning = false
+
+		return fmt.Errorf("segment starting at %s not found: %w", segment.StartingAt, ErrSegmentCompacted)
+	}
+
+	// entries already returned are skipped by read
+	r.segments = segments
+
+	if err = r.openSegment(index); err != nil {
+		return err
+	}
+
+	if !continuation {
+		return fmt.Errorf("segment starting at %s was rewritten: %w", segments[index].StartingAt, ErrSegmentCompacted)
+	}
+
+	return nil
+}
+
+func (r *streamReader) refreshSegments() (bool, error) {
+	segments, index, err := relistSegments(r.dir, r.segments[r.currentSegment])
+	if err != nil || index == -1 {
+		return false, err
+	}
+
+	r.segments = segments
+	r.currentSegment = index
+
+	return true, nil
+}
+
+func (r *streamReader) openSegment(i int) error {
+	segment := r.segments[i]
+
+	f, err := openSegmentFileForRead(r.dir, segment)
+	if err != nil {
+		return err
+	}
+
+	records, indexed, err := readStreamIndex(r.dir, segment.StartingAt, r.stream)
+	if err != nil {
+		_ = f.Close()
+
+		return err
+	}
+
+	if r.segmentFile != nil {
+		_ = r.segmentFile.Close()
+	}
+
+	r.segmentFile = f
+	r.reader = bufio.NewReader(f)
+	r.offset = 0
+	r.currentSegment = i
+	r.records = records
+	r.scanning = !indexed
+
+	return nil
+}
+
+func (r *streamReader) Close() error {
+	if err := r.segmentFile.Close(); err != nil {
+		return fmt.Errorf("error closing segment file: %w", err)
+	}
+
+	return nil
+}
+
+// StreamVersion returns the version of the last entry written to the stream. 0 is returned when the stream
+// has no entries.
+func (l *Log) StreamVersion(stream string) (uint64, error) {
+	if err := validateStream(stream); err != nil {
+		return 0, err
+	}
+
+	segments, err := l.Segments()
+	if err != nil {
+		return 0, err
+	}
+
+	for i := len(segments) - 1; i >= 0; i-- {
+		version, err := l.segmentStreamVersion(stream, segments[i], i == len(segments)-1)
+		if errors.Is(err, os.ErrNotExist) {
+			// segment was removed after listing
+			continue
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		if version > 0 {
+			return version, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// segmentStreamVersion returns 0 when the segment has no entries of the stream. Sealed segments are not scanned,
+// unless their index is missing.
+func (l *Log) segmentStreamVersion(stream string, segment Segment, last bool) (uint64, error) {
+	records, indexed, err := readStreamIndex(l.dir, segment.StartingAt, "")
+	if err != nil {
+		return 0, err
+	}
+
+	if indexed && !last {
+		return lastStreamVersion(records, stream), nil
+	}
+
+	file, err := openSegmentFileForRead(l.dir, segment)
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var unindexedVersion uint64
+
+	stale, err := scanUnindexedEntries(file, records, func(_ int64, e logEntry) {
+		if e.stream == stream {
+			unindexedVersion = e.version
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if unindexedVersion > 0 || stale {
+		return unindexedVersion, nil
+	}
+
+	return lastStreamVersion(records, stream), nil
+}
+
+func lastStreamVersion(records []streamIndexRecord, stream string) uint64 {
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].stream == stream {
+			return records[i].version
+		}
+	}
+
+	return 0
+}
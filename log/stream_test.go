@@ -0,0 +1,451 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package log_test
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elgopher/logstore/internal/tests"
+	"github.com/elgopher/logstore/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter_WriteToStream(t *testing.T) {
+	t.Run("should return error for invalid stream", func(t *testing.T) {
+		writer := tests.OpenLogWriter(t)
+		invalidStreams := []string{"", strings.Repeat("s", 256)}
+
+		for _, stream := range invalidStreams {
+			// when
+			_, _, err := writer.WriteToStream(stream, data1)
+			// then
+			assert.ErrorIs(t, err, log.ErrInvalidParameter)
+		}
+	})
+
+	t.Run("should assign consecutive versions", func(t *testing.T) {
+		writer := tests.OpenLogWriter(t)
+		// when
+		_, version1, err1 := writer.WriteToStream("order-1", data1)
+		_, otherVersion, err2 := writer.WriteToStream("order-2", data1)
+		_, version2, err3 := writer.WriteToStream("order-1", data2)
+		// then
+		require.NoError(t, err1)
+		require.NoError(t, err2)
+		require.NoError(t, err3)
+		assert.Equal(t, uint64(1), version1)
+		assert.Equal(t, uint64(1), otherVersion)
+		assert.Equal(t, uint64(2), version2)
+	})
+
+	t.Run("should continue versions after reopening the log", func(t *testing.T) {
+		l := writeStreams(t)
+		writer, err := l.OpenWriter()
+		require.NoError(t, err)
+		defer tests.Close(t, writer)
+		// when
+		_, version, err := writer.WriteToStream("order-1", data1)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, uint64(4), version)
+	})
+
+	t.Run("should continue versions after truncation", func(t *testing.T) {
+		writer := tests.OpenLogWriter(t)
+		entryTime, _, err := writer.WriteToStream("order-1", data1)
+		require.NoError(t, err)
+		_, _, err = writer.WriteToStream("order-1", data2)
+		require.NoError(t, err)
+		require.NoError(t, writer.TruncateAfter(entryTime))
+		// when
+		_, version, err := writer.WriteToStream("order-1", data2)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), version)
+	})
+
+	t.Run("should write stream index for every sealed segment", func(t *testing.T) {
+		l := writeStreams(t)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		// when
+		for _, segment := range segments[:len(segments)-1] {
+			_, err = os.Stat(path.Join(l.Dir(), streamIndexFilename(segment)))
+			// then
+			assert.NoError(t, err)
+		}
+	})
+
+	t.Run("should write stream entries to mirrors", func(t *testing.T) {
+		mirrorDir := tests.TempDir(t)
+		writer := tests.OpenLogWriter(t, log.Mirrors(mirrorDir))
+		// when
+		_, _, err := writer.WriteToStream("order-1", data1)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, []streamEntry{{Version: 1, Data: data1}}, readStream(t, log.New(mirrorDir), "order-1"))
+	})
+}
+
+func TestWriter_WriteToStreamWithTime(t *testing.T) {
+	t.Run("should write entry with given time and version", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		// when
+		err := writer.WriteToStreamWithTime(time2005, "order-1", 5, data1)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, []streamEntry{{Version: 5, Data: data1}}, readStream(t, l, "order-1"))
+		version, err := writer.StreamVersion("order-1")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(5), version)
+	})
+
+	t.Run("should return error when version is not greater than current version", func(t *testing.T) {
+		writer := tests.OpenLogWriter(t)
+		require.NoError(t, writer.WriteToStreamWithTime(time2005, "order-1", 2, data1))
+		// when
+		err := writer.WriteToStreamWithTime(time2006, "order-1", 2, data2)
+		// then
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error when time is not after last entry time", func(t *testing.T) {
+		writer := tests.OpenLogWriter(t)
+		require.NoError(t, writer.WriteWithTime(time2006, data1))
+		// when
+		err := writer.WriteToStreamWithTime(time2005, "order-1", 1, data2)
+		// then
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+}
+
+func TestLog_StreamVersion(t *testing.T) {
+	t.Run("should return 0 for stream without entries", func(t *testing.T) {
+		l := writeStreams(t)
+		// when
+		version, err := l.StreamVersion("order-3")
+		// then
+		require.NoError(t, err)
+		assert.Zero(t, version)
+	})
+
+	t.Run("should return version of the last entry", func(t *testing.T) {
+		l := writeStreams(t)
+		// when
+		version, err := l.StreamVersion("order-2")
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), version)
+	})
+
+	t.Run("should return version when stream indexes are missing", func(t *testing.T) {
+		l := writeStreams(t)
+		removeStreamIndexes(t, l)
+		// when
+		version, err := l.StreamVersion("order-1")
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, uint64(3), version)
+	})
+}
+
+func TestForStream(t *testing.T) {
+	t.Run("should return error for invalid stream", func(t *testing.T) {
+		l := writeStreams(t)
+		// when
+		_, err := l.OpenReader(log.ForStream(""))
+		// then
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should read only entries from the stream", func(t *testing.T) {
+		l := writeStreams(t)
+		// when
+		entries := readStream(t, l, "order-1")
+		// then
+		expected := []streamEntry{
+			{Version: 1, Data: []byte("a1")},
+			{Version: 2, Data: []byte("a2")},
+			{Version: 3, Data: []byte("a3")},
+		}
+		assert.Equal(t, expected, entries)
+	})
+
+	t.Run("should return ErrEOL for stream without entries", func(t *testing.T) {
+		l := writeStreams(t)
+		// when
+		entries := readStream(t, l, "order-3")
+		// then
+		assert.Empty(t, entries)
+	})
+
+	t.Run("should read stream entries starting from given time", func(t *testing.T) {
+		l := writeStreams(t)
+		reader := tests.OpenReader(t, l, log.ForStream("order-1"))
+		_, _, err := reader.Read()
+		require.NoError(t, err)
+		secondEntryTime, _, err := reader.Read()
+		require.NoError(t, err)
+		// when
+		entries := readStream(t, l, "order-1", log.StartingFrom(secondEntryTime))
+		// then
+		require.Len(t, entries, 2)
+		assert.Equal(t, uint64(2), entries[0].Version)
+	})
+
+	t.Run("should read stream entries when stream indexes are missing", func(t *testing.T) {
+		l := writeStreams(t)
+		removeStreamIndexes(t, l)
+		// when
+		entries := readStream(t, l, "order-2")
+		// then
+		expected := []streamEntry{
+			{Version: 1, Data: []byte("b1")},
+			{Version: 2, Data: []byte("b2")},
+		}
+		assert.Equal(t, expected, entries)
+	})
+
+	t.Run("should read stream entries when stream index is stale", func(t *testing.T) {
+		l := writeStreams(t)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		// index points to "order-1" entry, but claims it belongs to "order-2"
+		copyStreamIndex(t, l, segments[1], segments[4])
+		// when
+		entries := readStream(t, l, "order-2")
+		// then
+		expected := []streamEntry{
+			{Version: 1, Data: []byte("b1")},
+			{Version: 2, Data: []byte("b2")},
+		}
+		assert.Equal(t, expected, entries)
+	})
+
+	t.Run("should read entries of the last segment not indexed yet", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		_, _, err := writer.WriteToStream("order-1", data1)
+		require.NoError(t, err)
+		_, _, err = writer.WriteToStream("order-1", data2)
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		// simulate crash before indexing the second entry
+		indexFile := path.Join(l.Dir(), streamIndexFilename(segments[0]))
+		require.NoError(t, os.Truncate(indexFile, int64(1+len("order-1")+16)))
+		// when
+		entries := readStream(t, l, "order-1")
+		// then
+		expected := []streamEntry{
+			{Version: 1, Data: data1},
+			{Version: 2, Data: data2},
+		}
+		assert.Equal(t, expected, entries)
+	})
+
+	t.Run("should repair stream index when Writer is opened", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		_, _, err := writer.WriteToStream("order-1", data1)
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+		removeStreamIndexes(t, l)
+		// when
+		writer, err = l.OpenWriter()
+		// then
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		assert.FileExists(t, path.Join(l.Dir(), streamIndexFilename(segments[0])))
+	})
+
+	t.Run("should read entries written after reader returned ErrEOL", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		_, _, err := writer.WriteToStream("order-1", data1)
+		require.NoError(t, err)
+		reader := tests.OpenReader(t, l, log.ForStream("order-1"))
+		_, _, err = reader.Read()
+		require.NoError(t, err)
+		_, _, err = reader.Read()
+		require.ErrorIs(t, err, log.ErrEOL)
+		_, _, err = writer.WriteToStream("order-1", data2)
+		require.NoError(t, err)
+		// when
+		_, data, err := reader.Read()
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, data2, data)
+	})
+
+	t.Run("should read stream entries after merging segments", func(t *testing.T) {
+		l := writeStreams(t)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		require.NoError(t, l.MergeSegments(segments[0].StartingAt, segments[len(segments)-2].StartingAt))
+		// when
+		entries := readStream(t, l, "order-1")
+		// then
+		assert.Len(t, entries, 3)
+	})
+
+	t.Run("should read stream entries after filtering segment", func(t *testing.T) {
+		l := writeStreams(t)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		_, _, err = l.FilterSegmentStartingAt(segments[0].StartingAt, func(_ time.Time, data []byte) bool {
+			return string(data) != "p1"
+		})
+		require.NoError(t, err)
+		// when
+		entries := readStream(t, l, "order-2")
+		// then
+		assert.Len(t, entries, 2)
+	})
+
+	t.Run("should read stream entries from moved segment", func(t *testing.T) {
+		l := writeStreams(t)
+		archive := log.New(tests.TempDir(t))
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		require.NoError(t, l.MoveSegmentStartingAt(segments[0].StartingAt, archive))
+		// when
+		entries := readStream(t, archive, "order-1")
+		// then
+		assert.Equal(t, []streamEntry{{Version: 1, Data: []byte("a1")}}, entries)
+	})
+}
+
+func TestForStream_SegmentCompacted(t *testing.T) {
+	t.Run("should return ErrSegmentCompacted when next segment was removed", func(t *testing.T) {
+		l := writeStreams(t)
+		reader := tests.OpenReader(t, l, log.ForStream("order-1"))
+		_, _, err := reader.Read()
+		require.NoError(t, err)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		require.NoError(t, l.RemoveSegmentStartingAt(segments[1].StartingAt))
+		// when
+		_, _, err = reader.Read()
+		// then
+		require.ErrorIs(t, err, log.ErrSegmentCompacted)
+		// and
+		_, data, err := reader.Read()
+		require.NoError(t, err)
+		assert.Equal(t, []byte("a2"), data)
+	})
+}
+
+func TestReader_ReadStreamEntries(t *testing.T) {
+	t.Run("should read stream entries together with plain ones", func(t *testing.T) {
+		l := writeStreams(t)
+		// when
+		entries := tests.ReadAll(t, l)
+		// then
+		require.Len(t, entries, 6)
+		assert.Equal(t, []byte("p1"), entries[1].Data)
+	})
+
+	t.Run("should verify log with stream entries", func(t *testing.T) {
+		l := writeStreams(t)
+		// when
+		report, err := l.Verify()
+		// then
+		require.NoError(t, err)
+		assert.True(t, report.OK())
+		assert.Equal(t, 6, report.EntriesChecked)
+	})
+}
+
+// writeStreams writes entries of streams "order-1" and "order-2" and one plain entry to multiple segments.
+func writeStreams(t *testing.T) *log.Log {
+	t.Helper()
+
+	clock := &tests.Clock{CurrentTime: &time2005}
+	l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentDuration(time.Minute), log.NowFunc(clock.Now))
+
+	write := func(stream, data string) {
+		var err error
+		if stream == "" {
+			_, err = writer.Write([]byte(data))
+		} else {
+			_, _, err = writer.WriteToStream(stream, []byte(data))
+		}
+
+		require.NoError(t, err)
+		clock.MoveForwardOneHour()
+	}
+
+	write("order-1", "a1")
+	write("", "p1")
+	write("order-2", "b1")
+	write("order-1", "a2")
+	write("order-2", "b2")
+	write("order-1", "a3")
+	require.NoError(t, writer.Close())
+
+	segments, err := l.Segments()
+	require.NoError(t, err)
+	require.Greater(t, len(segments), 2)
+
+	return l
+}
+
+type streamEntry struct {
+	Version uint64
+	Data    []byte
+}
+
+func readStream(t *testing.T, l *log.Log, stream string, options ...log.OpenReaderOption) []streamEntry {
+	t.Helper()
+
+	reader := tests.OpenReader(t, l, append(options, log.ForStream(stream))...)
+	streamReader, ok := reader.(log.StreamReader)
+	require.True(t, ok, "reader should implement StreamReader")
+
+	var entries []streamEntry
+
+	for {
+		_, version, data, err := streamReader.ReadVersion()
+		if errors.Is(err, log.ErrEOL) {
+			return entries
+		}
+
+		require.NoError(t, err)
+
+		entries = append(entries, streamEntry{Version: version, Data: data})
+	}
+}
+
+func streamIndexFilename(segment log.Segment) string {
+	return strings.TrimSuffix(segmentFilename(segment), ".segment") + ".streams"
+}
+
+func removeStreamIndexes(t *testing.T, l *log.Log) {
+	t.Helper()
+
+	segments, err := l.Segments()
+	require.NoError(t, err)
+
+	for _, segment := range segments {
+		err = os.Remove(path.Join(l.Dir(), streamIndexFilename(segment)))
+		if !errors.Is(err, os.ErrNotExist) {
+			require.NoError(t, err)
+		}
+	}
+}
+
+func copyStreamIndex(t *testing.T, l *log.Log, src, dst log.Segment) {
+	t.Helper()
+
+	data, err := os.ReadFile(path.Join(l.Dir(), streamIndexFilename(src)))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path.Join(l.Dir(), streamIndexFilename(dst)), data, 0600))
+}
@@ -0,0 +1,132 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const defaultPollInterval = 100 * time.Millisecond
+
+// OpenTailReader opens a Reader which does not return ErrEOL. Instead, Read waits for new entries written
+// by the Writer. Read returns ctx.Err() once ctx is cancelled.
+func (l *Log) OpenTailReader(ctx context.Context, options ...OpenReaderOption) (Reader, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("nil context: %w", ErrInvalidParameter)
+	}
+
+	settings := &ReaderSettings{
+		pollInterval: defaultPollInterval,
+	}
+
+	for _, applyOption := range options {
+		if applyOption == nil {
+			continue
+		}
+
+		if err := applyOption(settings); err != nil {
+			return nil, fmt.Errorf("error applying option: %w", err)
+		}
+	}
+
+	reader, err := l.openReader(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tailReader{
+		log:          l,
+		ctx:          ctx,
+		reader:       reader,
+		options:      options,
+		pollInterval: settings.pollInterval,
+	}, nil
+}
+
+type tailReader struct {
+	log          *Log
+	ctx          context.Context
+	reader       StreamEntryReader
+	options      []OpenReaderOption
+	pollInterval time.Duration
+	lastTime     time.Time
+	anyRead      bool
+}
+
+func (r *tailReader) Read() (time.Time, []byte, error) {
+	t, _, _, data, err := r.ReadStreamEntry()
+
+	return t, data, err
+}
+
+func (r *tailReader) ReadStreamEntry() (time.Time, string, uint64, []byte, error) {
+	for {
+		if err := r.ctx.Err(); err != nil {
+			return time.Time{}, "", 0, nil, err
+		}
+
+		t, stream, version, data, err := r.reader.ReadStreamEntry()
+		if err == nil {
+			r.lastTime = t
+			r.anyRead = true
+
+			return t, stream, version, data, nil
+		}
+
+		if !errors.Is(err, ErrEOL) {
+			return time.Time{}, "", 0, nil, err
+		}
+
+		if err = r.waitForNewEntries(); err != nil {
+			return time.Time{}, "", 0, nil, err
+		}
+	}
+}
+
+// segmentsRefresher is implemented by readers, which can read entries from segments created after the reader
+// was opened.
+type segmentsRefresher interface {
+	// refreshSegments lists segments again. It returns false when the current segment is not listed anymore.
+	refreshSegments() (bool, error)
+}
+
+// waitForNewEntries waits for poll interval and lists segments again, because the Writer could create new segments
+// in the meantime. The current segment file is kept open, so next read continues from the last offset. The reader
+// is reopened only when the log was empty or the current segment was removed.
+func (r *tailReader) waitForNewEntries() error {
+	select {
+	case <-r.ctx.Done():
+		return r.ctx.Err()
+	case <-time.After(r.pollInterval):
+	}
+
+	if refresher, ok := r.reader.(segmentsRefresher); ok {
+		refreshed, err := refresher.refreshSegments()
+		if err != nil || refreshed {
+			return err
+		}
+	}
+
+	options := r.options
+	if r.anyRead {
+		options = append(options[:len(options):len(options)], StartingFrom(r.lastTime.Add(time.Nanosecond)))
+	}
+
+	reader, err := r.log.openReader(options)
+	if err != nil {
+		return err
+	}
+
+	_ = r.reader.Close()
+	r.reader = reader
+
+	return nil
+}
+
+func (r *tailReader) Close() error {
+	return r.reader.Close()
+}
@@ -0,0 +1,150 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package log_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/elgopher/logstore/internal/tests"
+	"github.com/elgopher/logstore/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLog_OpenTailReader(t *testing.T) {
+	t.Run("should return error for nil context", func(t *testing.T) {
+		l := log.New(tests.TempDir(t))
+		//nolint:staticcheck // nil context is tested on purpose
+		_, err := l.OpenTailReader(nil)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error for invalid poll interval", func(t *testing.T) {
+		l := log.New(tests.TempDir(t))
+		_, err := l.OpenTailReader(context.Background(), log.PollInterval(0))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should read existing entries", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		require.NoError(t, writer.WriteWithTime(time2005, data1))
+		reader := openTailReader(t, l, context.Background())
+		// when
+		actualTime, actualData, err := reader.Read()
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, time2005, actualTime)
+		assert.Equal(t, data1, actualData)
+	})
+
+	t.Run("should wait for entries written later", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		reader := openTailReader(t, l, context.Background())
+		async := tests.RunAsync(func() {
+			// when
+			actualTime, actualData, err := reader.Read()
+			// then
+			require.NoError(t, err)
+			assert.Equal(t, time2005, actualTime)
+			assert.Equal(t, data1, actualData)
+		})
+		require.NoError(t, writer.WriteWithTime(time2005, data1))
+		async.WaitOrFailAfter(t, 5*time.Second)
+	})
+
+	t.Run("should read entries from new segments", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentDuration(time.Minute))
+		require.NoError(t, writer.WriteWithTime(time2005, data1))
+		reader := openTailReader(t, l, context.Background())
+		_, _, err := reader.Read()
+		require.NoError(t, err)
+		require.NoError(t, writer.WriteWithTime(time2006, data2))
+		// when
+		actualTime, actualData, err := reader.Read()
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, time2006, actualTime)
+		assert.Equal(t, data2, actualData)
+	})
+
+	t.Run("should read stream entries from new segments", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentDuration(time.Minute))
+		require.NoError(t, writer.WriteToStreamWithTime(time2005, "stream", 1, data1))
+		reader, err := l.OpenTailReader(context.Background(), log.ForStream("stream"), log.PollInterval(time.Millisecond))
+		require.NoError(t, err)
+		defer tests.Close(t, reader)
+		_, _, err = reader.Read()
+		require.NoError(t, err)
+		require.NoError(t, writer.WriteWithTime(time2006, data1))
+		require.NoError(t, writer.WriteToStreamWithTime(time2006.Add(time.Hour), "stream", 2, data2))
+		// when
+		actualTime, actualData, err := reader.Read()
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, time2006.Add(time.Hour), actualTime)
+		assert.Equal(t, data2, actualData)
+	})
+
+	t.Run("should not reopen reader while waiting for new entries", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		require.NoError(t, writer.WriteWithTime(time2005, data1))
+		observer := &seekCounter{}
+		reader, err := l.OpenTailReader(context.Background(),
+			log.StartingFrom(time2005), log.ObserveReader(observer), log.PollInterval(time.Millisecond))
+		require.NoError(t, err)
+		defer tests.Close(t, reader)
+		_, _, err = reader.Read()
+		require.NoError(t, err)
+		async := tests.RunAsync(func() {
+			_, _, err := reader.Read()
+			require.NoError(t, err)
+		})
+		time.Sleep(50 * time.Millisecond) // wait for many polls
+		require.NoError(t, writer.WriteWithTime(time2006, data2))
+		async.WaitOrFailAfter(t, 5*time.Second)
+		// when
+		seeks := observer.seeks.Load()
+		// then
+		assert.Equal(t, int32(1), seeks)
+	})
+
+	t.Run("should return context error when context was cancelled", func(t *testing.T) {
+		l := log.New(tests.TempDir(t))
+		ctx, cancel := context.WithCancel(context.Background())
+		reader := openTailReader(t, l, ctx)
+		async := tests.RunAsync(func() {
+			// when
+			_, _, err := reader.Read()
+			// then
+			assert.ErrorIs(t, err, context.Canceled)
+		})
+		cancel()
+		async.WaitOrFailAfter(t, 5*time.Second)
+	})
+}
+
+type seekCounter struct {
+	seeks atomic.Int32
+}
+
+func (c *seekCounter) EntryRead(int) {}
+
+func (c *seekCounter) Seeked(time.Duration) {
+	c.seeks.Add(1)
+}
+
+func openTailReader(t *testing.T, l *log.Log, ctx context.Context) log.Reader {
+	t.Helper()
+
+	reader, err := l.OpenTailReader(ctx, log.PollInterval(time.Millisecond))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = reader.Close()
+	})
+
+	return reader
+}
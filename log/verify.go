@@ -0,0 +1,278 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package log
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/elgopher/logstore/internal/fsutil"
+)
+
+type ProblemKind string
+
+const (
+	// ProblemTornTail means that the last entry in a segment was written partially, for example because
+	// the process crashed during Write. Entry cut by the end of the segment is reported as ProblemCorruptSegment
+	// instead, when a valid entry follows it, because its length was probably corrupted.
+	ProblemTornTail ProblemKind = "torn-tail"
+	// ProblemCorruptSegment means that the segment contains bytes which cannot be decoded as an entry.
+	ProblemCorruptSegment ProblemKind = "corrupt-segment"
+	// ProblemTimeNotIncreasing means that the entry time is not after the time of the previous entry.
+	ProblemTimeNotIncreasing ProblemKind = "time-not-increasing"
+	// ProblemSegmentNameMismatch means that the first entry in a segment was written before the segment start time
+	// encoded in the segment filename.
+	ProblemSegmentNameMismatch ProblemKind = "segment-name-mismatch"
+)
+
+type Problem struct {
+	Kind    ProblemKind
+	Segment Segment
+	// Offset is a position of the problematic entry in the segment file
+	Offset      int64
+	Description string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: segment %s at offset %d: %s",
+		p.Kind, p.Segment.StartingAt.Format(time.RFC3339Nano), p.Offset, p.Description)
+}
+
+type VerifyReport struct {
+	SegmentsChecked int
+	EntriesChecked  int
+	Problems        []Problem
+}
+
+func (r VerifyReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Verify checks that every entry can be decoded, entry times strictly increase across segments and segment
+// filenames match their first entries. Verify does not lock the log, so when the Writer is writing an entry
+// at the same time, the last segment can be reported as having a torn tail.
+func (l *Log) Verify() (VerifyReport, error) {
+	segments, err := l.Segments()
+	if err != nil {
+		return VerifyReport{}, fmt.Errorf("listing segments failed: %w", err)
+	}
+
+	report := VerifyReport{}
+
+	var lastTime time.Time
+
+	for _, segment := range segments {
+		if lastTime, err = l.verifySegment(segment, lastTime, &report); err != nil {
+			return report, err
+		}
+
+		report.SegmentsChecked++
+	}
+
+	return report, nil
+}
+
+func (l *Log) verifySegment(segment Segment, lastTime time.Time, report *VerifyReport) (time.Time, error) {
+	file, err := openSegmentFileForRead(l.dir, segment)
+	if errors.Is(err, os.ErrNotExist) {
+		// segment was removed after listing
+		return lastTime, nil
+	}
+
+	if err != nil {
+		return lastTime, err
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	problem, err := scanSegment(file, segment, func(offset int64, e logEntry) {
+		t := e.time
+
+		if offset == 0 && t.Before(segment.StartingAt) {
+			report.Problems = append(report.Problems, Problem{
+				Kind:        ProblemSegmentNameMismatch,
+				Segment:     segment,
+				Offset:      offset,
+				Description: fmt.Sprintf("first entry time %s is before segment start", t.Format(time.RFC3339Nano)),
+			})
+		}
+
+		if !lastTime.IsZero() && !t.After(lastTime) {
+			report.Problems = append(report.Problems, Problem{
+				Kind:    ProblemTimeNotIncreasing,
+				Segment: segment,
+				Offset:  offset,
+				Description: fmt.Sprintf("entry time %s is not after previous entry time %s",
+					t.Format(time.RFC3339Nano), lastTime.Format(time.RFC3339Nano)),
+			})
+		} else {
+			lastTime = t
+		}
+
+		report.EntriesChecked++
+	})
+	if err != nil {
+		return lastTime, err
+	}
+
+	if problem != nil {
+		report.Problems = append(report.Problems, *problem)
+	}
+
+	return lastTime, nil
+}
+
+// scanSegment calls f for each entry of the segment file. Only bytes present when scanning started are read.
+// ProblemTornTail or ProblemCorruptSegment is returned when the rest of the file cannot be decoded.
+func scanSegment(file *os.File, segment Segment, f func(offset int64, e logEntry)) (*Problem, error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat failed for file %s: %w", file.Name(), err)
+	}
+
+	size := stat.Size()
+	reader := bufio.NewReader(io.NewSectionReader(file, 0, size))
+
+	var (
+		offset   int64
+		lastTime time.Time
+	)
+
+	for {
+		e, err := decodeLogEntryUpTo(reader, size-offset)
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+
+		if err != nil {
+			kind := ProblemCorruptSegment
+			if errors.Is(err, io.ErrUnexpectedEOF) && !entryFollows(file, offset, size, lastTime) {
+				kind = ProblemTornTail
+			}
+
+			return &Problem{Kind: kind, Segment: segment, Offset: offset, Description: err.Error()}, nil
+		}
+
+		f(offset, e)
+
+		if e.time.After(lastTime) {
+			lastTime = e.time
+		}
+
+		offset += e.size()
+	}
+}
+
+// entryFollows returns true when a complete entry written after given time starts after the offset. Such entry
+// means that the entry at the offset is not a torn tail, but has corrupted length, and truncating the segment
+// would remove valid entries.
+func entryFollows(file *os.File, offset, size int64, after time.Time) bool {
+	reader := bufio.NewReader(io.NewSectionReader(file, offset+1, size-offset-1))
+
+	for position := offset + 1; position < size; position++ {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return false
+		}
+
+		// entries start with the stream marker or time.MarshalBinary version (1 or 2)
+		if b != streamEntryMarker && b != 1 && b != 2 {
+			continue
+		}
+
+		remaining := size - position
+
+		e, err := decodeLogEntryUpTo(bufio.NewReader(io.NewSectionReader(file, position, remaining)), remaining)
+		if err == nil && e.time.After(after) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// QuarantineDir is a directory inside the log directory, where Repair moves unreadable segments.
+const QuarantineDir = "quarantine"
+
+type RepairReport struct {
+	// Verify contains problems found before the repair
+	Verify              VerifyReport
+	TruncatedSegments   []Segment
+	QuarantinedSegments []Segment
+}
+
+// Repair truncates torn tails and moves corrupt segments to QuarantineDir. Other problems reported by Verify
+// are not repaired, because Reader can deal with them. Repair locks the log, therefore ErrLocked is returned when
+// the log is already locked for writing.
+func (l *Log) Repair() (RepairReport, error) {
+	lock, err := tryLock(l.dir)
+	if err != nil {
+		return RepairReport{}, err
+	}
+
+	defer func() {
+		_ = lock.Unlock()
+	}()
+
+	verifyReport, err := l.Verify()
+	if err != nil {
+		return RepairReport{}, err
+	}
+
+	report := RepairReport{Verify: verifyReport}
+
+	for _, problem := range verifyReport.Problems {
+		filename := path.Join(l.dir, segmentFilenameStartingAt(problem.Segment.StartingAt))
+
+		switch problem.Kind {
+		case ProblemTornTail:
+			if err = truncateFile(filename, problem.Offset); err != nil {
+				return report, err
+			}
+
+			if err = repairStreamIndex(l.dir, problem.Segment.StartingAt); err != nil {
+				return report, err
+			}
+
+			report.TruncatedSegments = append(report.TruncatedSegments, problem.Segment)
+		case ProblemCorruptSegment:
+			if err = l.quarantineSegment(filename); err != nil {
+				return report, err
+			}
+
+			if err = removeStreamIndex(l.dir, problem.Segment.StartingAt); err != nil {
+				return report, err
+			}
+
+			report.QuarantinedSegments = append(report.QuarantinedSegments, problem.Segment)
+		case ProblemTimeNotIncreasing, ProblemSegmentNameMismatch:
+		}
+	}
+
+	fsutil.SyncDir(l.dir)
+
+	return report, nil
+}
+
+func (l *Log) quarantineSegment(filename string) error {
+	quarantineDir := path.Join(l.dir, QuarantineDir)
+	if err := mkdirIfMissing(quarantineDir); err != nil {
+		return err
+	}
+
+	if err := os.Rename(filename, path.Join(quarantineDir, path.Base(filename))); err != nil {
+		return fmt.Errorf("moving file %s to quarantine failed: %w", filename, err)
+	}
+
+	fsutil.SyncDir(quarantineDir)
+
+	return nil
+}
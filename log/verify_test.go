@@ -0,0 +1,225 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package log_test
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/elgopher/logstore/internal/tests"
+	"github.com/elgopher/logstore/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLog_Verify(t *testing.T) {
+	t.Run("should not report problems for valid log", func(t *testing.T) {
+		l := writeThreeSegments(t)
+		// when
+		report, err := l.Verify()
+		// then
+		require.NoError(t, err)
+		assert.True(t, report.OK())
+		assert.Equal(t, 3, report.SegmentsChecked)
+		assert.Equal(t, 3, report.EntriesChecked)
+	})
+
+	t.Run("should report torn tail", func(t *testing.T) {
+		l := writeThreeSegments(t)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		appendToSegment(t, l, segments[0], []byte{1, 0, 0})
+		// when
+		report, err := l.Verify()
+		// then
+		require.NoError(t, err)
+		require.Len(t, report.Problems, 1)
+		assert.Equal(t, log.ProblemTornTail, report.Problems[0].Kind)
+		assert.Equal(t, segments[0].StartingAt, report.Problems[0].Segment.StartingAt)
+		assert.Equal(t, segments[0].SizeBytes, report.Problems[0].Offset)
+	})
+
+	t.Run("should report corrupt segment", func(t *testing.T) {
+		l := writeThreeSegments(t)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		corruptSegment(t, l, segments[1])
+		// when
+		report, err := l.Verify()
+		// then
+		require.NoError(t, err)
+		require.Len(t, report.Problems, 1)
+		assert.Equal(t, log.ProblemCorruptSegment, report.Problems[0].Kind)
+		assert.Zero(t, report.Problems[0].Offset)
+	})
+
+	t.Run("should report corrupt segment when entry length in the middle of segment is corrupted", func(t *testing.T) {
+		l := writeThreeSegments(t)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		corruptFirstEntryLength(t, l, segments[0])
+		// when
+		report, err := l.Verify()
+		// then
+		require.NoError(t, err)
+		require.Len(t, report.Problems, 1)
+		assert.Equal(t, log.ProblemCorruptSegment, report.Problems[0].Kind)
+		assert.Zero(t, report.Problems[0].Offset)
+	})
+
+	t.Run("should report time not increasing across segments", func(t *testing.T) {
+		l := writeThreeSegments(t)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		copySegment(t, l, segments[0], segments[2])
+		// when
+		report, err := l.Verify()
+		// then
+		require.NoError(t, err)
+		kinds := problemKinds(report)
+		assert.Contains(t, kinds, log.ProblemTimeNotIncreasing)
+		assert.Contains(t, kinds, log.ProblemSegmentNameMismatch)
+	})
+}
+
+func TestLog_Repair(t *testing.T) {
+	t.Run("should truncate torn tail", func(t *testing.T) {
+		l := writeThreeSegments(t)
+		entriesBefore := tests.ReadAll(t, l)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		appendToSegment(t, l, segments[0], []byte{1, 0, 0})
+		// when
+		report, err := l.Repair()
+		// then
+		require.NoError(t, err)
+		require.Len(t, report.TruncatedSegments, 1)
+		assert.Equal(t, segments[0].StartingAt, report.TruncatedSegments[0].StartingAt)
+		verifyReport, err := l.Verify()
+		require.NoError(t, err)
+		assert.True(t, verifyReport.OK())
+		assert.Equal(t, entriesBefore, tests.ReadAll(t, l))
+	})
+
+	t.Run("should quarantine corrupt segment", func(t *testing.T) {
+		l := writeThreeSegments(t)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		corruptSegment(t, l, segments[1])
+		// when
+		report, err := l.Repair()
+		// then
+		require.NoError(t, err)
+		require.Len(t, report.QuarantinedSegments, 1)
+		assert.Equal(t, segments[1].StartingAt, report.QuarantinedSegments[0].StartingAt)
+		segmentsAfter, err := l.Segments()
+		require.NoError(t, err)
+		assert.Len(t, segmentsAfter, 2)
+		assert.FileExists(t, path.Join(l.Dir(), log.QuarantineDir, segmentFilename(segments[1])))
+	})
+
+	t.Run("should not truncate entries after corrupted entry length", func(t *testing.T) {
+		l := writeThreeSegments(t)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		corruptFirstEntryLength(t, l, segments[0])
+		// when
+		report, err := l.Repair()
+		// then
+		require.NoError(t, err)
+		assert.Empty(t, report.TruncatedSegments)
+		require.Len(t, report.QuarantinedSegments, 1)
+		assert.FileExists(t, path.Join(l.Dir(), log.QuarantineDir, segmentFilename(segments[0])))
+	})
+
+	t.Run("should allow writing after repair", func(t *testing.T) {
+		l := writeThreeSegments(t)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		appendToSegment(t, l, segments[2], []byte{1, 0, 0})
+		_, err = l.Repair()
+		require.NoError(t, err)
+		writer, err := l.OpenWriter()
+		require.NoError(t, err)
+		defer tests.Close(t, writer)
+		// when
+		err = writer.WriteWithTime(time2006.Add(time.Hour), data1)
+		// then
+		require.NoError(t, err)
+		assert.Len(t, tests.ReadAll(t, l), 4)
+	})
+
+	t.Run("should return error when log is locked", func(t *testing.T) {
+		l, _ := tests.OpenLogWithWriter(t)
+		_, err := l.Repair()
+		assert.ErrorIs(t, err, log.ErrLocked)
+	})
+}
+
+// writeThreeSegments writes 3 entries. First segment contains 2 entries, second one entry and the last one is empty.
+func writeThreeSegments(t *testing.T) *log.Log {
+	t.Helper()
+
+	l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentDuration(time.Minute))
+	require.NoError(t, writer.WriteWithTime(time2005, data1))
+	require.NoError(t, writer.WriteWithTime(time2005.Add(time.Hour), data2))
+	require.NoError(t, writer.WriteWithTime(time2006, data2))
+	require.NoError(t, writer.Close())
+
+	return l
+}
+
+func segmentFilename(segment log.Segment) string {
+	return segment.StartingAt.UTC().Format("2006-01-02T15_04_05.000000000Z") + ".segment"
+}
+
+func appendToSegment(t *testing.T, l *log.Log, segment log.Segment, data []byte) {
+	t.Helper()
+
+	f, err := os.OpenFile(path.Join(l.Dir(), segmentFilename(segment)), os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
+
+func corruptSegment(t *testing.T, l *log.Log, segment log.Segment) {
+	t.Helper()
+
+	f, err := os.OpenFile(path.Join(l.Dir(), segmentFilename(segment)), os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte{0xFF}, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
+
+// corruptFirstEntryLength sets the data length of the first entry to a value much bigger than the segment.
+func corruptFirstEntryLength(t *testing.T, l *log.Log, segment log.Segment) {
+	t.Helper()
+
+	f, err := os.OpenFile(path.Join(l.Dir(), segmentFilename(segment)), os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte{0xF0, 0xFF, 0xFF, 0xFF}, 15) // length is written after 15 bytes of time
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
+
+func copySegment(t *testing.T, l *log.Log, src, dst log.Segment) {
+	t.Helper()
+
+	data, err := os.ReadFile(path.Join(l.Dir(), segmentFilename(src)))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path.Join(l.Dir(), segmentFilename(dst)), data, 0600))
+}
+
+func problemKinds(report log.VerifyReport) []log.ProblemKind {
+	var kinds []log.ProblemKind
+	for _, problem := range report.Problems {
+		kinds = append(kinds, problem.Kind)
+	}
+
+	return kinds
+}
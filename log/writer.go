@@ -4,6 +4,7 @@
 package log
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path"
@@ -27,16 +28,37 @@ func (l *Log) openWriter(options []OpenWriterOption) (*Writer, error) {
 		return nil, err
 	}
 
+	// mirrors are opened first, because the log directory can be restored from the mirror
+	mirrors, err := openMirrors(l.dir, settings.mirrors)
+	if err != nil {
+		_ = lock.Unlock()
+
+		return nil, err
+	}
+
 	lastTime, err := l.readLastTime()
 	if err != nil {
+		closeMirrors(mirrors)
+		_ = lock.Unlock()
+
 		return nil, err
 	}
 
 	currentSegment, err := l.openLastUsedSegmentWriter()
 	if err != nil {
+		closeMirrors(mirrors)
+		_ = lock.Unlock()
+
 		return nil, err
 	}
 
+	mirrorQuorum := settings.mirrorQuorum
+	if mirrorQuorum < 0 {
+		mirrorQuorum = len(mirrors)
+	}
+
+	l.reportSegments(settings.observer)
+
 	return &Writer{
 		currentSegment:      currentSegment,
 		now:                 settings.now,
@@ -45,14 +67,24 @@ func (l *Log) openWriter(options []OpenWriterOption) (*Writer, error) {
 		maxSegmentDuration:  settings.maxSegmentDuration,
 		lock:                lock,
 		dir:                 l.dir,
+		mirrors:             mirrors,
+		mirrorQuorum:        mirrorQuorum,
+		observer:            settings.observer,
+		streamVersions:      map[string]uint64{},
 	}, nil
 }
 
+// maxCachedStreamVersions limits memory used by the Writer when writing to many streams. Versions evicted
+// from the cache are read again from stream indexes.
+const maxCachedStreamVersions = 10000
+
 func (l *Log) writerSettings(options []OpenWriterOption) (*WriterSettings, error) {
 	settings := &WriterSettings{
 		now:                 time.Now,
 		maxSegmentSizeBytes: oneGigabyte,
 		maxSegmentDuration:  oneMonth,
+		mirrorQuorum:        -1,
+		observer:            nopObserver{},
 	}
 
 	for _, applyOption := range options {
@@ -65,6 +97,16 @@ func (l *Log) writerSettings(options []OpenWriterOption) (*WriterSettings, error
 		}
 	}
 
+	if settings.mirrorQuorum > len(settings.mirrors) {
+		return nil, fmt.Errorf("mirror quorum is greater than number of mirrors: %w", ErrInvalidParameter)
+	}
+
+	for _, mirrorDir := range settings.mirrors {
+		if path.Clean(mirrorDir) == path.Clean(l.dir) {
+			return nil, fmt.Errorf("mirror cannot be the log directory: %w", ErrInvalidParameter)
+		}
+	}
+
 	return settings, nil
 }
 
@@ -112,9 +154,16 @@ type Writer struct {
 	lastTime            time.Time
 	lock                *flock.Flock
 	dir                 string
+	mirrors             []*mirror
+	mirrorQuorum        int
+	observer            WriterObserver
+	// streamVersions caches versions of recently written streams. At most maxCachedStreamVersions are cached.
+	streamVersions map[string]uint64
 }
 
 func (w *Writer) Close() error {
+	closeMirrors(w.mirrors)
+
 	if err := w.lock.Unlock(); err != nil {
 		_ = w.currentSegment.close()
 
@@ -129,13 +178,19 @@ func (w *Writer) Close() error {
 }
 
 func (w *Writer) Write(entry []byte) (time.Time, error) {
+	t := w.nextTime()
+
+	return t, w.WriteWithTime(t, entry)
+}
+
+func (w *Writer) nextTime() time.Time {
 	t := w.now()
 
 	if !t.After(w.lastTime) {
 		t = w.lastTime.Add(time.Nanosecond)
 	}
 
-	return t, w.WriteWithTime(t, entry)
+	return t
 }
 
 func (w *Writer) WriteWithTime(t time.Time, entry []byte) error {
@@ -143,16 +198,108 @@ func (w *Writer) WriteWithTime(t time.Time, entry []byte) error {
 		return fmt.Errorf("forced time is not after last entry time: %w", ErrInvalidParameter)
 	}
 
-	if err := w.writeEntry(t, entry); err != nil {
+	return w.write(logEntry{time: t, data: entry})
+}
+
+// WriteToStream writes entry to the stream. Stream is a logical sequence of entries within the log, for example
+// all events of one aggregate. Entries written to the stream get consecutive versions, starting from 1. Use ForStream
+// option to read them.
+func (w *Writer) WriteToStream(stream string, entry []byte) (time.Time, uint64, error) {
+	version, err := w.StreamVersion(stream)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	t := w.nextTime()
+	version++
+
+	return t, version, w.writeToStream(logEntry{time: t, data: entry, stream: stream, version: version})
+}
+
+// WriteToStreamWithTime writes entry to the stream, forcing its time and version. Version must be greater than
+// the current version of the stream. It is used to copy stream entries from another log, for example by Import.
+func (w *Writer) WriteToStreamWithTime(t time.Time, stream string, version uint64, entry []byte) error {
+	if !t.After(w.lastTime) {
+		return fmt.Errorf("forced time is not after last entry time: %w", ErrInvalidParameter)
+	}
+
+	currentVersion, err := w.StreamVersion(stream)
+	if err != nil {
+		return err
+	}
+
+	if version <= currentVersion {
+		return fmt.Errorf("version %d is not greater than current version %d of stream %q: %w",
+			version, currentVersion, stream, ErrInvalidParameter)
+	}
+
+	return w.writeToStream(logEntry{time: t, data: entry, stream: stream, version: version})
+}
+
+func (w *Writer) writeToStream(e logEntry) error {
+	err := w.write(e)
+	if err != nil && !errors.Is(err, ErrMirrorQuorum) {
 		return err
 	}
 
-	w.lastTime = t
+	w.cacheStreamVersion(e.stream, e.version)
 
-	return nil
+	return err
+}
+
+// StreamVersion returns the version of the last entry written to the stream. 0 is returned when the stream
+// has no entries. Versions of recently written streams are cached by the Writer.
+func (w *Writer) StreamVersion(stream string) (uint64, error) {
+	if err := validateStream(stream); err != nil {
+		return 0, err
+	}
+
+	if version, ok := w.streamVersions[stream]; ok {
+		return version, nil
+	}
+
+	version, err := New(w.dir).StreamVersion(stream)
+	if err != nil {
+		return 0, err
+	}
+
+	w.cacheStreamVersion(stream, version)
+
+	return version, nil
 }
 
-func (w *Writer) writeEntry(t time.Time, entry []byte) error {
+func (w *Writer) cacheStreamVersion(stream string, version uint64) {
+	if _, ok := w.streamVersions[stream]; !ok && len(w.streamVersions) >= maxCachedStreamVersions {
+		// evict random stream
+		for s := range w.streamVersions {
+			delete(w.streamVersions, s)
+
+			break
+		}
+	}
+
+	w.streamVersions[stream] = version
+}
+
+func (w *Writer) write(e logEntry) error {
+	started := time.Now()
+
+	err := w.writeEntry(e)
+	if err != nil && !errors.Is(err, ErrMirrorQuorum) {
+		return err
+	}
+
+	// entry was written to the log directory, even if it was not written to the mirrors. Therefore, it must not
+	// be written again when ErrMirrorQuorum is returned.
+	w.lastTime = e.time
+	w.observer.EntryWritten(len(e.data), time.Since(started))
+
+	return err
+}
+
+func (w *Writer) writeEntry(e logEntry) error {
+	t := e.time
+
 	if w.currentSegment == nil {
 		var err error
 
@@ -162,10 +309,12 @@ func (w *Writer) writeEntry(t time.Time, entry []byte) error {
 		}
 	}
 
-	if err := encodeEntry(w.currentSegment, t, entry); err != nil {
+	if err := w.currentSegment.writeEntry(e); err != nil {
 		return err
 	}
 
+	mirrorErr := w.writeMirrors(e)
+
 	if w.currentSegment.maxSizeExceeded(w.maxSegmentSizeBytes) ||
 		w.currentSegment.maxDurationExceeded(t, w.maxSegmentDuration) {
 		if err := w.rollOver(t.Add(time.Nanosecond)); err != nil {
@@ -173,10 +322,67 @@ func (w *Writer) writeEntry(t time.Time, entry []byte) error {
 		}
 	}
 
+	return mirrorErr
+}
+
+// writeMirrors writes entry to all healthy mirrors. Entry is acknowledged once the quorum of mirrors
+// has it durably stored.
+func (w *Writer) writeMirrors(e logEntry) error {
+	if len(w.mirrors) == 0 {
+		return nil
+	}
+
+	if err := w.Sync(); err != nil {
+		return err
+	}
+
+	written := 0
+
+	var lastErr error
+
+	for _, m := range w.mirrors {
+		if m.failed {
+			continue
+		}
+
+		if err := m.write(e); err != nil {
+			m.failed = true
+			lastErr = err
+
+			continue
+		}
+
+		written++
+	}
+
+	if written < w.mirrorQuorum {
+		return fmt.Errorf("entry written to %d mirrors, but %d required (last error: %v): %w",
+			written, w.mirrorQuorum, lastErr, ErrMirrorQuorum)
+	}
+
+	return nil
+}
+
+// Sync commits the current segment file to stable storage.
+func (w *Writer) Sync() error {
+	if w.currentSegment == nil {
+		return nil
+	}
+
+	started := time.Now()
+
+	if err := w.currentSegment.file.Sync(); err != nil {
+		return fmt.Errorf("syncing segment failed: %w", err)
+	}
+
+	w.observer.Synced(time.Since(started))
+
 	return nil
 }
 
 func (w *Writer) rollOver(start time.Time) error {
+	w.currentSegment.sealStreamIndex()
+
 	if err := w.currentSegment.close(); err != nil {
 		return fmt.Errorf("error closing segment file: %w", err)
 	}
@@ -194,5 +400,76 @@ func (w *Writer) rollOver(start time.Time) error {
 		startTime: start,
 	}
 
+	for _, m := range w.mirrors {
+		if !m.failed && m.rollOver(start) != nil {
+			m.failed = true
+		}
+	}
+
+	w.compactMirrors()
+
+	w.observer.RolledOver()
+	New(w.dir).reportSegments(w.observer)
+
+	return nil
+}
+
+// compactMirrors removes mirror segments older than the oldest segment in the log directory, so compaction of the log
+// (usually done by another process) frees space in mirrors too. Other differences, for example merged segments,
+// are fixed when the Writer is opened again.
+func (w *Writer) compactMirrors() {
+	if len(w.mirrors) == 0 {
+		return
+	}
+
+	segments, err := New(w.dir).Segments()
+	if err != nil || len(segments) == 0 {
+		return
+	}
+
+	for _, m := range w.mirrors {
+		if !m.failed && m.removeSegmentsBefore(segments[0].StartingAt) != nil {
+			m.failed = true
+		}
+	}
+}
+
+// TruncateAfter removes all entries written after t. Segment containing t is truncated, newer segments are removed.
+func (w *Writer) TruncateAfter(t time.Time) error {
+	if err := w.currentSegment.close(); err != nil {
+		return fmt.Errorf("closing current segment failed: %w", err)
+	}
+
+	w.currentSegment = nil
+	w.streamVersions = map[string]uint64{}
+
+	if err := truncateSegmentsAfter(w.dir, t); err != nil {
+		return err
+	}
+
+	for _, m := range w.mirrors {
+		if m.failed {
+			continue
+		}
+
+		if err := m.truncateAfter(t); err != nil {
+			m.failed = true
+		}
+	}
+
+	l := New(w.dir)
+
+	lastTime, err := l.readLastTime()
+	if err != nil {
+		return err
+	}
+
+	w.lastTime = lastTime
+
+	w.currentSegment, err = l.openLastUsedSegmentWriter()
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
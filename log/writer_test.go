@@ -4,6 +4,7 @@
 package log_test
 
 import (
+	"os"
 	"testing"
 	"time"
 
@@ -217,3 +218,255 @@ func TestWriter_Write(t *testing.T) {
 		assert.True(t, actualTime2.After(actualTime1))
 	})
 }
+
+func TestWriter_TruncateAfter(t *testing.T) {
+	t.Run("should remove entries written after given time", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		t1 := time2005
+		t2 := time2005.Add(time.Hour)
+		require.NoError(t, writer.WriteWithTime(t1, data1))
+		require.NoError(t, writer.WriteWithTime(t2, data2))
+		// when
+		err := writer.TruncateAfter(t1)
+		// then
+		require.NoError(t, err)
+		entries := tests.ReadAll(t, l)
+		assert.Equal(t, []tests.Entry{{Time: t1, Data: data1}}, entries)
+	})
+
+	t.Run("should remove segments starting after given time", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentSizeMB(1))
+		t1 := tests.WriteEntry(t, writer, tests.OneMegabyte)
+		tests.WriteEntry(t, writer, tests.OneMegabyte)
+		tests.WriteEntry(t, writer, tests.OneMegabyte)
+		// when
+		err := writer.TruncateAfter(t1)
+		// then
+		require.NoError(t, err)
+		entries := tests.ReadAll(t, l)
+		require.Len(t, entries, 1)
+		assert.True(t, t1.Equal(entries[0].Time))
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		assert.Len(t, segments, 1)
+	})
+
+	t.Run("should remove all entries when given time is before the first entry", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		require.NoError(t, writer.WriteWithTime(time2006, data1))
+		// when
+		err := writer.TruncateAfter(time2005)
+		// then
+		require.NoError(t, err)
+		assert.Empty(t, tests.ReadAll(t, l))
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		assert.Empty(t, segments)
+	})
+
+	t.Run("should allow writing entries after given time once again", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		t1 := time2005
+		t2 := time2006
+		require.NoError(t, writer.WriteWithTime(t1, data1))
+		require.NoError(t, writer.WriteWithTime(t2, data1))
+		require.NoError(t, writer.TruncateAfter(t1))
+		// when
+		err := writer.WriteWithTime(t2, data2)
+		// then
+		require.NoError(t, err)
+		entries := tests.ReadAll(t, l)
+		assert.Equal(t,
+			[]tests.Entry{
+				{Time: t1, Data: data1},
+				{Time: t2, Data: data2},
+			},
+			entries)
+	})
+
+	t.Run("should not allow writing entries before remaining last entry", func(t *testing.T) {
+		_, writer := tests.OpenLogWithWriter(t)
+		t1 := time2006
+		require.NoError(t, writer.WriteWithTime(t1, data1))
+		require.NoError(t, writer.WriteWithTime(t1.Add(time.Hour), data1))
+		require.NoError(t, writer.TruncateAfter(t1))
+		// when
+		err := writer.WriteWithTime(t1, data2)
+		// then
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+}
+
+func TestWriter_Mirrors(t *testing.T) {
+	t.Run("should write entries to mirror", func(t *testing.T) {
+		mirrorDir := tests.TempDir(t)
+		l, writer := tests.OpenLogWithWriter(t, log.Mirrors(mirrorDir), log.MaxSegmentSizeMB(1))
+		// when
+		tests.WriteEntry(t, writer, tests.OneMegabyte)
+		tests.WriteEntry(t, writer, 10)
+		// then
+		mirror := log.New(mirrorDir)
+		assert.Equal(t, tests.ReadAll(t, l), tests.ReadAll(t, mirror))
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		mirrorSegments, err := mirror.Segments()
+		require.NoError(t, err)
+		assert.Equal(t, segments, mirrorSegments)
+	})
+
+	t.Run("should resync lagging mirror on open", func(t *testing.T) {
+		mirrorDir := tests.TempDir(t)
+		l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentSizeMB(1))
+		tests.WriteEntry(t, writer, tests.OneMegabyte)
+		tests.WriteEntry(t, writer, 10)
+		require.NoError(t, writer.Close())
+		// when
+		writer, err := l.OpenWriter(log.Mirrors(mirrorDir))
+		require.NoError(t, err)
+		defer tests.Close(t, writer)
+		require.NoError(t, writer.WriteWithTime(time.Now(), data1))
+		// then
+		assert.Equal(t, tests.ReadAll(t, l), tests.ReadAll(t, log.New(mirrorDir)))
+	})
+
+	t.Run("should remove mirror segments missing in the log", func(t *testing.T) {
+		mirrorDir := tests.TempDir(t)
+		l, writer := tests.OpenLogWithWriter(t, log.Mirrors(mirrorDir), log.MaxSegmentDuration(time.Minute))
+		require.NoError(t, writer.WriteWithTime(time2005, data1))
+		require.NoError(t, writer.WriteWithTime(time2006, data2))
+		require.NoError(t, writer.Close())
+		require.NoError(t, l.RemoveSegmentStartingAt(time2005))
+		// when
+		writer, err := l.OpenWriter(log.Mirrors(mirrorDir))
+		require.NoError(t, err)
+		defer tests.Close(t, writer)
+		// then
+		assert.Equal(t, tests.ReadAll(t, l), tests.ReadAll(t, log.New(mirrorDir)))
+	})
+
+	t.Run("should restore empty log from the mirror", func(t *testing.T) {
+		mirrorDir := tests.TempDir(t)
+		mirrorWriter, err := log.New(mirrorDir).OpenWriter()
+		require.NoError(t, err)
+		require.NoError(t, mirrorWriter.WriteWithTime(time2005, data1))
+		require.NoError(t, mirrorWriter.Close())
+		// when
+		l, writer := tests.OpenLogWithWriter(t, log.Mirrors(mirrorDir))
+		require.NoError(t, writer.WriteWithTime(time2006, data2))
+		// then
+		expected := []tests.Entry{{Time: time2005, Data: data1}, {Time: time2006, Data: data2}}
+		assert.Equal(t, expected, tests.ReadAll(t, l))
+		assert.Equal(t, expected, tests.ReadAll(t, log.New(mirrorDir)))
+	})
+
+	t.Run("should not resync mirror with segments newer than the log", func(t *testing.T) {
+		mirrorDir := tests.TempDir(t)
+		mirrorWriter, err := log.New(mirrorDir).OpenWriter()
+		require.NoError(t, err)
+		require.NoError(t, mirrorWriter.WriteWithTime(time2006, data2))
+		require.NoError(t, mirrorWriter.Close())
+		l, writer := tests.OpenLogWithWriter(t)
+		require.NoError(t, writer.WriteWithTime(time2005, data1))
+		require.NoError(t, writer.Close())
+		// when
+		_, err = l.OpenWriter(log.Mirrors(mirrorDir))
+		// then
+		require.ErrorIs(t, err, log.ErrMirrorDiverged)
+		assert.Equal(t, []tests.Entry{{Time: time2006, Data: data2}}, tests.ReadAll(t, log.New(mirrorDir)))
+		// log can still be opened without mirror
+		writer, err = l.OpenWriter()
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+	})
+
+	t.Run("should lock the mirror", func(t *testing.T) {
+		mirrorDir := tests.TempDir(t)
+		tests.OpenLogWriter(t, log.Mirrors(mirrorDir))
+		// when
+		_, err := log.New(mirrorDir).OpenWriter()
+		// then
+		assert.ErrorIs(t, err, log.ErrLocked)
+	})
+
+	t.Run("should truncate mirror", func(t *testing.T) {
+		mirrorDir := tests.TempDir(t)
+		l, writer := tests.OpenLogWithWriter(t, log.Mirrors(mirrorDir))
+		require.NoError(t, writer.WriteWithTime(time2005, data1))
+		require.NoError(t, writer.WriteWithTime(time2006, data2))
+		// when
+		require.NoError(t, writer.TruncateAfter(time2005))
+		// then
+		require.NoError(t, writer.WriteWithTime(time2006, data1))
+		assert.Equal(t, tests.ReadAll(t, l), tests.ReadAll(t, log.New(mirrorDir)))
+	})
+
+	t.Run("should write entry to the log when mirror quorum is not reached", func(t *testing.T) {
+		mirrorDir := tests.TempDir(t)
+		l, writer := tests.OpenLogWithWriter(t, log.Mirrors(mirrorDir), log.MaxSegmentDuration(time.Minute))
+		require.NoError(t, writer.WriteWithTime(time2005, data1))
+		require.NoError(t, os.RemoveAll(mirrorDir))
+		require.NoError(t, writer.WriteWithTime(time2006, data1)) // mirror fails when rolling over
+		// when
+		err := writer.WriteWithTime(time2006.Add(time.Hour), data2)
+		// then
+		require.ErrorIs(t, err, log.ErrMirrorQuorum)
+		entries := tests.ReadAll(t, l)
+		assert.Equal(t, tests.Entry{Time: time2006.Add(time.Hour), Data: data2}, entries[len(entries)-1])
+		// entry must not be written again
+		assert.ErrorIs(t, writer.WriteWithTime(time2006.Add(time.Hour), data2), log.ErrInvalidParameter)
+	})
+
+	t.Run("should remove mirror segments compacted while the writer is open", func(t *testing.T) {
+		mirrorDir := tests.TempDir(t)
+		l, writer := tests.OpenLogWithWriter(t, log.Mirrors(mirrorDir), log.MaxSegmentDuration(time.Minute))
+		require.NoError(t, writer.WriteWithTime(time2005, data1))
+		require.NoError(t, writer.WriteWithTime(time2006, data2))
+		require.NoError(t, l.RemoveSegmentStartingAt(time2005))
+		// when
+		require.NoError(t, writer.WriteWithTime(time2006.Add(time.Hour), data1)) // rolls over
+		// then
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		mirrorSegments, err := log.New(mirrorDir).Segments()
+		require.NoError(t, err)
+		assert.Equal(t, segments, mirrorSegments)
+	})
+
+	t.Run("should return error when mirror is the log directory", func(t *testing.T) {
+		l := log.New(tests.TempDir(t))
+		_, err := l.OpenWriter(log.Mirrors(l.Dir()))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error when quorum is greater than number of mirrors", func(t *testing.T) {
+		l := log.New(tests.TempDir(t))
+		_, err := l.OpenWriter(log.Mirrors(tests.TempDir(t)), log.MirrorQuorum(2))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error for negative quorum", func(t *testing.T) {
+		l := log.New(tests.TempDir(t))
+		_, err := l.OpenWriter(log.MirrorQuorum(-1))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+}
+
+func TestObserveWriter(t *testing.T) {
+	t.Run("should return error for nil observer", func(t *testing.T) {
+		_, err := log.New(tests.TempDir(t)).OpenWriter(log.ObserveWriter(nil))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+}
+
+func TestWriter_Sync(t *testing.T) {
+	t.Run("should sync empty log", func(t *testing.T) {
+		writer := tests.OpenLogWriter(t)
+		assert.NoError(t, writer.Sync())
+	})
+
+	t.Run("should sync written entry", func(t *testing.T) {
+		writer := tests.OpenLogWriter(t)
+		require.NoError(t, writer.WriteWithTime(time2005, data1))
+		assert.NoError(t, writer.Sync())
+	})
+}
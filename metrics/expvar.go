@@ -0,0 +1,14 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package metrics
+
+import "expvar"
+
+// PublishExpvar publishes metrics snapshot as expvar variable with given name. Like expvar.Publish,
+// it panics when the name is already registered.
+func (m *Metrics) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return m.Snapshot()
+	}))
+}
@@ -0,0 +1,220 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+// Package metrics collects metrics from log.Writer, log.Reader and compacter.Compacter. Metrics can be published
+// using expvar or exposed in Prometheus text format.
+//
+// Usage:
+//
+//	m := metrics.New()
+//	m.SegmentsOf(l)
+//	writer, err := l.OpenWriter(log.ObserveWriter(m))
+//	reader, err := l.OpenReader(log.ObserveReader(m))
+//	c, err := compacter.New(l, compacter.Observe(m))
+//	http.Handle("/metrics", m.Handler())
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elgopher/logstore/compacter"
+	"github.com/elgopher/logstore/log"
+)
+
+// Metrics implements log.WriterObserver, log.ReaderObserver and compacter.Observer. It is safe for concurrent use.
+// Metrics instance should be used for a single log.
+type Metrics struct {
+	entriesWritten atomic.Int64
+	bytesWritten   atomic.Int64
+	writeLatency   summary
+	syncLatency    summary
+	rollOvers      atomic.Int64
+	segments       atomic.Int64
+	segmentsBytes  atomic.Int64
+
+	entriesRead atomic.Int64
+	bytesRead   atomic.Int64
+	seekLatency summary
+
+	compactions        atomic.Int64
+	compactionErrors   atomic.Int64
+	segmentsRemoved    atomic.Int64
+	segmentsArchived   atomic.Int64
+	segmentsMerged     atomic.Int64
+	entriesRemoved     atomic.Int64
+	bytesFreed         atomic.Int64
+	compactionDuration summary
+
+	mutex         sync.Mutex
+	segmentLister SegmentLister
+}
+
+// SegmentLister lists segments of the log. It is implemented by *log.Log.
+type SegmentLister interface {
+	Segments() ([]log.Segment, error)
+}
+
+var (
+	_ log.WriterObserver = (*Metrics)(nil)
+	_ log.ReaderObserver = (*Metrics)(nil)
+	_ compacter.Observer = (*Metrics)(nil)
+)
+
+func New() *Metrics {
+	return &Metrics{}
+}
+
+// SegmentsOf makes Snapshot list segments of the log, so segments gauges are always up-to-date, no matter
+// whether segments were changed by the Writer, Compacter, or by calling log methods directly. Without it, gauges
+// are updated by the Writer on open and roll over, and by the Compacter.
+func (m *Metrics) SegmentsOf(l SegmentLister) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.segmentLister = l
+}
+
+func (m *Metrics) EntryWritten(dataBytes int, latency time.Duration) {
+	m.entriesWritten.Add(1)
+	m.bytesWritten.Add(int64(dataBytes))
+	m.writeLatency.observe(latency)
+}
+
+func (m *Metrics) Synced(latency time.Duration) {
+	m.syncLatency.observe(latency)
+}
+
+func (m *Metrics) RolledOver() {
+	m.rollOvers.Add(1)
+}
+
+func (m *Metrics) SegmentsChanged(count int, totalBytes int64) {
+	m.segments.Store(int64(count))
+	m.segmentsBytes.Store(totalBytes)
+}
+
+func (m *Metrics) EntryRead(dataBytes int) {
+	m.entriesRead.Add(1)
+	m.bytesRead.Add(int64(dataBytes))
+}
+
+func (m *Metrics) Seeked(latency time.Duration) {
+	m.seekLatency.observe(latency)
+}
+
+func (m *Metrics) Compacted(stats compacter.RunStats) {
+	m.compactions.Add(1)
+	m.compactionDuration.observe(stats.Duration)
+
+	if stats.Err != nil {
+		m.compactionErrors.Add(1)
+	}
+
+	results := stats.Results
+	m.segmentsRemoved.Add(int64(len(results.SegmentsRemoved)))
+	m.segmentsArchived.Add(int64(len(results.SegmentsArchived)))
+	m.segmentsMerged.Add(int64(len(results.SegmentsMerged)))
+	m.entriesRemoved.Add(int64(results.EntriesRemoved))
+	m.bytesFreed.Add(results.BytesFreed)
+
+	// merged segments are not subtracted, because the number of merged groups is unknown. Use SegmentsOf
+	// to always get the exact number.
+	m.segments.Add(-int64(len(results.SegmentsRemoved) + len(results.SegmentsArchived)))
+	m.segmentsBytes.Add(-results.BytesFreed)
+}
+
+// Snapshot is a point-in-time copy of all metrics.
+type Snapshot struct {
+	EntriesWritten int64
+	BytesWritten   int64
+	WriteLatency   SummarySnapshot
+	SyncLatency    SummarySnapshot
+	RollOvers      int64
+	Segments       int64
+	SegmentsBytes  int64
+
+	EntriesRead int64
+	BytesRead   int64
+	SeekLatency SummarySnapshot
+
+	Compactions        int64
+	CompactionErrors   int64
+	SegmentsRemoved    int64
+	SegmentsArchived   int64
+	SegmentsMerged     int64
+	EntriesRemoved     int64
+	BytesFreed         int64
+	CompactionDuration SummarySnapshot
+}
+
+func (m *Metrics) Snapshot() Snapshot {
+	m.refreshSegments()
+
+	return Snapshot{
+		EntriesWritten:     m.entriesWritten.Load(),
+		BytesWritten:       m.bytesWritten.Load(),
+		WriteLatency:       m.writeLatency.snapshot(),
+		SyncLatency:        m.syncLatency.snapshot(),
+		RollOvers:          m.rollOvers.Load(),
+		Segments:           m.segments.Load(),
+		SegmentsBytes:      m.segmentsBytes.Load(),
+		EntriesRead:        m.entriesRead.Load(),
+		BytesRead:          m.bytesRead.Load(),
+		SeekLatency:        m.seekLatency.snapshot(),
+		Compactions:        m.compactions.Load(),
+		CompactionErrors:   m.compactionErrors.Load(),
+		SegmentsRemoved:    m.segmentsRemoved.Load(),
+		SegmentsArchived:   m.segmentsArchived.Load(),
+		SegmentsMerged:     m.segmentsMerged.Load(),
+		EntriesRemoved:     m.entriesRemoved.Load(),
+		BytesFreed:         m.bytesFreed.Load(),
+		CompactionDuration: m.compactionDuration.snapshot(),
+	}
+}
+
+func (m *Metrics) refreshSegments() {
+	m.mutex.Lock()
+	lister := m.segmentLister
+	m.mutex.Unlock()
+
+	if lister == nil {
+		return
+	}
+
+	segments, err := lister.Segments()
+	if err != nil {
+		return // last known values are used
+	}
+
+	var totalBytes int64
+	for _, segment := range segments {
+		totalBytes += segment.SizeBytes
+	}
+
+	m.SegmentsChanged(len(segments), totalBytes)
+}
+
+// summary counts observations and sums their durations.
+type summary struct {
+	count atomic.Int64
+	sum   atomic.Int64
+}
+
+func (s *summary) observe(d time.Duration) {
+	s.count.Add(1)
+	s.sum.Add(int64(d))
+}
+
+func (s *summary) snapshot() SummarySnapshot {
+	return SummarySnapshot{
+		Count: s.count.Load(),
+		Sum:   time.Duration(s.sum.Load()),
+	}
+}
+
+type SummarySnapshot struct {
+	Count int64
+	Sum   time.Duration
+}
@@ -0,0 +1,120 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package metrics_test
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/elgopher/logstore/compacter"
+	"github.com/elgopher/logstore/internal/tests"
+	"github.com/elgopher/logstore/log"
+	"github.com/elgopher/logstore/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var time2005 = tests.MustTime("2005-02-04T20:01:37Z")
+
+func TestMetrics(t *testing.T) {
+	t.Run("should collect writer and reader metrics", func(t *testing.T) {
+		m := metrics.New()
+		l, writer := tests.OpenLogWithWriter(t, log.ObserveWriter(m), log.MaxSegmentDuration(time.Minute))
+		// when
+		require.NoError(t, writer.WriteWithTime(time2005, []byte("123")))
+		require.NoError(t, writer.WriteWithTime(time2005.Add(time.Hour), []byte("45")))
+		require.NoError(t, writer.Sync())
+		tests.ReadAll(t, l, log.ObserveReader(m), log.StartingFrom(time2005))
+		// then
+		s := m.Snapshot()
+		assert.Equal(t, int64(2), s.EntriesWritten)
+		assert.Equal(t, int64(5), s.BytesWritten)
+		assert.Equal(t, int64(2), s.WriteLatency.Count)
+		assert.Equal(t, int64(1), s.SyncLatency.Count)
+		assert.Equal(t, int64(1), s.RollOvers)
+		assert.Equal(t, int64(2), s.Segments)
+		assert.Positive(t, s.SegmentsBytes)
+		assert.Equal(t, int64(2), s.EntriesRead)
+		assert.Equal(t, int64(5), s.BytesRead)
+		assert.Equal(t, int64(1), s.SeekLatency.Count)
+	})
+
+	t.Run("should collect compaction metrics", func(t *testing.T) {
+		m := metrics.New()
+		m.SegmentsChanged(3, 300)
+		// when
+		m.Compacted(compacter.RunStats{
+			Duration: time.Second,
+			Results: compacter.Results{
+				SegmentsRemoved: []log.Segment{{SizeBytes: 100}},
+				BytesFreed:      100,
+			},
+		})
+		// then
+		s := m.Snapshot()
+		assert.Equal(t, int64(1), s.Compactions)
+		assert.Equal(t, int64(1), s.SegmentsRemoved)
+		assert.Equal(t, int64(100), s.BytesFreed)
+		assert.Equal(t, time.Second, s.CompactionDuration.Sum)
+		assert.Equal(t, int64(2), s.Segments)
+		assert.Equal(t, int64(200), s.SegmentsBytes)
+	})
+
+	t.Run("should list segments of the log when taking snapshot", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentDuration(time.Minute))
+		require.NoError(t, writer.WriteWithTime(time2005, []byte("a")))
+		require.NoError(t, writer.WriteWithTime(time2005.Add(time.Hour), []byte("b")))
+		require.NoError(t, writer.WriteWithTime(time2005.Add(2*time.Hour), []byte("c")))
+		m := metrics.New()
+		m.SegmentsOf(l)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		require.NoError(t, l.MergeSegments(segments[0].StartingAt, segments[1].StartingAt))
+		// when
+		s := m.Snapshot()
+		// then
+		assert.Equal(t, int64(len(segments)-1), s.Segments)
+		assert.Positive(t, s.SegmentsBytes)
+	})
+
+	t.Run("should count compaction errors", func(t *testing.T) {
+		m := metrics.New()
+		m.Compacted(compacter.RunStats{Err: tests.ErrFixed})
+		assert.Equal(t, int64(1), m.Snapshot().CompactionErrors)
+	})
+}
+
+func TestMetrics_Handler(t *testing.T) {
+	t.Run("should expose metrics in Prometheus text format", func(t *testing.T) {
+		m := metrics.New()
+		m.EntryWritten(10, 2*time.Second)
+		m.Compacted(compacter.RunStats{Results: compacter.Results{SegmentsMerged: make([]log.Segment, 3)}})
+		recorder := httptest.NewRecorder()
+		// when
+		m.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		// then
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Header().Get("Content-Type"), "text/plain")
+		body := recorder.Body.String()
+		assert.Contains(t, body, "# TYPE logstore_entries_written_total counter\nlogstore_entries_written_total 1\n")
+		assert.Contains(t, body, "logstore_written_bytes_total 10\n")
+		assert.Contains(t, body, "logstore_write_latency_seconds_sum 2\nlogstore_write_latency_seconds_count 1\n")
+		assert.Contains(t, body, `logstore_compacted_segments_total{action="merge"} 3`)
+		assert.Contains(t, body, "# TYPE logstore_segments gauge\n")
+	})
+}
+
+func TestMetrics_PublishExpvar(t *testing.T) {
+	t.Run("should publish snapshot", func(t *testing.T) {
+		m := metrics.New()
+		m.EntryRead(7)
+		// when
+		m.PublishExpvar("logstore_test")
+		// then
+		assert.Contains(t, expvar.Get("logstore_test").String(), `"BytesRead":7`)
+	})
+}
@@ -0,0 +1,68 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Handler returns http.Handler exposing metrics in Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		bufferedWriter := bufio.NewWriter(w)
+		m.WritePrometheus(bufferedWriter)
+		_ = bufferedWriter.Flush()
+	})
+}
+
+// WritePrometheus writes metrics in Prometheus text format.
+func (m *Metrics) WritePrometheus(w io.Writer) {
+	s := m.Snapshot()
+
+	writeCounter(w, "logstore_entries_written_total", "Number of entries written.", s.EntriesWritten)
+	writeCounter(w, "logstore_written_bytes_total", "Number of entry data bytes written.", s.BytesWritten)
+	writeSummary(w, "logstore_write_latency_seconds", "Latency of writing entries.", s.WriteLatency)
+	writeSummary(w, "logstore_sync_latency_seconds", "Latency of syncing segment files.", s.SyncLatency)
+	writeCounter(w, "logstore_rollovers_total", "Number of segment roll overs.", s.RollOvers)
+	writeGauge(w, "logstore_segments", "Number of segments.", s.Segments)
+	writeGauge(w, "logstore_segments_bytes", "Total size of segments in bytes.", s.SegmentsBytes)
+	writeCounter(w, "logstore_entries_read_total", "Number of entries read.", s.EntriesRead)
+	writeCounter(w, "logstore_read_bytes_total", "Number of entry data bytes read.", s.BytesRead)
+	writeSummary(w, "logstore_seek_latency_seconds", "Latency of finding the first entry to read.", s.SeekLatency)
+	writeCounter(w, "logstore_compactions_total", "Number of compactions.", s.Compactions)
+	writeCounter(w, "logstore_compaction_errors_total", "Number of failed compactions.", s.CompactionErrors)
+
+	_, _ = fmt.Fprintln(w, "# HELP logstore_compacted_segments_total Number of compacted segments.")
+	_, _ = fmt.Fprintln(w, "# TYPE logstore_compacted_segments_total counter")
+	_, _ = fmt.Fprintf(w, "logstore_compacted_segments_total{action=\"remove\"} %d\n", s.SegmentsRemoved)
+	_, _ = fmt.Fprintf(w, "logstore_compacted_segments_total{action=\"archive\"} %d\n", s.SegmentsArchived)
+	_, _ = fmt.Fprintf(w, "logstore_compacted_segments_total{action=\"merge\"} %d\n", s.SegmentsMerged)
+
+	writeCounter(w, "logstore_compaction_removed_entries_total", "Number of entries removed by compaction.",
+		s.EntriesRemoved)
+	writeCounter(w, "logstore_compaction_freed_bytes_total", "Number of bytes freed by compaction.", s.BytesFreed)
+	writeSummary(w, "logstore_compaction_duration_seconds", "Duration of compactions.", s.CompactionDuration)
+}
+
+func writeCounter(w io.Writer, name, help string, value int64) {
+	writeMetric(w, name, help, "counter", value)
+}
+
+func writeGauge(w io.Writer, name, help string, value int64) {
+	writeMetric(w, name, help, "gauge", value)
+}
+
+func writeMetric(w io.Writer, name, help, metricType string, value int64) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, metricType, name, value)
+}
+
+func writeSummary(w io.Writer, name, help string, s SummarySnapshot) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s summary\n%s_sum %g\n%s_count %d\n",
+		name, help, name, name, s.Sum.Seconds(), name, s.Count)
+}
@@ -0,0 +1,272 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package replication
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/elgopher/logstore/log"
+)
+
+// Follower replicates entries from the Leader to its own log. Follower holds the log Writer lock while running.
+type Follower struct {
+	log       *log.Log
+	leaderURL string
+	settings  *FollowerSettings
+
+	mutex          sync.Mutex
+	lastTime       time.Time
+	leaderLastTime time.Time
+}
+
+func NewFollower(l *log.Log, leaderURL string, options ...FollowerOption) (*Follower, error) {
+	if l == nil {
+		return nil, fmt.Errorf("nil log: %w", log.ErrInvalidParameter)
+	}
+
+	if _, err := url.Parse(leaderURL); err != nil || leaderURL == "" {
+		return nil, fmt.Errorf("invalid leader URL %q: %w", leaderURL, log.ErrInvalidParameter)
+	}
+
+	settings := &FollowerSettings{
+		client:        http.DefaultClient,
+		retryInterval: time.Second,
+		after:         time.After,
+		logger:        slog.Default(),
+	}
+
+	for _, applyOption := range options {
+		if applyOption == nil {
+			continue
+		}
+
+		if err := applyOption(settings); err != nil {
+			return nil, fmt.Errorf("error applying option: %w", err)
+		}
+	}
+
+	return &Follower{
+		log:       l,
+		leaderURL: leaderURL,
+		settings:  settings,
+	}, nil
+}
+
+type FollowerOption func(*FollowerSettings) error
+
+type FollowerSettings struct {
+	client        *http.Client
+	retryInterval time.Duration
+	after         func(time.Duration) <-chan time.Time
+	logger        *slog.Logger
+	writerOptions []log.OpenWriterOption
+	onCompaction  func(lastReplicated time.Time)
+}
+
+func HTTPClient(client *http.Client) FollowerOption {
+	return func(s *FollowerSettings) error {
+		if client == nil {
+			return fmt.Errorf("nil client: %w", log.ErrInvalidParameter)
+		}
+
+		s.client = client
+
+		return nil
+	}
+}
+
+// RetryInterval sets how long the Follower waits before reconnecting to the Leader.
+func RetryInterval(d time.Duration) FollowerOption {
+	return func(s *FollowerSettings) error {
+		if d < 0 {
+			return fmt.Errorf("negative retry interval: %w", log.ErrInvalidParameter)
+		}
+
+		s.retryInterval = d
+
+		return nil
+	}
+}
+
+func FollowerLogger(logger *slog.Logger) FollowerOption {
+	return func(s *FollowerSettings) error {
+		if logger == nil {
+			return fmt.Errorf("nil logger: %w", log.ErrInvalidParameter)
+		}
+
+		s.logger = logger
+
+		return nil
+	}
+}
+
+// WriterOptions are used when opening the follower's log Writer.
+func WriterOptions(options ...log.OpenWriterOption) FollowerOption {
+	return func(s *FollowerSettings) error {
+		s.writerOptions = append(s.writerOptions, options...)
+
+		return nil
+	}
+}
+
+// OnLeaderCompaction sets a function called when entries were removed from the Leader's log before they were
+// replicated, so the follower's log has a gap after lastReplicated time. The function can be used to report
+// the gap or to resynchronize the follower (for example from a snapshot). The function is called synchronously
+// by Run.
+func OnLeaderCompaction(f func(lastReplicated time.Time)) FollowerOption {
+	return func(s *FollowerSettings) error {
+		if f == nil {
+			return fmt.Errorf("nil function: %w", log.ErrInvalidParameter)
+		}
+
+		s.onCompaction = f
+
+		return nil
+	}
+}
+
+// Run replicates entries until ctx is cancelled. Replication is resumed from the last entry in the follower's log.
+// When connection to the Leader is lost, Run reconnects after the retry interval.
+func (f *Follower) Run(ctx context.Context) error {
+	lastTime, _, err := f.log.LastEntry()
+	if err != nil && !errors.Is(err, log.ErrEOL) {
+		return fmt.Errorf("reading last entry failed: %w", err)
+	}
+
+	writer, err := f.log.OpenWriter(f.settings.writerOptions...)
+	if err != nil {
+		return err
+	}
+	defer writer.Close() //nolint:errcheck
+
+	f.mutex.Lock()
+	f.lastTime = lastTime
+	f.mutex.Unlock()
+
+	for {
+		err = f.replicate(ctx, writer)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		f.settings.logger.Warn("replication interrupted", "err", err)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-f.settings.after(f.settings.retryInterval):
+		}
+	}
+}
+
+func (f *Follower) replicate(ctx context.Context, writer *log.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.streamURL(), nil)
+	if err != nil {
+		return fmt.Errorf("creating request failed: %w", err)
+	}
+
+	resp, err := f.settings.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("connecting to leader failed: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("leader responded with status %s: %w", resp.Status, ErrProtocol)
+	}
+
+	body := bufio.NewReader(resp.Body)
+
+	for {
+		fr, err := readFrame(body)
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("leader closed the stream: %w", err)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		switch fr.kind {
+		case frameKindHeartbeat:
+			f.mutex.Lock()
+			f.leaderLastTime = fr.time
+			f.mutex.Unlock()
+		case frameKindCompacted:
+			f.leaderCompacted()
+		case frameKindEntry, frameKindStreamEntry:
+			if err = writeEntry(writer, fr); err != nil {
+				return fmt.Errorf("writing entry failed: %w", err)
+			}
+
+			f.mutex.Lock()
+			f.lastTime = fr.time
+			if fr.time.After(f.leaderLastTime) {
+				f.leaderLastTime = fr.time
+			}
+			f.mutex.Unlock()
+		}
+	}
+}
+
+func (f *Follower) leaderCompacted() {
+	f.mutex.Lock()
+	lastTime := f.lastTime
+	f.mutex.Unlock()
+
+	f.settings.logger.Warn("entries were removed from the leader before they were replicated",
+		"lastReplicated", lastTime)
+
+	if f.settings.onCompaction != nil {
+		f.settings.onCompaction(lastTime)
+	}
+}
+
+func writeEntry(writer *log.Writer, fr frame) error {
+	if fr.kind == frameKindStreamEntry {
+		return writer.WriteToStreamWithTime(fr.time, fr.stream, fr.version, fr.data)
+	}
+
+	return writer.WriteWithTime(fr.time, fr.data)
+}
+
+func (f *Follower) streamURL() string {
+	f.mutex.Lock()
+	lastTime := f.lastTime
+	f.mutex.Unlock()
+
+	if lastTime.IsZero() {
+		return f.leaderURL
+	}
+
+	u, _ := url.Parse(f.leaderURL) // URL was validated in NewFollower
+	query := u.Query()
+	query.Set(afterParam, strconv.FormatInt(lastTime.UnixNano(), 10))
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// Lag returns the difference between time of the last entry in the leader's log and time of the last
+// replicated entry. Leader's last entry time is updated on each heartbeat.
+func (f *Follower) Lag() time.Duration {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if !f.leaderLastTime.After(f.lastTime) {
+		return 0
+	}
+
+	return f.leaderLastTime.Sub(f.lastTime)
+}
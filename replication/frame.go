@@ -0,0 +1,149 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package replication
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Stream sent by the Leader is a sequence of frames:
+//
+//	kind (1 byte) | time (int64 unix nanoseconds, little endian) | data length (uint32, little endian) | data
+//
+// Heartbeat frame contains time of the last entry in the leader's log and no data. Compacted frame is sent when
+// segment was removed from the leader's log before its entries were sent. It contains time of the last entry sent
+// before the gap (zero when no entry was sent yet) and no data. Stream entry frame has stream ID and version between
+// the header and data:
+//
+//	stream length (uint8) | stream | version (uint64, little endian)
+const (
+	frameKindEntry       byte = 1
+	frameKindHeartbeat   byte = 2
+	frameKindStreamEntry byte = 3
+	frameKindCompacted   byte = 4
+
+	frameHeaderSize = 1 + 8 + 4
+)
+
+type frame struct {
+	kind    byte
+	time    time.Time
+	stream  string
+	version uint64
+	data    []byte
+}
+
+func writeFrame(w io.Writer, f frame) error {
+	header := make([]byte, frameHeaderSize)
+	header[0] = f.kind
+	binary.LittleEndian.PutUint64(header[1:], uint64(frameNanos(f.time)))
+	binary.LittleEndian.PutUint32(header[9:], uint32(len(f.data)))
+
+	if _, err := w.Write(header); err != nil {
+		return fmt.Errorf("writing frame header failed: %w", err)
+	}
+
+	if f.kind == frameKindStreamEntry {
+		if err := writeStreamHeader(w, f); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.Write(f.data); err != nil {
+		return fmt.Errorf("writing frame data failed: %w", err)
+	}
+
+	return nil
+}
+
+func readFrame(r io.Reader) (frame, error) {
+	header := make([]byte, frameHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return frame{}, err
+	}
+
+	f := frame{
+		kind: header[0],
+		time: frameTime(int64(binary.LittleEndian.Uint64(header[1:]))),
+	}
+
+	switch f.kind {
+	case frameKindEntry, frameKindHeartbeat, frameKindCompacted:
+	case frameKindStreamEntry:
+		if err := readStreamHeader(r, &f); err != nil {
+			return frame{}, err
+		}
+	default:
+		return frame{}, fmt.Errorf("unknown frame kind %d: %w", f.kind, ErrProtocol)
+	}
+
+	dataLen := binary.LittleEndian.Uint32(header[9:])
+	if dataLen > 0 {
+		f.data = make([]byte, dataLen)
+		if _, err := io.ReadFull(r, f.data); err != nil {
+			return frame{}, fmt.Errorf("reading frame data failed: %w", err)
+		}
+	}
+
+	return f, nil
+}
+
+// frameNanos encodes zero time as 0, because time.Time.UnixNano is undefined for zero time.
+func frameNanos(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.UnixNano()
+}
+
+func frameTime(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, nanos).UTC()
+}
+
+func writeStreamHeader(w io.Writer, f frame) error {
+	if len(f.stream) == 0 || len(f.stream) > math.MaxUint8 {
+		return fmt.Errorf("invalid stream length %d", len(f.stream))
+	}
+
+	header := make([]byte, 0, 1+len(f.stream)+8)
+	header = append(header, byte(len(f.stream)))
+	header = append(header, f.stream...)
+	header = binary.LittleEndian.AppendUint64(header, f.version)
+
+	if _, err := w.Write(header); err != nil {
+		return fmt.Errorf("writing frame stream header failed: %w", err)
+	}
+
+	return nil
+}
+
+func readStreamHeader(r io.Reader, f *frame) error {
+	streamLen := make([]byte, 1)
+	if _, err := io.ReadFull(r, streamLen); err != nil {
+		return fmt.Errorf("reading frame stream header failed: %w", err)
+	}
+
+	if streamLen[0] == 0 {
+		return fmt.Errorf("empty stream in frame: %w", ErrProtocol)
+	}
+
+	header := make([]byte, int(streamLen[0])+8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("reading frame stream header failed: %w", err)
+	}
+
+	f.stream = string(header[:streamLen[0]])
+	f.version = binary.LittleEndian.Uint64(header[streamLen[0]:])
+
+	return nil
+}
@@ -0,0 +1,278 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package replication
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/elgopher/logstore/log"
+)
+
+// Leader is a http.Handler serving entries of the log. Each GET request opens a stream of entries written
+// after the time given in "after" query parameter (unix nanoseconds). When there are no new entries,
+// heartbeats are sent. When segment is removed from the log before its entries were sent, the Follower is informed
+// about the gap (see OnLeaderCompaction).
+type Leader struct {
+	log      *log.Log
+	settings *LeaderSettings
+}
+
+func NewLeader(l *log.Log, options ...LeaderOption) (*Leader, error) {
+	if l == nil {
+		return nil, fmt.Errorf("nil log: %w", log.ErrInvalidParameter)
+	}
+
+	settings := &LeaderSettings{
+		heartbeatInterval: time.Second,
+		pollInterval:      100 * time.Millisecond,
+		logger:            slog.Default(),
+	}
+
+	for _, applyOption := range options {
+		if applyOption == nil {
+			continue
+		}
+
+		if err := applyOption(settings); err != nil {
+			return nil, fmt.Errorf("error applying option: %w", err)
+		}
+	}
+
+	return &Leader{
+		log:      l,
+		settings: settings,
+	}, nil
+}
+
+type LeaderOption func(*LeaderSettings) error
+
+type LeaderSettings struct {
+	heartbeatInterval time.Duration
+	pollInterval      time.Duration
+	logger            *slog.Logger
+}
+
+// HeartbeatInterval sets how often the Leader sends heartbeats. Heartbeats are used by the Follower to
+// calculate the replication lag.
+func HeartbeatInterval(d time.Duration) LeaderOption {
+	return func(s *LeaderSettings) error {
+		if d <= 0 {
+			return fmt.Errorf("heartbeat interval must be positive: %w", log.ErrInvalidParameter)
+		}
+
+		s.heartbeatInterval = d
+
+		return nil
+	}
+}
+
+// PollInterval sets how often the Leader checks for new entries.
+func PollInterval(d time.Duration) LeaderOption {
+	return func(s *LeaderSettings) error {
+		if d <= 0 {
+			return fmt.Errorf("poll interval must be positive: %w", log.ErrInvalidParameter)
+		}
+
+		s.pollInterval = d
+
+		return nil
+	}
+}
+
+func LeaderLogger(logger *slog.Logger) LeaderOption {
+	return func(s *LeaderSettings) error {
+		if logger == nil {
+			return fmt.Errorf("nil logger: %w", log.ErrInvalidParameter)
+		}
+
+		s.logger = logger
+
+		return nil
+	}
+}
+
+type readResult struct {
+	time    time.Time
+	stream  string
+	version uint64
+	data    []byte
+	err     error
+	// compacted is true when segment was removed before its entries were read. Time is the time of the last
+	// entry read before.
+	compacted bool
+}
+
+func (l *Leader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	options := []log.OpenReaderOption{log.PollInterval(l.settings.pollInterval)}
+
+	if after := r.URL.Query().Get(afterParam); after != "" {
+		nanos, err := strconv.ParseInt(after, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid "+afterParam+" parameter", http.StatusBadRequest)
+
+			return
+		}
+
+		options = append(options, log.StartingFrom(time.Unix(0, nanos).Add(time.Nanosecond)))
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	reader, err := l.log.OpenTailReader(ctx, options...)
+	if err != nil {
+		l.settings.logger.Error("opening log reader failed", "err", err)
+		http.Error(w, "opening log reader failed", http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+
+	entries := make(chan readResult)
+
+	go func() {
+		defer close(entries)
+		defer reader.Close() //nolint:errcheck
+
+		readEntries(ctx, reader, entries)
+	}()
+
+	if err = l.stream(ctx, w, entries); err != nil && !errors.Is(err, context.Canceled) {
+		l.settings.logger.Warn("replication stream finished", "err", err)
+	}
+}
+
+func readEntries(ctx context.Context, reader log.Reader, entries chan<- readResult) {
+	read := func() readResult {
+		t, data, err := reader.Read()
+
+		return readResult{time: t, data: data, err: err}
+	}
+
+	if streamReader, ok := reader.(log.StreamEntryReader); ok {
+		read = func() readResult {
+			t, stream, version, data, err := streamReader.ReadStreamEntry()
+
+			return readResult{time: t, stream: stream, version: version, data: data, err: err}
+		}
+	}
+
+	var lastTime time.Time
+
+	for {
+		result := read()
+		if errors.Is(result.err, log.ErrSegmentCompacted) {
+			// entries were removed from the leader, therefore they can't be replicated anymore. Follower is informed
+			// about the gap and reading is continued.
+			result = readResult{time: lastTime, compacted: true}
+		} else if result.err == nil {
+			lastTime = result.time
+		}
+
+		select {
+		case entries <- result:
+		case <-ctx.Done():
+			return
+		}
+
+		if result.err != nil {
+			return
+		}
+	}
+}
+
+func (l *Leader) stream(ctx context.Context, w http.ResponseWriter, entries <-chan readResult) error {
+	bufferedWriter := bufio.NewWriter(w)
+	flusher, _ := w.(http.Flusher)
+
+	flush := func() error {
+		if err := bufferedWriter.Flush(); err != nil {
+			return err
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		return nil
+	}
+
+	heartbeat := time.NewTicker(l.settings.heartbeatInterval)
+	defer heartbeat.Stop()
+
+	if err := l.sendHeartbeat(bufferedWriter); err != nil {
+		return err
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-heartbeat.C:
+			if err := l.sendHeartbeat(bufferedWriter); err != nil {
+				return err
+			}
+		case entry, ok := <-entries:
+			if !ok {
+				return ctx.Err()
+			}
+
+			if entry.err != nil {
+				return entry.err
+			}
+
+			if err := writeFrame(bufferedWriter, entryFrame(entry)); err != nil {
+				return err
+			}
+		}
+
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+}
+
+func entryFrame(entry readResult) frame {
+	if entry.compacted {
+		return frame{kind: frameKindCompacted, time: entry.time}
+	}
+
+	if entry.stream == "" {
+		return frame{kind: frameKindEntry, time: entry.time, data: entry.data}
+	}
+
+	return frame{kind: frameKindStreamEntry, time: entry.time, stream: entry.stream, version: entry.version, data: entry.data}
+}
+
+func (l *Leader) sendHeartbeat(w *bufio.Writer) error {
+	lastTime, _, err := l.log.LastEntry()
+	if errors.Is(err, log.ErrEOL) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("reading last entry failed: %w", err)
+	}
+
+	return writeFrame(w, frame{kind: frameKindHeartbeat, time: lastTime})
+}
@@ -0,0 +1,16 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+// Package replication ships entries from one log (leader) to another (follower) over HTTP.
+//
+// Leader is a http.Handler streaming entries written to its log. Follower tails the leader
+// and writes entries to its own log using log.Writer.WriteWithTime, so entry times are preserved.
+package replication
+
+import "errors"
+
+// ErrProtocol is returned when the stream received from the leader is malformed.
+var ErrProtocol = errors.New("replication protocol error")
+
+// afterParam is a query parameter with unix nanoseconds time of the last entry already replicated by the follower.
+const afterParam = "after"
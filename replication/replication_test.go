@@ -0,0 +1,288 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package replication_test
+
+import (
+	"context"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/elgopher/logstore/internal/tests"
+	"github.com/elgopher/logstore/log"
+	"github.com/elgopher/logstore/replication"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	time2005 = tests.MustTime("2005-02-04T20:01:37Z")
+	time2006 = tests.MustTime("2006-01-02T15:04:05Z")
+	time2007 = tests.MustTime("2007-01-02T15:04:05Z")
+)
+
+const waitTimeout = 5 * time.Second
+
+func TestNewLeader(t *testing.T) {
+	t.Run("should return error for nil log", func(t *testing.T) {
+		_, err := replication.NewLeader(nil)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error for invalid heartbeat interval", func(t *testing.T) {
+		_, err := replication.NewLeader(log.New(tests.TempDir(t)), replication.HeartbeatInterval(0))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+}
+
+func TestNewFollower(t *testing.T) {
+	t.Run("should return error for nil log", func(t *testing.T) {
+		_, err := replication.NewFollower(nil, "http://localhost")
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error for nil compaction function", func(t *testing.T) {
+		_, err := replication.NewFollower(log.New(tests.TempDir(t)), "http://localhost", replication.OnLeaderCompaction(nil))
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should return error for empty leader URL", func(t *testing.T) {
+		_, err := replication.NewFollower(log.New(tests.TempDir(t)), "")
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+}
+
+func TestLeader_ServeHTTP(t *testing.T) {
+	t.Run("should reject invalid after parameter", func(t *testing.T) {
+		leaderLog, _ := tests.OpenLogWithWriter(t)
+		leader, err := replication.NewLeader(leaderLog)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		// when
+		leader.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/?after=abc", nil))
+		// then
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+}
+
+func TestFollower_Run(t *testing.T) {
+	t.Run("should replicate existing and new entries", func(t *testing.T) {
+		leaderLog, leaderWriter := tests.OpenLogWithWriter(t, log.MaxSegmentDuration(time.Minute))
+		require.NoError(t, leaderWriter.WriteWithTime(time2005, []byte("1")))
+		followerLog := startFollower(t, startLeader(t, leaderLog))
+		// when
+		require.NoError(t, leaderWriter.WriteWithTime(time2006, []byte("2")))
+		// then
+		waitForEntries(t, followerLog, 2)
+		assert.Equal(t, tests.ReadAll(t, leaderLog), tests.ReadAll(t, followerLog))
+	})
+
+	t.Run("should replicate stream entries", func(t *testing.T) {
+		leaderLog, leaderWriter := tests.OpenLogWithWriter(t)
+		_, _, err := leaderWriter.WriteToStream("order-1", []byte("1"))
+		require.NoError(t, err)
+		_, _, err = leaderWriter.WriteToStream("order-1", []byte("2"))
+		require.NoError(t, err)
+		followerLog := startFollower(t, startLeader(t, leaderLog))
+		// when
+		waitForEntries(t, followerLog, 2)
+		// then
+		version, err := followerLog.StreamVersion("order-1")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), version)
+	})
+
+	t.Run("should resume from the last entry of follower log", func(t *testing.T) {
+		leaderLog, leaderWriter := tests.OpenLogWithWriter(t)
+		require.NoError(t, leaderWriter.WriteWithTime(time2005, []byte("1")))
+		require.NoError(t, leaderWriter.WriteWithTime(time2006, []byte("2")))
+		require.NoError(t, leaderWriter.WriteWithTime(time2007, []byte("3")))
+		followerLog, followerWriter := tests.OpenLogWithWriter(t)
+		require.NoError(t, followerWriter.WriteWithTime(time2006, []byte("2")))
+		require.NoError(t, followerWriter.Close())
+		// when
+		startFollowerForLog(t, followerLog, startLeader(t, leaderLog))
+		// then
+		waitForEntries(t, followerLog, 2)
+		assert.Equal(t, tests.ReadAll(t, leaderLog)[1:], tests.ReadAll(t, followerLog))
+	})
+
+	t.Run("should skip segments compacted on leader", func(t *testing.T) {
+		leaderLog, leaderWriter := tests.OpenLogWithWriter(t, log.MaxSegmentDuration(time.Minute))
+		require.NoError(t, leaderWriter.WriteWithTime(time2005, []byte("1")))
+		require.NoError(t, leaderWriter.WriteWithTime(time2006, []byte("2")))
+		require.NoError(t, leaderWriter.WriteWithTime(time2007, []byte("3")))
+		segments, err := leaderLog.Segments()
+		require.NoError(t, err)
+		require.NoError(t, leaderLog.RemoveSegmentStartingAt(segments[0].StartingAt))
+		// when
+		followerLog := startFollower(t, startLeader(t, leaderLog))
+		// then
+		waitForEntries(t, followerLog, 1)
+		assert.Equal(t, tests.ReadAll(t, leaderLog), tests.ReadAll(t, followerLog))
+	})
+
+	t.Run("should report entries compacted on leader during replication", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(encodeFrame(1, time2005, []byte("1")))
+			_, _ = w.Write(encodeFrame(4, time2006, nil))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}))
+		t.Cleanup(server.Close)
+		compacted := make(chan time.Time, 1)
+		follower, err := replication.NewFollower(log.New(tests.TempDir(t)), server.URL,
+			replication.OnLeaderCompaction(func(lastReplicated time.Time) {
+				compacted <- lastReplicated
+			}))
+		require.NoError(t, err)
+		// when
+		runFollower(t, follower)
+		// then
+		select {
+		case lastReplicated := <-compacted:
+			assert.Equal(t, time2005, lastReplicated)
+		case <-time.After(waitTimeout):
+			require.Fail(t, "compaction was not reported")
+		}
+	})
+
+	t.Run("should reconnect after leader closed the stream", func(t *testing.T) {
+		leaderLog, leaderWriter := tests.OpenLogWithWriter(t)
+		leader, err := replication.NewLeader(leaderLog, replication.PollInterval(time.Millisecond))
+		require.NoError(t, err)
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests == 1 {
+				return // closes the stream immediately
+			}
+
+			leader.ServeHTTP(w, r)
+		}))
+		t.Cleanup(server.Close)
+		followerLog := startFollower(t, server.URL)
+		// when
+		require.NoError(t, leaderWriter.WriteWithTime(time2005, []byte("1")))
+		// then
+		waitForEntries(t, followerLog, 1)
+	})
+}
+
+func TestFollower_Lag(t *testing.T) {
+	t.Run("should return zero when nothing was replicated yet", func(t *testing.T) {
+		follower, err := replication.NewFollower(log.New(tests.TempDir(t)), "http://localhost")
+		require.NoError(t, err)
+		assert.Zero(t, follower.Lag())
+	})
+
+	t.Run("should return difference between leader last entry and replicated entry", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(encodeFrame(1, time2005, []byte("1")))
+			_, _ = w.Write(encodeFrame(2, time2006, nil))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}))
+		t.Cleanup(server.Close)
+		follower, err := replication.NewFollower(log.New(tests.TempDir(t)), server.URL)
+		require.NoError(t, err)
+		runFollower(t, follower)
+		// expect
+		assert.Eventually(t, func() bool {
+			return follower.Lag() == time2006.Sub(time2005)
+		}, waitTimeout, time.Millisecond)
+	})
+
+	t.Run("should return zero when follower caught up", func(t *testing.T) {
+		leaderLog, leaderWriter := tests.OpenLogWithWriter(t)
+		require.NoError(t, leaderWriter.WriteWithTime(time2005, []byte("1")))
+		follower, err := replication.NewFollower(log.New(tests.TempDir(t)), startLeader(t, leaderLog),
+			replication.RetryInterval(time.Millisecond))
+		require.NoError(t, err)
+		runFollower(t, follower)
+		// when
+		require.NoError(t, leaderWriter.WriteWithTime(time2006, []byte("2")))
+		// then
+		assert.Eventually(t, func() bool {
+			return follower.Lag() == 0
+		}, waitTimeout, time.Millisecond)
+	})
+}
+
+func startLeader(t *testing.T, l *log.Log) string {
+	t.Helper()
+
+	leader, err := replication.NewLeader(l,
+		replication.PollInterval(time.Millisecond),
+		replication.HeartbeatInterval(time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(leader)
+	t.Cleanup(server.Close)
+
+	return server.URL
+}
+
+func startFollower(t *testing.T, leaderURL string) *log.Log {
+	t.Helper()
+
+	l := log.New(tests.TempDir(t))
+	startFollowerForLog(t, l, leaderURL)
+
+	return l
+}
+
+func startFollowerForLog(t *testing.T, l *log.Log, leaderURL string) {
+	t.Helper()
+
+	follower, err := replication.NewFollower(l, leaderURL, replication.RetryInterval(time.Millisecond))
+	require.NoError(t, err)
+	runFollower(t, follower)
+}
+
+func runFollower(t *testing.T, follower *replication.Follower) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	async := tests.RunAsync(func() {
+		assert.NoError(t, follower.Run(ctx))
+	})
+
+	t.Cleanup(func() {
+		cancel()
+		async.WaitOrFailAfter(t, waitTimeout)
+	})
+}
+
+func waitForEntries(t *testing.T, l *log.Log, count int) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		reader, err := l.OpenReader()
+		if err != nil {
+			return false
+		}
+		defer reader.Close() //nolint:errcheck
+
+		n := 0
+		for {
+			if _, _, err = reader.Read(); err != nil {
+				return n >= count
+			}
+			n++
+		}
+	}, waitTimeout, time.Millisecond)
+}
+
+func encodeFrame(kind byte, t time.Time, data []byte) []byte {
+	frame := make([]byte, 13, 13+len(data))
+	frame[0] = kind
+	binary.LittleEndian.PutUint64(frame[1:], uint64(t.UnixNano()))
+	binary.LittleEndian.PutUint32(frame[9:], uint32(len(data)))
+
+	return append(frame, data...)
+}
@@ -0,0 +1,224 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elgopher/logstore/compacter"
+	"github.com/elgopher/logstore/internal/fsutil"
+	"github.com/elgopher/logstore/log"
+)
+
+const (
+	snapshotsDir               = "snapshots"
+	snapshotFilenameDateFormat = "2006-01-02T15_04_05.000000000Z"
+	snapshotFilenameExtension  = ".snapshot"
+	tmpFilenameExtension       = ".tmp"
+)
+
+func New(l *log.Log) (*Store, error) {
+	if l == nil {
+		return nil, fmt.Errorf("nil log: %w", log.ErrInvalidParameter)
+	}
+
+	return &Store{
+		log: l,
+		dir: path.Join(l.Dir(), snapshotsDir),
+	}, nil
+}
+
+type Store struct {
+	log *log.Log
+	dir string
+}
+
+type Snapshot struct {
+	// Time of the last log entry included in the snapshot
+	Time time.Time
+	Data []byte
+}
+
+// Save stores snapshot of the state built from all log entries up to t (inclusive).
+// The file is written atomically - snapshot is either fully saved or not saved at all.
+func (s *Store) Save(t time.Time, data []byte) error {
+	if t.IsZero() {
+		return fmt.Errorf("zero snapshot time: %w", log.ErrInvalidParameter)
+	}
+
+	if err := os.MkdirAll(s.dir, 0775); err != nil {
+		return fmt.Errorf("cannot create snapshots directory: %w", err)
+	}
+
+	filename := path.Join(s.dir, snapshotFilename(t))
+	tmpFilename := filename + tmpFilenameExtension
+
+	if err := writeFileSynced(tmpFilename, data); err != nil {
+		_ = os.Remove(tmpFilename)
+
+		return err
+	}
+
+	if err := os.Rename(tmpFilename, filename); err != nil {
+		_ = os.Remove(tmpFilename)
+
+		return fmt.Errorf("renaming snapshot file failed: %w", err)
+	}
+
+	fsutil.SyncDir(s.dir)
+
+	return nil
+}
+
+func writeFileSynced(filename string, data []byte) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
+	if err != nil {
+		return fmt.Errorf("error opening snapshot file %s for write: %w", filename, err)
+	}
+
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+
+		return fmt.Errorf("writing snapshot file failed: %w", err)
+	}
+
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+
+		return fmt.Errorf("syncing snapshot file failed: %w", err)
+	}
+
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("closing snapshot file failed: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) List() ([]time.Time, error) {
+	files, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadDir failed: %w", err)
+	}
+
+	var times []time.Time
+
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, snapshotFilenameExtension) {
+			continue
+		}
+
+		t, err := time.Parse(snapshotFilenameDateFormat, strings.TrimSuffix(name, snapshotFilenameExtension))
+		if err != nil {
+			continue
+		}
+
+		times = append(times, t)
+	}
+
+	sort.Slice(times, func(i, j int) bool {
+		return times[i].Before(times[j])
+	})
+
+	return times, nil
+}
+
+// Latest returns the newest snapshot together with a Reader returning log entries written after the snapshot.
+// When there are no snapshots, zero Snapshot is returned and the Reader reads the whole log.
+func (s *Store) Latest() (Snapshot, log.Reader, error) {
+	times, err := s.List()
+	if err != nil {
+		return Snapshot{}, nil, err
+	}
+
+	if len(times) == 0 {
+		reader, err := s.log.OpenReader()
+		if err != nil {
+			return Snapshot{}, nil, fmt.Errorf("opening reader failed: %w", err)
+		}
+
+		return Snapshot{}, reader, nil
+	}
+
+	latest := times[len(times)-1]
+
+	data, err := os.ReadFile(path.Join(s.dir, snapshotFilename(latest)))
+	if err != nil {
+		return Snapshot{}, nil, fmt.Errorf("reading snapshot file failed: %w", err)
+	}
+
+	reader, err := s.log.OpenReader(log.StartingFrom(latest.Add(time.Nanosecond)))
+	if err != nil {
+		return Snapshot{}, nil, fmt.Errorf("opening reader failed: %w", err)
+	}
+
+	return Snapshot{Time: latest, Data: data}, reader, nil
+}
+
+// RemoveOldSnapshots removes all snapshots except the newest ones. Returns times of removed snapshots.
+func (s *Store) RemoveOldSnapshots(retain int) ([]time.Time, error) {
+	if retain < 1 {
+		return nil, fmt.Errorf("at least one snapshot must be retained: %w", log.ErrInvalidParameter)
+	}
+
+	times, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(times) <= retain {
+		return nil, nil
+	}
+
+	var removed []time.Time
+
+	for _, t := range times[:len(times)-retain] {
+		if err = os.Remove(path.Join(s.dir, snapshotFilename(t))); err != nil {
+			return removed, fmt.Errorf("removing snapshot failed: %w", err)
+		}
+
+		removed = append(removed, t)
+	}
+
+	return removed, nil
+}
+
+// Policy returns a compaction policy requiring removal of segments which contain only entries already included
+// in the oldest snapshot. Such segments are no longer needed for replaying the state from any retained snapshot.
+// When there are no snapshots, the policy does not require removing any segment. Policy can be used together with
+// other policies, for example by compacter.Compacter. Segments required by other policies are removed even when
+// they contain entries not included in snapshots.
+func (s *Store) Policy() compacter.Policy {
+	return compacter.NewPolicy("snapshots", func(segments []log.Segment, _ time.Time) (int, error) {
+		times, err := s.List()
+		if err != nil || len(times) == 0 {
+			return 0, err
+		}
+
+		oldest := times[0]
+
+		count := 0
+		// all entries of a segment are older than the start of the next segment
+		for count < len(segments)-1 && !segments[count+1].StartingAt.After(oldest.Add(time.Nanosecond)) {
+			count++
+		}
+
+		return count, nil
+	})
+}
+
+func snapshotFilename(t time.Time) string {
+	return t.UTC().Format(snapshotFilenameDateFormat) + snapshotFilenameExtension
+}
@@ -0,0 +1,234 @@
+// (c) 2021 Jacek Olszak
+// This code is licensed under MIT license (see LICENSE for details)
+
+package snapshot_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elgopher/logstore/compacter"
+	"github.com/elgopher/logstore/internal/tests"
+	"github.com/elgopher/logstore/log"
+	"github.com/elgopher/logstore/snapshot"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	data1 = []byte("data1")
+	data2 = []byte("data2")
+	state = []byte("state")
+
+	time2005 = tests.MustTime("2005-02-04T20:01:37Z")
+	time2006 = tests.MustTime("2006-01-02T15:04:05Z")
+	time2007 = tests.MustTime("2007-01-02T15:04:05Z")
+)
+
+func TestNew(t *testing.T) {
+	t.Run("should return error when log is nil", func(t *testing.T) {
+		_, err := snapshot.New(nil)
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+}
+
+func TestStore_Save(t *testing.T) {
+	t.Run("should return error for zero time", func(t *testing.T) {
+		store := newStore(t, log.New(tests.TempDir(t)))
+		// when
+		err := store.Save(time.Time{}, state)
+		// then
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should save snapshot", func(t *testing.T) {
+		store := newStore(t, log.New(tests.TempDir(t)))
+		// when
+		err := store.Save(time2005, state)
+		// then
+		require.NoError(t, err)
+		times, err := store.List()
+		require.NoError(t, err)
+		assert.Equal(t, []time.Time{time2005}, times)
+	})
+
+	t.Run("should not create segments", func(t *testing.T) {
+		l := log.New(tests.TempDir(t))
+		store := newStore(t, l)
+		// when
+		err := store.Save(time2005, state)
+		// then
+		require.NoError(t, err)
+		segments, err := l.Segments()
+		require.NoError(t, err)
+		assert.Empty(t, segments)
+	})
+}
+
+func TestStore_List(t *testing.T) {
+	t.Run("should return empty list when there are no snapshots", func(t *testing.T) {
+		store := newStore(t, log.New(tests.TempDir(t)))
+		// when
+		times, err := store.List()
+		// then
+		require.NoError(t, err)
+		assert.Empty(t, times)
+	})
+
+	t.Run("should return sorted snapshot times", func(t *testing.T) {
+		store := newStore(t, log.New(tests.TempDir(t)))
+		require.NoError(t, store.Save(time2006, state))
+		require.NoError(t, store.Save(time2005, state))
+		// when
+		times, err := store.List()
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, []time.Time{time2005, time2006}, times)
+	})
+}
+
+func TestStore_Latest(t *testing.T) {
+	t.Run("should return reader for the whole log when there are no snapshots", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		require.NoError(t, writer.WriteWithTime(time2005, data1))
+		store := newStore(t, l)
+		// when
+		snap, reader, err := store.Latest()
+		defer tests.Close(t, reader)
+		// then
+		require.NoError(t, err)
+		assert.True(t, snap.Time.IsZero())
+		assert.Nil(t, snap.Data)
+		entryTime, data, err := reader.Read()
+		require.NoError(t, err)
+		assert.Equal(t, time2005, entryTime)
+		assert.Equal(t, data1, data)
+	})
+
+	t.Run("should return the newest snapshot and reader positioned after it", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t)
+		require.NoError(t, writer.WriteWithTime(time2005, data1))
+		require.NoError(t, writer.WriteWithTime(time2006, data2))
+		store := newStore(t, l)
+		require.NoError(t, store.Save(time2005, []byte("old")))
+		require.NoError(t, store.Save(time2006, state))
+		require.NoError(t, writer.WriteWithTime(time2007, data1))
+		// when
+		snap, reader, err := store.Latest()
+		defer tests.Close(t, reader)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, time2006, snap.Time)
+		assert.Equal(t, state, snap.Data)
+		entryTime, data, err := reader.Read()
+		require.NoError(t, err)
+		assert.Equal(t, time2007, entryTime)
+		assert.Equal(t, data1, data)
+		_, _, err = reader.Read()
+		assert.ErrorIs(t, err, log.ErrEOL)
+	})
+}
+
+func TestStore_RemoveOldSnapshots(t *testing.T) {
+	t.Run("should return error when no snapshot would be retained", func(t *testing.T) {
+		store := newStore(t, log.New(tests.TempDir(t)))
+		// when
+		_, err := store.RemoveOldSnapshots(0)
+		// then
+		assert.ErrorIs(t, err, log.ErrInvalidParameter)
+	})
+
+	t.Run("should keep the newest snapshots", func(t *testing.T) {
+		store := newStore(t, log.New(tests.TempDir(t)))
+		require.NoError(t, store.Save(time2005, state))
+		require.NoError(t, store.Save(time2006, state))
+		require.NoError(t, store.Save(time2007, state))
+		// when
+		removed, err := store.RemoveOldSnapshots(2)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, []time.Time{time2005}, removed)
+		times, err := store.List()
+		require.NoError(t, err)
+		assert.Equal(t, []time.Time{time2006, time2007}, times)
+	})
+}
+
+func TestStore_Policy(t *testing.T) {
+	t.Run("should not remove segments when there are no snapshots", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentSizeMB(1))
+		tests.WriteEntry(t, writer, tests.OneMegabyte)
+		tests.WriteEntry(t, writer, tests.OneMegabyte)
+		store := newStore(t, l)
+		// when
+		results, err := compacter.RemoveSegments(l, time.Now(), store.Policy())
+		// then
+		require.NoError(t, err)
+		assert.Empty(t, results.SegmentsRemoved)
+	})
+
+	t.Run("should remove segments containing only entries older than the oldest snapshot", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentSizeMB(1))
+		tests.WriteEntry(t, writer, tests.OneMegabyte)
+		t2 := tests.WriteEntry(t, writer, tests.OneMegabyte)
+		tests.WriteEntry(t, writer, tests.OneMegabyte)
+		segmentsBefore, err := l.Segments()
+		require.NoError(t, err)
+		store := newStore(t, l)
+		require.NoError(t, store.Save(t2, state))
+		// when
+		results, err := compacter.RemoveSegments(l, time.Now(), store.Policy())
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, segmentsBefore[:2], results.SegmentsRemoved)
+		_, reader, err := store.Latest()
+		require.NoError(t, err)
+		defer tests.Close(t, reader)
+		_, data, err := reader.Read()
+		require.NoError(t, err)
+		assert.Len(t, data, int(tests.OneMegabyte))
+	})
+
+	t.Run("should not remove segment containing entries newer than the oldest snapshot", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentSizeMB(1))
+		t1 := tests.WriteEntry(t, writer, 1)
+		tests.WriteEntry(t, writer, tests.OneMegabyte)
+		tests.WriteEntry(t, writer, tests.OneMegabyte)
+		store := newStore(t, l)
+		require.NoError(t, store.Save(t1, state))
+		// when
+		results, err := compacter.RemoveSegments(l, time.Now(), store.Policy())
+		// then
+		require.NoError(t, err)
+		assert.Empty(t, results.SegmentsRemoved)
+	})
+
+	t.Run("should be applied by compacter together with other policies", func(t *testing.T) {
+		l, writer := tests.OpenLogWithWriter(t, log.MaxSegmentSizeMB(1))
+		tests.WriteEntry(t, writer, tests.OneMegabyte)
+		t2 := tests.WriteEntry(t, writer, tests.OneMegabyte)
+		tests.WriteEntry(t, writer, tests.OneMegabyte)
+		segmentsBefore, err := l.Segments()
+		require.NoError(t, err)
+		store := newStore(t, l)
+		require.NoError(t, store.Save(t2, state))
+		maxSegments, err := compacter.MaxSegments(len(segmentsBefore))
+		require.NoError(t, err)
+		// when
+		plan, err := compacter.Plan(l, compacter.Policies(store.Policy(), maxSegments))
+		// then
+		require.NoError(t, err)
+		require.Len(t, plan.Actions, 2)
+		assert.Equal(t, segmentsBefore[0], plan.Actions[0].Segment)
+		assert.Contains(t, plan.Actions[0].Reason, "snapshots")
+	})
+}
+
+func newStore(t *testing.T, l *log.Log) *snapshot.Store {
+	t.Helper()
+
+	store, err := snapshot.New(l)
+	require.NoError(t, err)
+
+	return store
+}